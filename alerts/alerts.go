@@ -0,0 +1,174 @@
+// Package alerts checks the stock of items in the background and notifies
+// about items that have reached their reorder point.
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/logging"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"go.uber.org/multierr"
+)
+
+// Alert tells that an item is low on stock.
+type Alert struct {
+	ItemID         uint      `json:"item_id"`
+	ItemName       string    `json:"item_name"`
+	InventoryName  string    `json:"inventory_name"`
+	Quantity       int       `json:"quantity"`
+	ReorderPoint   int       `json:"reorder_point"`
+	SuggestedOrder int       `json:"suggested_order"`
+	Time           time.Time `json:"time"`
+}
+
+func newAlert(item models.Item, now time.Time) Alert {
+	point, _ := item.EffectiveReorderPoint()
+	return Alert{
+		ItemID:         item.ID,
+		ItemName:       item.Name,
+		InventoryName:  item.Inventory.Name,
+		Quantity:       item.Quantity,
+		ReorderPoint:   point,
+		SuggestedOrder: item.SuggestedOrder(),
+		Time:           now,
+	}
+}
+
+// Notifier delivers alerts somewhere.
+type Notifier interface {
+	Notify(ctx context.Context, alerts []Alert) error
+}
+
+// LogNotifier writes alerts to a logger as warnings.
+type LogNotifier struct {
+	Logger *logging.Logger
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	for _, a := range alerts {
+		n.Logger.Warn(ctx, "Low stock",
+			"item_id", a.ItemID,
+			"item_name", a.ItemName,
+			"inventory", a.InventoryName,
+			"quantity", a.Quantity,
+			"reorder_point", a.ReorderPoint,
+			"suggested_order", a.SuggestedOrder,
+		)
+	}
+	return nil
+}
+
+// WebhookNotifier posts alerts as JSON to a URL. The body is an object with an
+// alerts array.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+type webhookPayload struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	body, err := json.Marshal(webhookPayload{Alerts: alerts})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MultiNotifier delivers alerts through every notifier.
+type MultiNotifier []Notifier
+
+func (m MultiNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	var errs error
+	for _, n := range m {
+		errs = multierr.Append(errs, n.Notify(ctx, alerts))
+	}
+	return errs
+}
+
+// Checker periodically looks for low stock items. An item is only reported
+// once until it is restocked above its reorder point.
+type Checker struct {
+	itemRepo *models.ItemRepository
+	notifier Notifier
+	interval time.Duration
+
+	notified map[uint]bool
+}
+
+func NewChecker(itemRepo *models.ItemRepository, notifier Notifier, interval time.Duration) *Checker {
+	return &Checker{
+		itemRepo: itemRepo,
+		notifier: notifier,
+		interval: interval,
+		notified: make(map[uint]bool),
+	}
+}
+
+// Check notifies about the items that have become low on stock since the
+// previous check and returns the sent alerts.
+func (c *Checker) Check(ctx context.Context) ([]Alert, error) {
+	items, err := c.itemRepo.FindLowStock()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	low := make(map[uint]bool, len(items))
+	var alerts []Alert
+	for _, item := range items {
+		low[item.ID] = true
+		if !c.notified[item.ID] {
+			alerts = append(alerts, newAlert(item, now))
+		}
+	}
+	if len(alerts) > 0 {
+		if err := c.notifier.Notify(ctx, alerts); err != nil {
+			// The items are reported again on the next check.
+			return nil, err
+		}
+	}
+	c.notified = low
+	return alerts, nil
+}
+
+// Run checks the stock on every interval until the context is done.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := c.Check(ctx); err != nil {
+			logging.Error(ctx, "Checking low stock items failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupDB() (*gorm.DB, error) {
+	db, err := models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.Migrate(db)
+	if err != nil {
+		return nil, err
+	}
+	return db, err
+}
+
+func tearDownDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	n := &WebhookNotifier{URL: server.URL, Client: server.Client()}
+	err := n.Notify(context.Background(), []Alert{{ItemID: 1, ItemName: "Pencil", Quantity: 2}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(received.Alerts))
+	assert.Equal(t, "Pencil", received.Alerts[0].ItemName)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	n = &WebhookNotifier{URL: failing.URL, Client: failing.Client()}
+	assert.NotNil(t, n.Notify(context.Background(), []Alert{{ItemID: 1}}))
+}
+
+type recordingNotifier struct {
+	calls [][]Alert
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, alerts []Alert) error {
+	n.calls = append(n.calls, alerts)
+	return nil
+}
+
+func TestChecker(t *testing.T) {
+	db, err := setupDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := tearDownDB(db); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	three := 3
+	invRepo := &models.InventoryRepository{DB: db}
+	inv, err := invRepo.Create(models.Inventory{Name: "School", ReorderPoint: &three})
+	assert.Nil(t, err)
+	itemRepo := &models.ItemRepository{DB: db}
+	item, err := itemRepo.Create(models.Item{Name: "Pencil", SKU: "PENCIL", InventoryID: inv.ID, Quantity: 2})
+	assert.Nil(t, err)
+	_, err = itemRepo.Create(models.Item{Name: "Backpack", SKU: "BACKPACK", InventoryID: inv.ID, Quantity: 8})
+	assert.Nil(t, err)
+
+	notifier := &recordingNotifier{}
+	checker := NewChecker(itemRepo, notifier, time.Minute)
+
+	sent, err := checker.Check(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sent))
+	assert.Equal(t, "Pencil", sent[0].ItemName)
+	assert.Equal(t, "School", sent[0].InventoryName)
+	assert.Equal(t, 3, sent[0].ReorderPoint)
+
+	// An item is not reported twice in a row.
+	sent, err = checker.Check(context.Background())
+	assert.Nil(t, err)
+	assert.Empty(t, sent)
+	assert.Equal(t, 1, len(notifier.calls))
+
+	// After restocking and running low again it is reported again.
+	item.Quantity = 10
+	item, err = itemRepo.Update(item)
+	assert.Nil(t, err)
+	_, err = checker.Check(context.Background())
+	assert.Nil(t, err)
+	item.Quantity = 1
+	_, err = itemRepo.Update(item)
+	assert.Nil(t, err)
+	sent, err = checker.Check(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sent))
+	assert.Equal(t, 2, len(notifier.calls))
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
-	"log"
+	"context"
 
+	"github.com/shayanh/shopify-challenge-2022/logging"
 	"github.com/shayanh/shopify-challenge-2022/models"
 	"gorm.io/gorm"
 )
@@ -22,17 +23,17 @@ func fillInitialData(db *gorm.DB) error {
 			return err
 		}
 		invs[i] = updatedInv
-		log.Printf("Created inventory - ID=%d, Name=%s\n", updatedInv.ID, updatedInv.Name)
+		logging.Info(context.Background(), "Created inventory", "id", updatedInv.ID, "name", updatedInv.Name)
 	}
 
 	items := []models.Item{
-		{Name: "Pencil", InventoryID: invs[0].ID, Quantity: 8,
+		{Name: "Pencil", SKU: "SCH-PENCIL", InventoryID: invs[0].ID, Quantity: 8,
 			Description: "Black writing pencil for school days."},
-		{Name: "Backpack", InventoryID: invs[0].ID, Quantity: 11,
+		{Name: "Backpack", SKU: "SCH-BACKPACK", InventoryID: invs[0].ID, Quantity: 11,
 			Description: "Medium sized school backpack."},
-		{Name: "Anti Virus", InventoryID: invs[1].ID, Quantity: 3,
+		{Name: "Anti Virus", SKU: "SW-ANTIVIRUS", InventoryID: invs[1].ID, Quantity: 3,
 			Description: "Strong protection for your machine."},
-		{Name: "iPhone 13", InventoryID: invs[2].ID, Quantity: 9,
+		{Name: "iPhone 13", SKU: "PH-IPHONE13", InventoryID: invs[2].ID, Quantity: 9,
 			Description: "Smartphone by Apple company."},
 	}
 	itemRepo := models.ItemRepository{
@@ -43,7 +44,7 @@ func fillInitialData(db *gorm.DB) error {
 		if err != nil {
 			return err
 		}
-		log.Printf("Created item - ID=%d, Name=%s\n", updatedItem.ID, updatedItem.Name)
+		logging.Info(context.Background(), "Created item", "id", updatedItem.ID, "name", updatedItem.Name)
 	}
 	return nil
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"gorm.io/gorm"
+)
+
+// runImport implements the import subcommand. It imports items from a CSV
+// file and prints a per-row report. The returned value is the exit code.
+func runImport(db *gorm.DB, args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "preview the changes without saving them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import [-dry-run] FILE\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	itemRepo := &models.ItemRepository{DB: db}
+	report, err := itemRepo.ImportCSV(file, *dryRun, models.FullAccess)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, row := range report.Rows {
+		if row.Error != "" {
+			fmt.Printf("line %d: %s %q: %s\n", row.Line, row.Action, row.Name, row.Error)
+		} else {
+			fmt.Printf("line %d: %s %q (id=%d)\n", row.Line, row.Action, row.Name, row.ItemID)
+		}
+	}
+	fmt.Printf("created=%d updated=%d rejected=%d\n", report.Created, report.Updated, report.Rejected)
+	switch {
+	case report.Rejected > 0:
+		fmt.Println("rows rejected, no changes saved")
+		return 1
+	case report.DryRun:
+		fmt.Println("dry run, no changes saved")
+	default:
+		fmt.Println("changes saved")
+	}
+	return 0
+}
@@ -1,18 +1,48 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/shayanh/shopify-challenge-2022/alerts"
+	"github.com/shayanh/shopify-challenge-2022/config"
 	"github.com/shayanh/shopify-challenge-2022/handlers"
+	"github.com/shayanh/shopify-challenge-2022/logging"
+	"github.com/shayanh/shopify-challenge-2022/metrics"
+	"github.com/shayanh/shopify-challenge-2022/migrate"
 	"github.com/shayanh/shopify-challenge-2022/models"
-	"gorm.io/driver/sqlite"
+	"github.com/shayanh/shopify-challenge-2022/web"
 	"gorm.io/gorm"
 )
 
+// lowStockCheckInterval is the interval of looking for low stock items.
+const lowStockCheckInterval = 5 * time.Minute
+
+// RequestIDHeader is the header of the request ID. IDs sent by clients or
+// proxies are kept, so the entries of a request can be followed across
+// services, and new ones are generated otherwise.
+const RequestIDHeader = "X-Request-ID"
+
+// ResponseWriterWrapper records the status and the size of a response.
 type ResponseWriterWrapper struct {
 	Status int
+	// Bytes is the number of body bytes written.
+	Bytes int64
 	http.ResponseWriter
 }
 
@@ -21,33 +51,195 @@ func (rww *ResponseWriterWrapper) WriteHeader(statusCode int) {
 	rww.ResponseWriter.WriteHeader(statusCode)
 }
 
+func (rww *ResponseWriterWrapper) Write(b []byte) (int, error) {
+	n, err := rww.ResponseWriter.Write(b)
+	rww.Bytes += int64(n)
+	return n, err
+}
+
 func NewResponseWriterWrapper(rww http.ResponseWriter) *ResponseWriterWrapper {
-	return &ResponseWriterWrapper{http.StatusOK, rww}
+	return &ResponseWriterWrapper{Status: http.StatusOK, ResponseWriter: rww}
+}
+
+// httpMetrics are the metrics of served requests. Requests are labeled with
+// the name of their route, or its path template for unnamed routes, so that
+// requests of the same handler share their series.
+type httpMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+}
+
+func newHTTPMetrics(registry prometheus.Registerer) *httpMetrics {
+	factory := promauto.With(registry)
+	return &httpMetrics{
+		requests: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests.",
+		}, []string{"method", "route", "status"}),
+		duration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "http_request_duration_seconds",
+			Help: "Duration of HTTP requests.",
+		}, []string{"method", "route"}),
+		size: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "Size of HTTP response bodies.",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 8),
+		}, []string{"method", "route"}),
+	}
+}
+
+// routeLabel returns the route label of a request. Requests that match no
+// route share a single label, since their paths are unbounded.
+func routeLabel(router *mux.Router, r *http.Request) string {
+	var match mux.RouteMatch
+	if !router.Match(r, &match) || match.Route == nil {
+		return "unmatched"
+	}
+	if name := match.Route.GetName(); name != "" {
+		return name
+	}
+	if tmpl, err := match.Route.GetPathTemplate(); err == nil {
+		return routeVarPattern.ReplaceAllString(tmpl, "{$1}")
+	}
+	return "unmatched"
 }
 
-func logDecorator(h http.Handler) http.Handler {
+// routeVarPattern matches the patterns of route variables, which are left out
+// of route labels.
+var routeVarPattern = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+// measureRequests records the metrics of every request. The route is looked
+// up before the request is served, since the middlewares in front of the
+// router may answer it without routing it.
+func measureRequests(m *httpMetrics, router *mux.Router, h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := routeLabel(router, r)
 		wr := NewResponseWriterWrapper(w)
 		h.ServeHTTP(wr, r)
-		log.Printf("%s %s %d", r.Method, r.URL.Path, wr.Status)
+		m.requests.WithLabelValues(r.Method, route, strconv.Itoa(wr.Status)).Inc()
+		m.duration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		m.size.WithLabelValues(r.Method, route).Observe(float64(wr.Bytes))
 	})
 }
 
-func main() {
-	db, err := gorm.Open(sqlite.Open("app.db"), &gorm.Config{})
+// logRequests assigns every request an ID, which is stored in the request
+// context and returned in the response, and logs the request once it has
+// been served.
+func logRequests(logger *logging.Logger, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := logging.WithRequest(r.Context(), id)
+
+		wr := NewResponseWriterWrapper(w)
+		h.ServeHTTP(wr, r.WithContext(ctx))
+		logger.Info(ctx, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", wr.Status,
+			"bytes", wr.Bytes,
+			"duration_ms", logging.Milliseconds(time.Since(start)),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+func openDB(cfg config.Config, registry prometheus.Registerer) (*gorm.DB, error) {
+	gormLogger := logging.NewGormLogger(logging.Default())
+	db, err := models.Open(cfg.DSN, &gorm.Config{Logger: gormLogger})
 	if err != nil {
+		return nil, err
+	}
+	if err := db.Use(gormLogger); err != nil {
+		return nil, err
+	}
+	if err := db.Use(metrics.NewGormPlugin(registry)); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func main() {
+	cfg, args, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
 		log.Fatal(err)
 	}
 
-	err = models.Migrate(db)
+	// Everything is logged as JSON from here on, including the output of the
+	// standard log package.
+	logger := logging.New(os.Stderr, cfg.LogLevel)
+	logging.SetDefault(logger)
+	log.SetFlags(0)
+	log.SetOutput(logger.Writer(config.LevelInfo))
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	if len(args) > 0 && args[0] == "migrate" {
+		os.Exit(runMigrate(func() (*gorm.DB, error) { return openDB(cfg, registry) }, args[1:]))
+	}
+
+	db, err := openDB(cfg, registry)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Opening the database failed", err)
+	}
+
+	// Pending migrations are applied on start. A newer schema belongs to a
+	// newer version of the program, whose data this one must not touch.
+	err = models.Migrate(db)
+	if errors.Is(err, migrate.ErrSchemaTooNew) {
+		fatal("Refusing to start", err)
+	} else if err != nil {
+		fatal("Migrating the database failed", err)
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "import":
+			os.Exit(runImport(db, args[1:]))
+		case "create-admin":
+			os.Exit(runCreateUser(db, "create-admin", true, args[1:]))
+		case "create-user":
+			os.Exit(runCreateUser(db, "create-user", false, args[1:]))
+		default:
+			fatal("Unknown command", fmt.Errorf("unknown command %q", args[0]))
+		}
+	}
+
+	if cfg.Seed {
+		err = fillInitialData(db)
+		if err != nil {
+			fatal("Seeding the database failed", err)
+		}
 	}
 
-	err = fillInitialData(db)
+	// Templates and static files are built into the binary. In development,
+	// templates are read from disk instead, so that edits show on reload.
+	templates := web.Templates()
+	if cfg.DevTemplates {
+		templates = os.DirFS(cfg.TemplatesDir)
+		logger.Info(context.Background(), "Reloading templates on every request", "dir", cfg.TemplatesDir)
+	}
+	staticHandler, err := handlers.NewStaticHandler(web.Static())
 	if err != nil {
-		log.Fatal(err)
+		fatal("Loading static files failed", err)
 	}
+	renderer, err := handlers.NewHTMLRenderer(templates, staticHandler, cfg.DevTemplates)
+	if err != nil {
+		fatal("Loading templates failed", err)
+	}
+
+	// The server shuts down gracefully on SIGINT and SIGTERM. A second signal
+	// stops it immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	router := mux.NewRouter()
 	router.StrictSlash(true)
@@ -58,15 +250,129 @@ func main() {
 	invRepo := &models.InventoryRepository{
 		DB: db,
 	}
-	renderer := handlers.NewHTMLRenderer("./templates")
+	userRepo := &models.UserRepository{
+		DB: db,
+	}
+	roleRepo := &models.RoleRepository{
+		DB: db,
+	}
+	var jobs sync.WaitGroup
+	jobs.Add(2)
+	go func() {
+		defer jobs.Done()
+		purgeDeletedItems(ctx, itemRepo, cfg.DeletedItemsRetention, purgeInterval)
+	}()
+
+	notifiers := alerts.MultiNotifier{&alerts.LogNotifier{Logger: logger}}
+	if cfg.LowStockWebhookURL != "" {
+		notifiers = append(notifiers, &alerts.WebhookNotifier{
+			URL:    cfg.LowStockWebhookURL,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		})
+	}
+	checker := alerts.NewChecker(itemRepo, notifiers, lowStockCheckInterval)
+	go func() {
+		defer jobs.Done()
+		checker.Run(ctx)
+	}()
+
+	staticHandler.HandleFuncs(router)
 
-	itemHandler := handlers.NewItemHandler(itemRepo, invRepo, renderer)
+	productRepo := &models.ProductRepository{
+		DB: db,
+	}
+	categoryRepo := &models.CategoryRepository{
+		DB: db,
+	}
+	itemHandler := handlers.NewItemHandler(itemRepo, invRepo, productRepo, categoryRepo, renderer)
 	itemHandler.HandleFuncs(router)
 
-	listenAddr := "127.0.0.1:8000"
-	log.Printf("Start listening on %s", listenAddr)
-	err = http.ListenAndServe(listenAddr, logDecorator(router))
+	movementRepo := &models.StockMovementRepository{
+		DB: db,
+	}
+	movementHandler := handlers.NewStockMovementHandler(itemRepo, movementRepo, renderer)
+	movementHandler.HandleFuncs(router)
+
+	auditRepo := &models.AuditRepository{
+		DB: db,
+	}
+	auditHandler := handlers.NewAuditHandler(auditRepo, itemRepo, renderer)
+	auditHandler.HandleFuncs(router)
+
+	invHandler := handlers.NewInventoryHandler(invRepo, roleRepo, userRepo, renderer)
+	invHandler.HandleFuncs(router)
+
+	productHandler := handlers.NewProductHandler(productRepo, renderer)
+	productHandler.HandleFuncs(router)
+
+	categoryHandler := handlers.NewCategoryHandler(categoryRepo, renderer)
+	categoryHandler.HandleFuncs(router)
+
+	metricsHandler := handlers.NewMetricsHandler(registry, invRepo)
+	metricsHandler.HandleFuncs(router)
+
+	healthHandler := handlers.NewHealthHandler(db)
+	healthHandler.HandleFuncs(router)
+
+	itemAPIHandler := handlers.NewItemAPIHandler(itemRepo, invRepo)
+	itemAPIHandler.HandleFuncs(router)
+
+	authHandler := handlers.NewAuthHandler(
+		userRepo,
+		&models.SessionRepository{DB: db},
+		&models.FlashRepository{DB: db},
+		&models.AccessTokenRepository{DB: db},
+		roleRepo, renderer, cfg.SessionTTL, cfg.SecureCookies,
+	)
+	authHandler.HandleFuncs(router)
+
+	csrf := handlers.NewCSRF(cfg.SecureCookies)
+	handler := logRequests(logger, measureRequests(newHTTPMetrics(registry), router,
+		csrf.Middleware(authHandler.Middleware(router))))
+	server := &http.Server{
+		Addr:         cfg.ListenAddr,
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	logger.Info(ctx, "Start listening", "addr", cfg.ListenAddr)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-served:
+		fatal("Serving failed", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// In-flight requests are drained before the database is closed, so that
+	// no write is cut off halfway.
+	logger.Info(context.Background(), "Shutting down", "timeout", cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error(context.Background(), "Draining requests failed", "error", err)
+	}
+	jobs.Wait()
+	if err := closeDB(db); err != nil {
+		logger.Error(context.Background(), "Closing the database failed", "error", err)
+	}
+	logger.Info(context.Background(), "Stopped")
+}
+
+func closeDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	return sqlDB.Close()
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, err error) {
+	logging.Error(context.Background(), msg, "error", err)
+	os.Exit(1)
 }
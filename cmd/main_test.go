@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/handlers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteLabel(t *testing.T) {
+	router := mux.NewRouter()
+	(&handlers.ItemHandler{}).HandleFuncs(router)
+	(&handlers.ItemAPIHandler{}).HandleFuncs(router)
+	router.HandleFunc("/unnamed/{id:[0-9]+}", func(http.ResponseWriter, *http.Request) {})
+
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "/items", "items.list"},
+		{http.MethodPost, "/items/12/edit", "items.edit.post"},
+		{http.MethodPatch, "/api/v1/items/12", "api.items.update"},
+		{http.MethodGet, "/unnamed/12", "/unnamed/{id}"},
+		{http.MethodGet, "/nowhere", "unmatched"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		assert.Equal(t, test.want, routeLabel(router, r), test.path)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `Usage: %[1]s migrate COMMAND
+
+Commands:
+  up                    apply all pending migrations
+  down [-steps N|-all]  revert the most recent migrations, one by default
+  status                list the migrations and whether they are applied
+  create [-dir DIR] NAME
+                        write the skeleton of a new migration
+`
+
+// runMigrate implements the migrate subcommand. The database is opened by
+// openDB only for the commands that need it. The returned value is the exit
+// code.
+func runMigrate(openDB func() (*gorm.DB, error), args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, migrateUsage, os.Args[0])
+		return 2
+	}
+	if args[0] == "create" {
+		return runMigrateCreate(args[1:])
+	}
+
+	fs := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	steps := 1
+	all := false
+	switch args[0] {
+	case "up", "status":
+	case "down":
+		fs.IntVar(&steps, "steps", 1, "number of migrations to revert")
+		fs.BoolVar(&all, "all", false, "revert all migrations")
+	default:
+		fmt.Fprintf(os.Stderr, migrateUsage, os.Args[0])
+		return 2
+	}
+	_ = fs.Parse(args[1:])
+	if fs.NArg() != 0 || steps < 1 {
+		fmt.Fprintf(os.Stderr, migrateUsage, os.Args[0])
+		return 2
+	}
+
+	db, err := openDB()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	migrator := models.NewMigrator(db)
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		printMigrations("applied", applied)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		if all {
+			steps = -1
+		}
+		reverted, err := migrator.Down(steps)
+		printMigrations("reverted", reverted)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			if s.Unknown {
+				state += " (unknown to this program)"
+			}
+			fmt.Printf("%d %-32s %s\n", s.Version, s.Name, state)
+		}
+	}
+	return 0
+}
+
+func printMigrations(action string, migrations []migrate.Migration) {
+	for _, m := range migrations {
+		fmt.Printf("%s %d %s\n", action, m.Version, m.Name)
+	}
+}
+
+var migrationNameRe = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+var migrationTemplate = template.Must(template.New("migration").Parse(`package models
+
+import (
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: {{ .Version }},
+		Name:    "{{ .Name }}",
+		Up: func(tx *gorm.DB) error {
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	})
+}
+`))
+
+// runMigrateCreate writes the skeleton of a new migration into the models
+// package. The version is the current UTC time.
+func runMigrateCreate(args []string) int {
+	fs := flag.NewFlagSet("migrate create", flag.ExitOnError)
+	dir := fs.String("dir", "models", "directory of the models package")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, migrateUsage, os.Args[0])
+		return 2
+	}
+	name := strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(fs.Arg(0)))
+	if !migrationNameRe.MatchString(name) {
+		fmt.Fprintf(os.Stderr, "invalid migration name %q\n", fs.Arg(0))
+		return 2
+	}
+
+	version := time.Now().UTC().Format("20060102150405")
+	path := filepath.Join(*dir, fmt.Sprintf("migration_%s_%s.go", version, name))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	err = migrationTemplate.Execute(file, struct {
+		Version string
+		Name    string
+	}{version, name})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("created", path)
+	return 0
+}
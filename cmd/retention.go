@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/logging"
+	"github.com/shayanh/shopify-challenge-2022/models"
+)
+
+const purgeInterval = time.Hour
+
+// purgeDeletedItems periodically hard-deletes items that have been in the
+// recycle bin for longer than the retention period, until the context is
+// done.
+func purgeDeletedItems(ctx context.Context, itemRepo *models.ItemRepository, retention time.Duration,
+	interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := itemRepo.PurgeDeletedBefore(time.Now().Add(-retention))
+		if err != nil {
+			logging.Error(ctx, "Purging deleted items failed", "error", err)
+		} else if n > 0 {
+			logging.Info(ctx, "Purged deleted items", "count", n, "retention", retention.String())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"golang.org/x/term"
+	"gorm.io/gorm"
+)
+
+// runCreateUser implements the create-admin and create-user subcommands,
+// which create an admin or a user without roles. The password is read from the
+// terminal without echo, or from the first line of the standard input when it
+// is not a terminal. The returned value is the exit code.
+func runCreateUser(db *gorm.DB, command string, admin bool, args []string) int {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s USERNAME\n", os.Args[0], command)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	userRepo := &models.UserRepository{DB: db}
+	user, err := userRepo.Create(fs.Arg(0), password, admin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	kind := "user"
+	if admin {
+		kind = "admin"
+	}
+	fmt.Printf("created %s %q (id=%d)\n", kind, user.Username, user.ID)
+	return 0
+}
+
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	repeated, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(repeated) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return string(password), nil
+}
@@ -0,0 +1,288 @@
+// Package config loads the settings of the server.
+//
+// Settings are read from, in increasing order of precedence, built-in
+// defaults, an optional YAML file, environment variables and command line
+// flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables of the settings.
+const EnvPrefix = "INVENTORY_"
+
+// LogLevel is the minimum level of logged messages.
+type LogLevel string
+
+const (
+	LevelDebug LogLevel = "debug"
+	LevelInfo  LogLevel = "info"
+	LevelWarn  LogLevel = "warn"
+	LevelError LogLevel = "error"
+)
+
+var logLevelOrder = map[LogLevel]int{LevelDebug: 0, LevelInfo: 1, LevelWarn: 2, LevelError: 3}
+
+// Enabled reports whether messages of the given level are logged.
+func (l LogLevel) Enabled(level LogLevel) bool {
+	return logLevelOrder[level] >= logLevelOrder[l]
+}
+
+// Config holds the settings of the server.
+type Config struct {
+	ListenAddr string `yaml:"listen_addr"`
+	DSN        string `yaml:"dsn"`
+	// TemplatesDir is the directory the HTML templates are read from when
+	// DevTemplates is set. Otherwise, the templates built into the binary are
+	// used.
+	TemplatesDir string `yaml:"templates_dir"`
+	// DevTemplates reloads the templates from TemplatesDir on every request,
+	// for working on them without restarting the server.
+	DevTemplates bool `yaml:"dev_templates"`
+	// Seed fills the database with demo data on start.
+	Seed     bool     `yaml:"seed"`
+	LogLevel LogLevel `yaml:"log_level"`
+
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests are waited for on
+	// shutdown.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// SessionTTL is how long a login lasts.
+	SessionTTL time.Duration `yaml:"session_ttl"`
+	// SecureCookies restricts cookies to HTTPS. It should be set whenever the
+	// server is reached over HTTPS.
+	SecureCookies bool `yaml:"secure_cookies"`
+
+	// LowStockWebhookURL is where low stock alerts are posted, if set.
+	LowStockWebhookURL string `yaml:"low_stock_webhook_url"`
+	// DeletedItemsRetention is how long deleted items are kept in the recycle
+	// bin before they are permanently deleted.
+	DeletedItemsRetention time.Duration `yaml:"deleted_items_retention"`
+}
+
+// Default returns the settings used when nothing else is given.
+func Default() Config {
+	return Config{
+		ListenAddr:   "127.0.0.1:8000",
+		DSN:          "sqlite://app.db",
+		TemplatesDir: "./web/templates",
+		Seed:         true,
+		LogLevel:     LevelInfo,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  time.Minute,
+		SessionTTL:   12 * time.Hour,
+
+		ShutdownTimeout: 30 * time.Second,
+
+		DeletedItemsRetention: 30 * 24 * time.Hour,
+	}
+}
+
+// Validate checks that the settings are usable.
+func (c *Config) Validate() error {
+	if c.ListenAddr == "" {
+		return errors.New("listen address cannot be empty")
+	}
+	if c.DSN == "" {
+		return errors.New("dsn cannot be empty")
+	}
+	if c.DevTemplates && c.TemplatesDir == "" {
+		return errors.New("templates directory cannot be empty with dev templates")
+	}
+	if _, ok := logLevelOrder[c.LogLevel]; !ok {
+		return fmt.Errorf("invalid log level %q", c.LogLevel)
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.ShutdownTimeout < 0 {
+		return errors.New("timeouts cannot be negative")
+	}
+	if c.SessionTTL <= 0 {
+		return errors.New("session ttl must be positive")
+	}
+	if c.DeletedItemsRetention <= 0 {
+		return errors.New("deleted items retention must be positive")
+	}
+	return nil
+}
+
+// setting is a single setting that can be given as a flag and as an
+// environment variable. A back-quoted name in usage is the name of the value
+// in the help output.
+type setting struct {
+	flag   string
+	env    string
+	usage  string
+	isBool bool
+	get    func(c *Config) string
+	set    func(c *Config, value string) error
+}
+
+func setDuration(d *time.Duration, value string) error {
+	v, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+var settings = []setting{
+	{flag: "listen", env: "LISTEN_ADDR", usage: "`address` to listen on",
+		get: func(c *Config) string { return c.ListenAddr },
+		set: func(c *Config, v string) error { c.ListenAddr = v; return nil }},
+	{flag: "dsn", env: "DSN", usage: "data source name (`dsn`) of the database",
+		get: func(c *Config) string { return c.DSN },
+		set: func(c *Config, v string) error { c.DSN = v; return nil }},
+	{flag: "templates", env: "TEMPLATES_DIR", usage: "`directory` of the HTML templates, used with -dev-templates",
+		get: func(c *Config) string { return c.TemplatesDir },
+		set: func(c *Config, v string) error { c.TemplatesDir = v; return nil }},
+	{flag: "dev-templates", env: "DEV_TEMPLATES", usage: "reload the templates from disk on every request", isBool: true,
+		get: func(c *Config) string { return strconv.FormatBool(c.DevTemplates) },
+		set: func(c *Config, v string) (err error) { c.DevTemplates, err = strconv.ParseBool(v); return err }},
+	{flag: "seed", env: "SEED", usage: "fill the database with demo data", isBool: true,
+		get: func(c *Config) string { return strconv.FormatBool(c.Seed) },
+		set: func(c *Config, v string) (err error) { c.Seed, err = strconv.ParseBool(v); return err }},
+	{flag: "log-level", env: "LOG_LEVEL", usage: "minimum log `level`: debug, info, warn or error",
+		get: func(c *Config) string { return string(c.LogLevel) },
+		set: func(c *Config, v string) error { c.LogLevel = LogLevel(v); return nil }},
+	{flag: "read-timeout", env: "READ_TIMEOUT", usage: "maximum `duration` of reading a request",
+		get: func(c *Config) string { return c.ReadTimeout.String() },
+		set: func(c *Config, v string) error { return setDuration(&c.ReadTimeout, v) }},
+	{flag: "write-timeout", env: "WRITE_TIMEOUT", usage: "maximum `duration` of writing a response",
+		get: func(c *Config) string { return c.WriteTimeout.String() },
+		set: func(c *Config, v string) error { return setDuration(&c.WriteTimeout, v) }},
+	{flag: "idle-timeout", env: "IDLE_TIMEOUT", usage: "maximum `duration` of an idle keep-alive connection",
+		get: func(c *Config) string { return c.IdleTimeout.String() },
+		set: func(c *Config, v string) error { return setDuration(&c.IdleTimeout, v) }},
+	{flag: "shutdown-timeout", env: "SHUTDOWN_TIMEOUT", usage: "maximum `duration` of waiting for requests on shutdown",
+		get: func(c *Config) string { return c.ShutdownTimeout.String() },
+		set: func(c *Config, v string) error { return setDuration(&c.ShutdownTimeout, v) }},
+	{flag: "session-ttl", env: "SESSION_TTL", usage: "`duration` of a login session",
+		get: func(c *Config) string { return c.SessionTTL.String() },
+		set: func(c *Config, v string) error { return setDuration(&c.SessionTTL, v) }},
+	{flag: "secure-cookies", env: "SECURE_COOKIES", usage: "send cookies over HTTPS only", isBool: true,
+		get: func(c *Config) string { return strconv.FormatBool(c.SecureCookies) },
+		set: func(c *Config, v string) (err error) { c.SecureCookies, err = strconv.ParseBool(v); return err }},
+	{flag: "low-stock-webhook", env: "LOW_STOCK_WEBHOOK_URL", usage: "`URL` to post low stock alerts to",
+		get: func(c *Config) string { return c.LowStockWebhookURL },
+		set: func(c *Config, v string) error { c.LowStockWebhookURL = v; return nil }},
+	{flag: "deleted-items-retention", env: "DELETED_ITEMS_RETENTION",
+		usage: "`duration` deleted items are kept before they are permanently deleted",
+		get:   func(c *Config) string { return c.DeletedItemsRetention.String() },
+		set:   func(c *Config, v string) error { return setDuration(&c.DeletedItemsRetention, v) }},
+}
+
+// flagValue records the value of a flag, so that flags can be applied after
+// the config file and the environment.
+type flagValue struct {
+	value  *string
+	isBool bool
+}
+
+func (f flagValue) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f flagValue) Set(v string) error {
+	*f.value = v
+	return nil
+}
+
+func (f flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// Load builds the settings from the given command line arguments, without
+// the program name, and the environment. It returns the arguments left after
+// the flags. The config file is named by the -config flag or the
+// INVENTORY_CONFIG environment variable.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, []string, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] [import [-dry-run] FILE | migrate COMMAND | create-admin|create-user USERNAME]\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", "", "`path` of a YAML config file (env "+EnvPrefix+"CONFIG)")
+	defaults := Default()
+	values := make(map[string]*string)
+	for _, s := range settings {
+		// The value starts as the default, so that it shows up in the help.
+		v := new(string)
+		*v = s.get(&defaults)
+		values[s.flag] = v
+		fs.Var(flagValue{value: v, isBool: s.isBool}, s.flag,
+			fmt.Sprintf("%s (env %s%s)", s.usage, EnvPrefix, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	cfg := defaults
+	path := *configPath
+	if path == "" {
+		path, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := loadFile(&cfg, path); err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		v, ok := lookupEnv(EnvPrefix + s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(&cfg, v); err != nil {
+			return cfg, nil, fmt.Errorf("invalid %s%s: %w", EnvPrefix, s.env, err)
+		}
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, s := range settings {
+		if !set[s.flag] {
+			continue
+		}
+		if err := s.set(&cfg, *values[s.flag]); err != nil {
+			return cfg, nil, fmt.Errorf("invalid -%s: %w", s.flag, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// loadFile reads the settings of a YAML file over the given config. Unknown
+// keys are rejected so that typos do not go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dec := yaml.NewDecoder(file)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func envFunc(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, args, err := Load([]string{"import", "items.csv"}, envFunc(nil))
+	assert.Nil(t, err)
+	assert.Equal(t, Default(), cfg)
+	assert.Equal(t, []string{"import", "items.csv"}, args)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, `
+listen_addr: 0.0.0.0:9000
+dsn: staging.db
+seed: false
+log_level: warn
+read_timeout: 5s
+`)
+	env := map[string]string{
+		"INVENTORY_CONFIG":                  path,
+		"INVENTORY_DSN":                     "env.db",
+		"INVENTORY_LOG_LEVEL":               "error",
+		"INVENTORY_IDLE_TIMEOUT":            "2m",
+		"INVENTORY_DEV_TEMPLATES":           "true",
+		"INVENTORY_DELETED_ITEMS_RETENTION": "168h",
+	}
+
+	cfg, _, err := Load([]string{"-log-level", "debug", "-seed", "-shutdown-timeout", "10s"}, envFunc(env))
+	assert.Nil(t, err)
+	assert.Equal(t, "0.0.0.0:9000", cfg.ListenAddr)
+	assert.Equal(t, "env.db", cfg.DSN)
+	assert.Equal(t, LevelDebug, cfg.LogLevel)
+	assert.True(t, cfg.Seed)
+	assert.Equal(t, 5*time.Second, cfg.ReadTimeout)
+	assert.Equal(t, 2*time.Minute, cfg.IdleTimeout)
+	assert.Equal(t, 10*time.Second, cfg.ShutdownTimeout)
+	assert.Equal(t, Default().TemplatesDir, cfg.TemplatesDir)
+	assert.True(t, cfg.DevTemplates)
+	assert.Equal(t, 7*24*time.Hour, cfg.DeletedItemsRetention)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	path := writeFile(t, "listen: 0.0.0.0:9000\n")
+	_, _, err := Load([]string{"-config", path}, envFunc(nil))
+	assert.NotNil(t, err, "unknown keys must be rejected")
+
+	_, _, err = Load([]string{"-log-level", "verbose"}, envFunc(nil))
+	assert.NotNil(t, err)
+
+	_, _, err = Load(nil, envFunc(map[string]string{"INVENTORY_READ_TIMEOUT": "5"}))
+	assert.NotNil(t, err)
+
+	_, _, err = Load([]string{"-deleted-items-retention", "0s"}, envFunc(nil))
+	assert.NotNil(t, err)
+
+	_, _, err = Load([]string{"-dev-templates", "-templates", ""}, envFunc(nil))
+	assert.NotNil(t, err)
+
+	_, _, err = Load([]string{"-config", "missing.yaml"}, envFunc(nil))
+	assert.NotNil(t, err)
+}
+
+func TestLogLevel_Enabled(t *testing.T) {
+	assert.True(t, LevelInfo.Enabled(LevelError))
+	assert.True(t, LevelInfo.Enabled(LevelInfo))
+	assert.False(t, LevelInfo.Enabled(LevelDebug))
+	assert.False(t, LevelError.Enabled(LevelWarn))
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"gorm.io/gorm"
+)
+
+// errorWriter writes an error response with the given message and status
+// code. Pages use http.Error and the JSON API writeJSONErrorMessage.
+type errorWriter func(w http.ResponseWriter, message string, code int)
+
+// requireAccess returns the access of the signed in user and writes an error
+// response if there is none.
+func requireAccess(w http.ResponseWriter, r *http.Request, writeError errorWriter) (models.Access, bool) {
+	access, ok := AccessFromContext(r.Context())
+	if !ok {
+		writeError(w, "authentication required", http.StatusUnauthorized)
+	}
+	return access, ok
+}
+
+// findAccessibleItem looks up the item of the request for a user who needs the
+// given role in its inventory and writes the error response if that fails.
+// Items the user cannot see are reported as not found.
+func findAccessibleItem(w http.ResponseWriter, r *http.Request, writeError errorWriter,
+	itemRepo *models.ItemRepository, role models.Role, opts ...models.QueryOption) (models.Item, models.Access, bool) {
+	access, ok := requireAccess(w, r, writeError)
+	if !ok {
+		return models.Item{}, access, false
+	}
+	itemID, err := getParamItemID(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return models.Item{}, access, false
+	}
+
+	item, err := itemRepo.WithContext(r.Context()).FindByID(itemID, append(opts, access.Items(models.RoleViewer))...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, "item not found", http.StatusNotFound)
+		} else {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return item, access, false
+	}
+	if !access.Can(item.InventoryID, role) {
+		writeError(w, models.ErrPermissionDenied.Error(), http.StatusForbidden)
+		return item, access, false
+	}
+	return item, access, true
+}
+
+func equalOptionalInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalTags(a, b []models.Tag) bool {
+	return joinTags(a) == joinTags(b)
+}
+
+func equalOptionalUint(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// checkItemEdit returns models.ErrPermissionDenied unless the access allows
+// changing the stored item into the updated one. Clerks may only change the
+// quantity, any other change needs a manager of the inventories involved.
+func checkItemEdit(access models.Access, current, updated models.Item) error {
+	role := models.RoleClerk
+	if updated.Name != current.Name || updated.Description != current.Description ||
+		updated.InventoryID != current.InventoryID ||
+		!equalOptionalInt(updated.ReorderPoint, current.ReorderPoint) ||
+		!equalOptionalInt(updated.ReorderQuantity, current.ReorderQuantity) ||
+		!equalOptionalUint(updated.ProductID, current.ProductID) ||
+		updated.Options.String() != current.Options.String() ||
+		updated.SKU != current.SKU ||
+		stringValue(updated.Barcode) != stringValue(current.Barcode) ||
+		!equalOptionalUint(updated.CategoryID, current.CategoryID) ||
+		(updated.Tags != nil && !equalTags(updated.Tags, current.Tags)) {
+		role = models.RoleManager
+	}
+	if !access.Can(current.InventoryID, role) || !access.Can(updated.InventoryID, role) {
+		return models.ErrPermissionDenied
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+// AccessTestSuite runs the handlers as a clerk of the School inventory, who
+// cannot see the other inventories.
+type AccessTestSuite struct {
+	suite.Suite
+
+	db       *gorm.DB
+	invRepo  *models.InventoryRepository
+	itemRepo *models.ItemRepository
+	roleRepo *models.RoleRepository
+	renderer *mockedRenderer
+
+	clerk  models.User
+	access models.Access
+
+	initInvs  []models.Inventory
+	initItems []models.Item
+}
+
+func (s *AccessTestSuite) SetupTest() {
+	var err error
+	s.db, err = models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = models.Migrate(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.initInvs, s.initItems, err = fillInitialData(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.invRepo = &models.InventoryRepository{DB: s.db}
+	s.itemRepo = &models.ItemRepository{DB: s.db}
+	s.roleRepo = &models.RoleRepository{DB: s.db}
+	s.clerk, err = (&models.UserRepository{DB: s.db}).Create("clerk", testPassword, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := s.roleRepo.Grant(s.initInvs[0].ID, s.clerk.ID, models.RoleClerk); err != nil {
+		log.Fatal(err)
+	}
+	s.access, err = s.roleRepo.AccessOf(s.clerk)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.renderer = &mockedRenderer{}
+	s.renderer.On("Render", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *AccessTestSuite) TearDownTest() {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// asClerk returns the request as sent by the clerk.
+func (s *AccessTestSuite) asClerk(req *http.Request) *http.Request {
+	return req.WithContext(withAccess(withUser(req.Context(), s.clerk), s.access))
+}
+
+func (s *AccessTestSuite) itemRequest(method, target string, item models.Item, form url.Values) *http.Request {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(item.ID))})
+	return s.asClerk(req)
+}
+
+func (s *AccessTestSuite) itemHandler() *ItemHandler {
+	return NewItemHandler(s.itemRepo, s.invRepo, &models.ProductRepository{DB: s.db},
+		&models.CategoryRepository{DB: s.db}, s.renderer)
+}
+
+func (s *AccessTestSuite) TestListItems() {
+	h := s.itemHandler()
+	w := httptest.NewRecorder()
+	h.ListItems(w, s.asClerk(httptest.NewRequest(http.MethodGet, "/items", nil)))
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	page := s.renderer.Calls[0].Arguments[3].(listItemsPage)
+	s.Equal(int64(2), page.Total)
+	for _, item := range page.Items {
+		s.Equal(s.initInvs[0].ID, item.InventoryID)
+	}
+	s.Require().Equal(1, len(page.Inventories))
+	s.Equal(s.initInvs[0].ID, page.Inventories[0].ID)
+}
+
+func (s *AccessTestSuite) TestSearchAndExportCSV() {
+	h := s.itemHandler()
+	w := httptest.NewRecorder()
+	h.ExportCSV(w, s.asClerk(httptest.NewRequest(http.MethodGet, "/items/csv?q=smartphone", nil)))
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	s.Equal(1, len(lines), "items of other inventories are not exported")
+
+	w = httptest.NewRecorder()
+	movementHandler := NewStockMovementHandler(s.itemRepo, &models.StockMovementRepository{DB: s.db}, s.renderer)
+	movementHandler.ExportCSV(w, s.asClerk(httptest.NewRequest(http.MethodGet, "/movements/csv", nil)))
+	lines = strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	s.Equal(3, len(lines))
+}
+
+func (s *AccessTestSuite) TestHiddenItem() {
+	h := s.itemHandler()
+	phone := s.initItems[3]
+	w := httptest.NewRecorder()
+	h.EditItem(w, s.itemRequest(http.MethodGet, fmt.Sprintf("/items/%d/edit", phone.ID), phone, nil))
+
+	s.Equal(http.StatusNotFound, w.Result().StatusCode)
+}
+
+func (s *AccessTestSuite) TestPostEditItem_QuantityOnly() {
+	h := s.itemHandler()
+	item := s.initItems[0]
+	item.Quantity = 20
+	w := httptest.NewRecorder()
+	h.PostEditItem(w, s.itemRequest(http.MethodPost, fmt.Sprintf("/items/%d/edit", item.ID), item,
+		makeItemPostForm(item)))
+
+	s.Equal(http.StatusFound, w.Result().StatusCode)
+	retItem, err := s.itemRepo.FindByID(item.ID)
+	s.Require().Nil(err)
+	s.Equal(20, retItem.Quantity)
+}
+
+func (s *AccessTestSuite) TestPostEditItem_NameDenied() {
+	h := s.itemHandler()
+	item := s.initItems[0]
+	item.Name = "Pen"
+	w := httptest.NewRecorder()
+	h.PostEditItem(w, s.itemRequest(http.MethodPost, fmt.Sprintf("/items/%d/edit", item.ID), item,
+		makeItemPostForm(item)))
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	page := s.renderer.Calls[0].Arguments[3].(editItemPage)
+	s.ErrorIs(page.Error, models.ErrPermissionDenied)
+	retItem, err := s.itemRepo.FindByID(item.ID)
+	s.Require().Nil(err)
+	s.Equal(s.initItems[0].Name, retItem.Name)
+}
+
+func (s *AccessTestSuite) TestDeleteItem_Denied() {
+	h := s.itemHandler()
+	item := s.initItems[0]
+	w := httptest.NewRecorder()
+	h.DeleteItem(w, s.itemRequest(http.MethodPost, fmt.Sprintf("/items/%d/delete", item.ID), item, nil))
+
+	s.Equal(http.StatusForbidden, w.Result().StatusCode)
+	_, err := s.itemRepo.FindByID(item.ID)
+	s.Nil(err)
+}
+
+func (s *AccessTestSuite) TestAPI() {
+	router := mux.NewRouter()
+	NewItemAPIHandler(s.itemRepo, s.invRepo).HandleFuncs(router)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, s.asClerk(req))
+		return w
+	}
+
+	w := serve(http.MethodGet, "/api/v1/items", "")
+	s.Equal(http.StatusOK, w.Code)
+	var items []apiItem
+	s.Require().Nil(json.NewDecoder(w.Body).Decode(&items))
+	s.Equal(2, len(items))
+
+	w = serve(http.MethodGet, fmt.Sprintf("/api/v1/items/%d", s.initItems[3].ID), "")
+	s.Equal(http.StatusNotFound, w.Code)
+
+	w = serve(http.MethodPatch, fmt.Sprintf("/api/v1/items/%d", s.initItems[0].ID), `{"quantity": 5}`)
+	s.Equal(http.StatusOK, w.Code)
+	w = serve(http.MethodPatch, fmt.Sprintf("/api/v1/items/%d", s.initItems[0].ID), `{"name": "Pen"}`)
+	s.Equal(http.StatusForbidden, w.Code)
+
+	body := fmt.Sprintf(`{"name": "Eraser", "sku": "ERASER", "quantity": 1, "inventory_id": %d}`, s.initInvs[0].ID)
+	w = serve(http.MethodPost, "/api/v1/items", body)
+	s.Equal(http.StatusForbidden, w.Code)
+}
+
+func (s *AccessTestSuite) TestGrantAndRevokeRole() {
+	userRepo := &models.UserRepository{DB: s.db}
+	h := NewInventoryHandler(s.invRepo, s.roleRepo, userRepo, s.renderer)
+	inv := s.initInvs[2]
+	target := fmt.Sprintf("/inventories/%d/roles", inv.ID)
+	newRequest := func(form url.Values) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		return mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(inv.ID))})
+	}
+	form := url.Values{}
+	form.Add("roleUser", strconv.Itoa(int(s.clerk.ID)))
+	form.Add("role", string(models.RoleViewer))
+
+	w := httptest.NewRecorder()
+	h.PostGrantInventoryRole(w, s.asClerk(newRequest(form)))
+	s.Equal(http.StatusNotFound, w.Result().StatusCode, "clerks cannot grant roles")
+
+	w = httptest.NewRecorder()
+	h.PostGrantInventoryRole(w, asAdmin(newRequest(form)))
+	s.Equal(http.StatusFound, w.Result().StatusCode)
+	access, err := s.roleRepo.AccessOf(s.clerk)
+	s.Require().Nil(err)
+	s.True(access.Can(inv.ID, models.RoleViewer))
+
+	w = httptest.NewRecorder()
+	h.PostRevokeInventoryRole(w, asAdmin(newRequest(form)))
+	s.Equal(http.StatusFound, w.Result().StatusCode)
+	access, err = s.roleRepo.AccessOf(s.clerk)
+	s.Require().Nil(err)
+	s.False(access.Can(inv.ID, models.RoleViewer))
+}
+
+func TestAccessTestSuite(t *testing.T) {
+	suite.Run(t, new(AccessTestSuite))
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/logging"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"gorm.io/gorm"
+)
+
+// ItemAPIHandler implements the versioned JSON REST API of Item entity. It
+// shares the repositories and the validation rules with ItemHandler.
+type ItemAPIHandler struct {
+	itemRepo *models.ItemRepository
+	invRepo  *models.InventoryRepository
+}
+
+func NewItemAPIHandler(itemRepo *models.ItemRepository, invRepo *models.InventoryRepository) *ItemAPIHandler {
+	return &ItemAPIHandler{
+		itemRepo: itemRepo,
+		invRepo:  invRepo,
+	}
+}
+
+// apiItem is the JSON representation of an item.
+type apiItem struct {
+	ID            uint   `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Quantity      int    `json:"quantity"`
+	InventoryID   uint   `json:"inventory_id"`
+	InventoryName string `json:"inventory_name,omitempty"`
+	// ReorderPoint and ReorderQuantity are the values set on the item, without
+	// the defaults of the inventory.
+	ReorderPoint    *int      `json:"reorder_point"`
+	ReorderQuantity *int      `json:"reorder_quantity"`
+	LowStock        bool      `json:"low_stock"`
+	Version         uint      `json:"version"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	// ProductID and Options are set for variants of a product.
+	ProductID *uint               `json:"product_id"`
+	Options   models.OptionValues `json:"options,omitempty"`
+	SKU       string              `json:"sku"`
+	Barcode   *string             `json:"barcode"`
+	// CategoryID is the category of the item and Tags are its tag names.
+	CategoryID *uint    `json:"category_id"`
+	Tags       []string `json:"tags"`
+}
+
+func newAPIItem(item models.Item) apiItem {
+	return apiItem{
+		ID:              item.ID,
+		Name:            item.Name,
+		Description:     item.Description,
+		Quantity:        item.Quantity,
+		InventoryID:     item.InventoryID,
+		InventoryName:   item.Inventory.Name,
+		ReorderPoint:    item.ReorderPoint,
+		ReorderQuantity: item.ReorderQuantity,
+		LowStock:        item.LowStock(),
+		ProductID:       item.ProductID,
+		Options:         item.Options,
+		SKU:             item.SKU,
+		Barcode:         item.Barcode,
+		CategoryID:      item.CategoryID,
+		Tags:            models.TagNames(item.Tags),
+		Version:         item.Version,
+		CreatedAt:       item.CreatedAt,
+		UpdatedAt:       item.UpdatedAt,
+	}
+}
+
+// apiItemInput is the request body of create and update calls. Fields are
+// pointers so that a PATCH request can tell missing fields from zero values.
+type apiItemInput struct {
+	Name            *string `json:"name"`
+	Description     *string `json:"description"`
+	Quantity        *int    `json:"quantity"`
+	InventoryID     *uint   `json:"inventory_id"`
+	ReorderPoint    *int    `json:"reorder_point"`
+	ReorderQuantity *int    `json:"reorder_quantity"`
+	// ProductID makes the item a variant of the product, or with 0 no variant.
+	// Options replaces the option values of the variant.
+	ProductID *uint               `json:"product_id"`
+	Options   models.OptionValues `json:"options"`
+	// SKU and Barcode replace the codes of the item, an empty string clears
+	// the barcode.
+	SKU     *string `json:"sku"`
+	Barcode *string `json:"barcode"`
+	// CategoryID moves the item to the category, or with 0 out of any
+	// category. Tags replaces the tags of the item.
+	CategoryID *uint     `json:"category_id"`
+	Tags       *[]string `json:"tags"`
+	// Version is optional on updates. If given, the update fails with 409
+	// Conflict when the item has been changed since that version.
+	Version *uint `json:"version"`
+}
+
+// apply copies the given fields of the input into the item. If partial is
+// false every field except description is required.
+func (in *apiItemInput) apply(item *models.Item, partial bool) error {
+	if !partial && (in.Name == nil || in.SKU == nil || in.Quantity == nil || in.InventoryID == nil) {
+		return errors.New("name, sku, quantity and inventory_id are required")
+	}
+	if in.Name != nil {
+		item.Name = *in.Name
+	}
+	if in.Description != nil {
+		item.Description = *in.Description
+	}
+	if in.Quantity != nil {
+		item.Quantity = *in.Quantity
+	}
+	if in.InventoryID != nil {
+		item.InventoryID = *in.InventoryID
+	}
+	if in.ReorderPoint != nil {
+		if *in.ReorderPoint < 0 {
+			return errors.New("invalid reorder_point")
+		}
+		item.ReorderPoint = in.ReorderPoint
+	}
+	if in.ReorderQuantity != nil {
+		if *in.ReorderQuantity < 0 {
+			return errors.New("invalid reorder_quantity")
+		}
+		item.ReorderQuantity = in.ReorderQuantity
+	}
+	if in.ProductID != nil {
+		item.ProductID = in.ProductID
+		if *in.ProductID == 0 {
+			item.ProductID = nil
+			item.Options = nil
+		}
+	}
+	if in.Options != nil {
+		item.Options = in.Options
+	}
+	if in.SKU != nil {
+		item.SKU = *in.SKU
+	}
+	if in.Barcode != nil {
+		item.Barcode = in.Barcode
+	}
+	if in.CategoryID != nil {
+		item.CategoryID = in.CategoryID
+		if *in.CategoryID == 0 {
+			item.CategoryID = nil
+		}
+	}
+	if in.Tags != nil {
+		tags, err := models.NewTags(*in.Tags)
+		if err != nil {
+			return err
+		}
+		item.Tags = tags
+	}
+	if in.Version != nil {
+		item.Version = *in.Version
+	}
+	return nil
+}
+
+type apiError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Error(context.Background(), "Writing JSON response failed", "error", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiErrorResponse{Error: apiError{Status: status, Message: message}})
+}
+
+// writeJSONErrorMessage is writeJSONError as an errorWriter.
+func writeJSONErrorMessage(w http.ResponseWriter, message string, code int) {
+	writeJSONError(w, code, message)
+}
+
+// writeRepoError writes the JSON error response of a failed repository call.
+func writeRepoError(w http.ResponseWriter, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeJSONError(w, http.StatusNotFound, "item not found")
+	} else if errors.Is(err, models.ErrVersionConflict) || errors.Is(err, models.ErrDuplicateVariant) ||
+		errors.Is(err, models.ErrDuplicateSKU) || errors.Is(err, models.ErrDuplicateBarcode) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+	} else if errors.Is(err, models.ErrInvalidOptions) || errors.Is(err, models.ErrInvalidBarcode) ||
+		errors.Is(err, models.ErrMissingSKU) || errors.Is(err, models.ErrUnknownCategory) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	} else {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func decodeAPIItemInput(r *http.Request) (apiItemInput, error) {
+	var in apiItemInput
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return in, errors.New("invalid request body")
+	}
+	return in, nil
+}
+
+func (h *ItemAPIHandler) findItem(r *http.Request, id uint) (models.Item, error) {
+	return h.itemRepo.WithContext(r.Context()).FindByID(id, models.WithInventory(), models.WithTags())
+}
+
+// ListItems lists the items of the inventories the user can see.
+func (h *ItemAPIHandler) ListItems(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, writeJSONErrorMessage)
+	if !ok {
+		return
+	}
+	items, err := h.itemRepo.WithContext(r.Context()).FindAll(models.WithInventory(), models.WithTags(),
+		access.Items(models.RoleViewer))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := make([]apiItem, 0, len(items))
+	for _, item := range items {
+		res = append(res, newAPIItem(item))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *ItemAPIHandler) GetItem(w http.ResponseWriter, r *http.Request) {
+	item, _, ok := findAccessibleItem(w, r, writeJSONErrorMessage, h.itemRepo, models.RoleViewer, models.WithTags())
+	if !ok {
+		return
+	}
+
+	item, err := h.findItem(r, item.ID)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIItem(item))
+}
+
+// CreateItem creates an item. It needs the manager role in the inventory of
+// the item.
+func (h *ItemAPIHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, writeJSONErrorMessage)
+	if !ok {
+		return
+	}
+	in, err := decodeAPIItemInput(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var item models.Item
+	if err := in.apply(&item, false); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err := validateItem(h.invRepo.WithContext(r.Context()), &item); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if !access.Can(item.InventoryID, models.RoleManager) {
+		writeJSONError(w, http.StatusForbidden, models.ErrPermissionDenied.Error())
+		return
+	}
+
+	item, err = h.itemRepo.WithContext(r.Context()).Create(item)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	item, err = h.findItem(r, item.ID)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newAPIItem(item))
+}
+
+// UpdateItem serves both PUT and PATCH requests. PUT replaces the item and
+// requires every field, PATCH only changes the given fields. Clerks may only
+// change the quantity.
+func (h *ItemAPIHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	item, access, ok := findAccessibleItem(w, r, writeJSONErrorMessage, h.itemRepo, models.RoleClerk, models.WithTags())
+	if !ok {
+		return
+	}
+	itemID, current := item.ID, item
+
+	in, err := decodeAPIItemInput(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.Method == http.MethodPut {
+		item.Description = ""
+		item.ReorderPoint = nil
+		item.ReorderQuantity = nil
+	}
+	if err := in.apply(&item, r.Method == http.MethodPatch); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err := validateItem(h.invRepo.WithContext(r.Context()), &item); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err := checkItemEdit(access, current, item); err != nil {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	item.Inventory = models.Inventory{}
+	_, err = h.itemRepo.WithContext(r.Context()).Update(item)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	item, err = h.findItem(r, itemID)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIItem(item))
+}
+
+func (h *ItemAPIHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	item, _, ok := findAccessibleItem(w, r, writeJSONErrorMessage, h.itemRepo, models.RoleManager, models.WithTags())
+	if !ok {
+		return
+	}
+
+	err := h.itemRepo.WithContext(r.Context()).DeleteByID(item.ID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type apiTransferInput struct {
+	InventoryID uint   `json:"inventory_id"`
+	Quantity    int    `json:"quantity"`
+	Note        string `json:"note"`
+}
+
+type apiTransferResult struct {
+	Source apiItem `json:"source"`
+	Target apiItem `json:"target"`
+}
+
+// TransferItem moves some units of an item to another inventory. The user
+// must be a clerk of both inventories.
+func (h *ItemAPIHandler) TransferItem(w http.ResponseWriter, r *http.Request) {
+	item, access, ok := findAccessibleItem(w, r, writeJSONErrorMessage, h.itemRepo, models.RoleClerk, models.WithTags())
+	if !ok {
+		return
+	}
+
+	var in apiTransferInput
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if !access.Can(in.InventoryID, models.RoleClerk) {
+		writeJSONError(w, http.StatusUnprocessableEntity, "invalid inventory")
+		return
+	}
+	source, target, err := h.itemRepo.WithContext(r.Context()).Transfer(item.ID, in.InventoryID, in.Quantity, in.Note)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusUnprocessableEntity, "invalid inventory")
+		} else if errors.Is(err, models.ErrNegativeStock) || errors.Is(err, models.ErrInvalidMovement) ||
+			errors.Is(err, models.ErrSameInventory) {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		} else {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	source, err = h.findItem(r, source.ID)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	target, err = h.findItem(r, target.ID)
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiTransferResult{Source: newAPIItem(source), Target: newAPIItem(target)})
+}
+
+// HandleFuncs registers related handlers into a given Router under the
+// /api/v1 prefix.
+func (h *ItemAPIHandler) HandleFuncs(router *mux.Router) {
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/items", h.ListItems).Methods(http.MethodGet).Name("api.items.list")
+	api.HandleFunc("/items", h.CreateItem).Methods(http.MethodPost).Name("api.items.create")
+	api.HandleFunc("/items/{id:[0-9]+}", h.GetItem).Methods(http.MethodGet).Name("api.items.get")
+	api.HandleFunc("/items/{id:[0-9]+}", h.UpdateItem).Methods(http.MethodPut, http.MethodPatch).Name("api.items.update")
+	api.HandleFunc("/items/{id:[0-9]+}", h.DeleteItem).Methods(http.MethodDelete).Name("api.items.delete")
+	api.HandleFunc("/items/{id:[0-9]+}/transfer", h.TransferItem).Methods(http.MethodPost).Name("api.items.transfer")
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type ItemAPIHandlerTestSuite struct {
+	suite.Suite
+
+	db       *gorm.DB
+	invRepo  *models.InventoryRepository
+	itemRepo *models.ItemRepository
+
+	router *mux.Router
+
+	initInvs  []models.Inventory
+	initItems []models.Item
+}
+
+func (s *ItemAPIHandlerTestSuite) SetupTest() {
+	var err error
+	s.db, err = models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = models.Migrate(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.initInvs, s.initItems, err = fillInitialData(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.invRepo = &models.InventoryRepository{DB: s.db}
+	s.itemRepo = &models.ItemRepository{DB: s.db}
+	s.router = mux.NewRouter()
+	NewItemAPIHandler(s.itemRepo, s.invRepo).HandleFuncs(s.router)
+}
+
+func (s *ItemAPIHandlerTestSuite) TearDownTest() {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *ItemAPIHandlerTestSuite) serve(method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, asAdmin(req))
+	return w
+}
+
+func (s *ItemAPIHandlerTestSuite) TestListItems() {
+	w := s.serve(http.MethodGet, "/api/v1/items", "")
+	s.Equal(http.StatusOK, w.Code)
+
+	var items []apiItem
+	s.Require().Nil(json.NewDecoder(w.Body).Decode(&items))
+	s.Require().Equal(len(s.initItems), len(items))
+	for i := range s.initItems {
+		s.Equal(s.initItems[i].Name, items[i].Name)
+		s.NotEmpty(items[i].InventoryName)
+	}
+}
+
+func (s *ItemAPIHandlerTestSuite) TestGetItem_NotFound() {
+	w := s.serve(http.MethodGet, "/api/v1/items/100", "")
+	s.Equal(http.StatusNotFound, w.Code)
+
+	var resp apiErrorResponse
+	s.Require().Nil(json.NewDecoder(w.Body).Decode(&resp))
+	s.Equal(http.StatusNotFound, resp.Error.Status)
+	s.NotEmpty(resp.Error.Message)
+}
+
+func (s *ItemAPIHandlerTestSuite) TestCreateItem_Successful() {
+	body := fmt.Sprintf(`{"name": "test", "sku": "TEST", "quantity": 4, "inventory_id": %d}`, s.initInvs[1].ID)
+	w := s.serve(http.MethodPost, "/api/v1/items", body)
+	s.Equal(http.StatusCreated, w.Code)
+
+	var item apiItem
+	s.Require().Nil(json.NewDecoder(w.Body).Decode(&item))
+	s.NotZero(item.ID)
+	s.Equal(s.initInvs[1].Name, item.InventoryName)
+
+	items, err := s.itemRepo.FindAll()
+	s.Require().Nil(err)
+	s.Equal(len(s.initItems)+1, len(items))
+}
+
+func (s *ItemAPIHandlerTestSuite) TestCreateItem_Invalid() {
+	body := fmt.Sprintf(`{"name": "", "quantity": 4, "inventory_id": %d}`, s.initInvs[1].ID)
+	w := s.serve(http.MethodPost, "/api/v1/items", body)
+	s.Equal(http.StatusUnprocessableEntity, w.Code)
+
+	w = s.serve(http.MethodPost, "/api/v1/items", `{"name": "test"}`)
+	s.Equal(http.StatusUnprocessableEntity, w.Code)
+
+	w = s.serve(http.MethodPost, "/api/v1/items", `not json`)
+	s.Equal(http.StatusBadRequest, w.Code)
+}
+
+func (s *ItemAPIHandlerTestSuite) TestPatchItem() {
+	item := s.initItems[0]
+	w := s.serve(http.MethodPatch, fmt.Sprintf("/api/v1/items/%d", item.ID), `{"quantity": 42}`)
+	s.Equal(http.StatusOK, w.Code)
+
+	retItem, err := s.itemRepo.FindByID(item.ID)
+	s.Require().Nil(err)
+	s.Equal(42, retItem.Quantity)
+	s.Equal(item.Name, retItem.Name)
+	s.Equal(item.Description, retItem.Description)
+}
+
+func (s *ItemAPIHandlerTestSuite) TestPatchItem_VersionConflict() {
+	item := s.initItems[0]
+	target := fmt.Sprintf("/api/v1/items/%d", item.ID)
+	body := fmt.Sprintf(`{"quantity": 42, "version": %d}`, item.Version)
+	w := s.serve(http.MethodPatch, target, body)
+	s.Equal(http.StatusOK, w.Code)
+
+	w = s.serve(http.MethodPatch, target, body)
+	s.Equal(http.StatusConflict, w.Code)
+}
+
+func (s *ItemAPIHandlerTestSuite) TestPutItem_MissingFields() {
+	item := s.initItems[0]
+	w := s.serve(http.MethodPut, fmt.Sprintf("/api/v1/items/%d", item.ID), `{"quantity": 42}`)
+	s.Equal(http.StatusUnprocessableEntity, w.Code)
+}
+
+func (s *ItemAPIHandlerTestSuite) TestDeleteItem() {
+	item := s.initItems[0]
+	w := s.serve(http.MethodDelete, fmt.Sprintf("/api/v1/items/%d", item.ID), "")
+	s.Equal(http.StatusNoContent, w.Code)
+
+	w = s.serve(http.MethodDelete, fmt.Sprintf("/api/v1/items/%d", item.ID), "")
+	s.Equal(http.StatusNotFound, w.Code)
+}
+
+func (s *ItemAPIHandlerTestSuite) TestTransferItem() {
+	item := s.initItems[1]
+	body := fmt.Sprintf(`{"inventory_id": %d, "quantity": 5}`, s.initInvs[2].ID)
+	w := s.serve(http.MethodPost, fmt.Sprintf("/api/v1/items/%d/transfer", item.ID), body)
+	s.Equal(http.StatusOK, w.Code)
+
+	var res apiTransferResult
+	s.Require().Nil(json.NewDecoder(w.Body).Decode(&res))
+	s.Equal(item.Quantity-5, res.Source.Quantity)
+	s.Equal(5, res.Target.Quantity)
+	s.Equal(s.initInvs[2].Name, res.Target.InventoryName)
+
+	body = fmt.Sprintf(`{"inventory_id": %d, "quantity": 100}`, s.initInvs[2].ID)
+	w = s.serve(http.MethodPost, fmt.Sprintf("/api/v1/items/%d/transfer", item.ID), body)
+	s.Equal(http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestItemAPIHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(ItemAPIHandlerTestSuite))
+}
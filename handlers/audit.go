@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/models"
+)
+
+// AuditHandler implements web handlers of the audit log.
+type AuditHandler struct {
+	auditRepo *models.AuditRepository
+	itemRepo  *models.ItemRepository
+	renderer  Renderer
+}
+
+func NewAuditHandler(auditRepo *models.AuditRepository, itemRepo *models.ItemRepository,
+	renderer Renderer) *AuditHandler {
+	return &AuditHandler{
+		auditRepo: auditRepo,
+		itemRepo:  itemRepo,
+		renderer:  renderer,
+	}
+}
+
+type auditPage struct {
+	Events      []models.AuditEvent
+	Actions     []models.AuditAction
+	EntityTypes []string
+	// Filter holds the filter parameters as given, for the filter form.
+	Filter  url.Values
+	Total   int64
+	Page    int
+	Pages   int
+	PrevURL string
+	NextURL string
+}
+
+// parseAuditQuery reads the filter and page parameters of the audit log from
+// the given URL query. Dates are given as YYYY-MM-DD and both ends are
+// inclusive.
+func parseAuditQuery(values url.Values) (models.AuditQuery, error) {
+	q := models.AuditQuery{
+		EntityType: values.Get("entity"),
+		Action:     models.AuditAction(values.Get("action")),
+		Actor:      values.Get("actor"),
+	}
+	if q.EntityType != "" && q.EntityType != models.EntityItem && q.EntityType != models.EntityInventory {
+		return q, errors.New("invalid entity")
+	}
+	if q.Action != "" && !validAuditAction(q.Action) {
+		return q, errors.New("invalid action")
+	}
+	if str := values.Get("entity_id"); str != "" {
+		id, err := strconv.ParseUint(str, 10, 0)
+		if err != nil {
+			return q, errors.New("invalid entity_id")
+		}
+		q.EntityID = uint(id)
+	}
+
+	parseDate := func(key string) (*time.Time, error) {
+		str := values.Get(key)
+		if str == "" {
+			return nil, nil
+		}
+		day, err := time.ParseInLocation("2006-01-02", str, time.Local)
+		if err != nil {
+			return nil, errors.New("invalid " + key)
+		}
+		return &day, nil
+	}
+	var err error
+	if q.From, err = parseDate("from"); err != nil {
+		return q, err
+	}
+	if q.To, err = parseDate("to"); err != nil {
+		return q, err
+	}
+	if q.To != nil {
+		end := q.To.AddDate(0, 0, 1)
+		q.To = &end
+	}
+
+	if str := values.Get("page"); str != "" {
+		page, err := strconv.Atoi(str)
+		if err != nil || page < 1 {
+			return q, errors.New("invalid page")
+		}
+		q.Page = page
+	}
+	return q, nil
+}
+
+func validAuditAction(action models.AuditAction) bool {
+	for _, a := range models.AuditActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// auditPageURL returns the URL of the given page of the audit log with the
+// given filter.
+func auditPageURL(filter url.Values, page int) string {
+	values := url.Values{}
+	for key, v := range filter {
+		values[key] = v
+	}
+	values.Del("page")
+	if page > 1 {
+		values.Set("page", strconv.Itoa(page))
+	}
+	if len(values) == 0 {
+		return "/audit"
+	}
+	return "/audit?" + values.Encode()
+}
+
+// ListAuditEvents lists the audit events matching the filter parameters, most
+// recent first, one page at a time. Only the events of the inventories the
+// user can see are listed.
+func (h *AuditHandler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Page == 0 {
+		q.Page = 1
+	}
+
+	events, total, err := h.auditRepo.WithContext(r.Context()).Find(q, access.AuditEvents(models.RoleViewer))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := auditPage{
+		Events:      events,
+		Actions:     models.AuditActions,
+		EntityTypes: []string{models.EntityItem, models.EntityInventory},
+		Filter:      r.URL.Query(),
+		Total:       total,
+		Page:        q.Page,
+		Pages:       int((total + int64(q.Limit()) - 1) / int64(q.Limit())),
+	}
+	if page.Page > 1 {
+		page.PrevURL = auditPageURL(page.Filter, page.Page-1)
+	}
+	if page.Page < page.Pages {
+		page.NextURL = auditPageURL(page.Filter, page.Page+1)
+	}
+	h.renderer.Render(w, r, "audit.html", page)
+}
+
+type itemHistoryPage struct {
+	Item   models.Item
+	Events []models.AuditEvent
+	Total  int64
+}
+
+// ListItemHistory shows the most recent changes of an item.
+func (h *AuditHandler) ListItemHistory(w http.ResponseWriter, r *http.Request) {
+	item, _, ok := findAccessibleItem(w, r, http.Error, h.itemRepo, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	events, total, err := h.auditRepo.WithContext(r.Context()).Find(models.AuditQuery{
+		EntityType: models.EntityItem,
+		EntityID:   item.ID,
+		PageSize:   models.MaxPageSize,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.renderer.Render(w, r, "item_history.html", itemHistoryPage{Item: item, Events: events, Total: total})
+}
+
+// HandleFuncs registers related handlers into a given Router.
+func (h *AuditHandler) HandleFuncs(router *mux.Router) {
+	router.HandleFunc("/audit", h.ListAuditEvents).Methods(http.MethodGet).Name("audit.list")
+	router.HandleFunc("/items/{id:[0-9]+}/history", h.ListItemHistory).Methods(http.MethodGet).Name("items.history")
+}
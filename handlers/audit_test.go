@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/shayanh/shopify-challenge-2022/web"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type AuditHandlerTestSuite struct {
+	suite.Suite
+
+	db       *gorm.DB
+	itemRepo *models.ItemRepository
+
+	h        *AuditHandler
+	renderer *mockedRenderer
+
+	initInvs  []models.Inventory
+	initItems []models.Item
+}
+
+func (s *AuditHandlerTestSuite) SetupTest() {
+	var err error
+	s.db, err = models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = models.Migrate(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.initInvs, s.initItems, err = fillInitialData(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.itemRepo = &models.ItemRepository{DB: s.db}
+	s.renderer = &mockedRenderer{}
+	s.renderer.On("Render", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.h = NewAuditHandler(&models.AuditRepository{DB: s.db}, s.itemRepo, s.renderer)
+}
+
+func (s *AuditHandlerTestSuite) TearDownTest() {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *AuditHandlerTestSuite) listAuditEvents(target string, access models.Access) (*http.Response, auditPage) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req = req.WithContext(withAccess(req.Context(), access))
+	w := httptest.NewRecorder()
+	s.h.ListAuditEvents(w, req)
+	if len(s.renderer.Calls) == 0 {
+		return w.Result(), auditPage{}
+	}
+	return w.Result(), s.renderer.Calls[len(s.renderer.Calls)-1].Arguments[3].(auditPage)
+}
+
+func (s *AuditHandlerTestSuite) TestEditRecordsActor() {
+	user, err := (&models.UserRepository{DB: s.db}).Create("alice", testPassword, true)
+	s.Require().Nil(err)
+	item := s.initItems[0]
+	item.Name = "Pen"
+
+	itemHandler := NewItemHandler(s.itemRepo, &models.InventoryRepository{DB: s.db},
+		&models.ProductRepository{DB: s.db}, &models.CategoryRepository{DB: s.db}, s.renderer)
+	data := makeItemPostForm(item)
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/items/%d/edit", item.ID),
+		strings.NewReader(data.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(item.ID))})
+	req = req.WithContext(withAccess(withUser(req.Context(), user), models.FullAccess))
+	w := httptest.NewRecorder()
+	itemHandler.PostEditItem(w, req)
+	s.Require().Equal(http.StatusFound, w.Result().StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/items/%d/history", item.ID), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(item.ID))})
+	w = httptest.NewRecorder()
+	s.h.ListItemHistory(w, asAdmin(req))
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+
+	page := s.renderer.Calls[0].Arguments[3].(itemHistoryPage)
+	s.Require().Equal(3, len(page.Events), "create, initial stock and rename")
+	latest := page.Events[0]
+	s.Equal(models.AuditUpdate, latest.Action)
+	s.Equal("alice", latest.Actor)
+	changes, err := latest.FieldChanges()
+	s.Require().Nil(err)
+	s.Require().Equal(1, len(changes))
+	s.Equal("name", changes[0].Field)
+	s.Equal(`"Pencil"`, string(changes[0].Old))
+	s.Equal(`"Pen"`, string(changes[0].New))
+}
+
+func (s *AuditHandlerTestSuite) TestListAuditEvents_Filter() {
+	resp, page := s.listAuditEvents("/audit?entity=item&action=create", models.FullAccess)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal(int64(len(s.initItems)), page.Total)
+	for _, event := range page.Events {
+		s.Equal(models.EntityItem, event.EntityType)
+		s.Equal(models.AuditCreate, event.Action)
+	}
+
+	_, page = s.listAuditEvents("/audit?actor=nobody", models.FullAccess)
+	s.Equal(int64(0), page.Total)
+
+	resp, _ = s.listAuditEvents("/audit?action=rename", models.FullAccess)
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp, _ = s.listAuditEvents("/audit?from=yesterday", models.FullAccess)
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (s *AuditHandlerTestSuite) TestListAuditEvents_Access() {
+	school := s.initInvs[0]
+	access := models.Access{Roles: map[uint]models.Role{school.ID: models.RoleViewer}}
+	_, page := s.listAuditEvents("/audit", access)
+
+	// The School inventory, and Pencil and Backpack with their initial stock.
+	s.Equal(int64(5), page.Total)
+	for _, event := range page.Events {
+		s.Equal(school.ID, event.InventoryID)
+	}
+}
+
+func (s *AuditHandlerTestSuite) TestRenderTemplates() {
+	renderer, err := NewHTMLRenderer(web.Templates(), nil, false)
+	s.Require().Nil(err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	events, _, err := (&models.AuditRepository{DB: s.db}).Find(models.AuditQuery{})
+	s.Require().Nil(err)
+
+	w := httptest.NewRecorder()
+	renderer.Render(w, r, "audit.html", auditPage{Events: events, Actions: models.AuditActions})
+	s.Equal(http.StatusOK, w.Code)
+	s.Contains(w.Body.String(), "Pencil")
+
+	w = httptest.NewRecorder()
+	renderer.Render(w, r, "item_history.html", itemHistoryPage{Item: s.initItems[0], Events: events})
+	s.Equal(http.StatusOK, w.Code)
+	s.Contains(w.Body.String(), "&rarr;")
+}
+
+func TestAuditHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditHandlerTestSuite))
+}
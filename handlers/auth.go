@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/logging"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"gorm.io/gorm"
+)
+
+// SessionCookieName is the name of the cookie of the session token.
+const SessionCookieName = "session"
+
+// publicPaths can be requested without signing in, as can the static files.
+var publicPaths = map[string]bool{
+	"/login":   true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	accessContextKey
+	flashesContextKey
+	csrfTokenContextKey
+	statusContextKey
+)
+
+// UserFromContext returns the signed in user of a request that went through
+// the auth middleware.
+func UserFromContext(ctx context.Context) (models.User, bool) {
+	user, ok := ctx.Value(userContextKey).(models.User)
+	return user, ok
+}
+
+// withUser returns a context of the signed in user. Changes made with it are
+// attributed to the user in the audit log.
+func withUser(ctx context.Context, user models.User) context.Context {
+	return context.WithValue(models.WithActor(ctx, user), userContextKey, user)
+}
+
+// AccessFromContext returns the access of the signed in user of a request that
+// went through the auth middleware.
+func AccessFromContext(ctx context.Context) (models.Access, bool) {
+	access, ok := ctx.Value(accessContextKey).(models.Access)
+	return access, ok
+}
+
+func withAccess(ctx context.Context, access models.Access) context.Context {
+	return context.WithValue(ctx, accessContextKey, access)
+}
+
+// AuthHandler implements signing in and out, personal access tokens and the
+// middleware that requires one of them.
+type AuthHandler struct {
+	userRepo    *models.UserRepository
+	sessionRepo *models.SessionRepository
+	flashRepo   *models.FlashRepository
+	tokenRepo   *models.AccessTokenRepository
+	roleRepo    *models.RoleRepository
+	renderer    Renderer
+
+	sessionTTL    time.Duration
+	secureCookies bool
+}
+
+func NewAuthHandler(userRepo *models.UserRepository, sessionRepo *models.SessionRepository,
+	flashRepo *models.FlashRepository, tokenRepo *models.AccessTokenRepository, roleRepo *models.RoleRepository,
+	renderer Renderer, sessionTTL time.Duration, secureCookies bool) *AuthHandler {
+	return &AuthHandler{
+		userRepo:      userRepo,
+		sessionRepo:   sessionRepo,
+		flashRepo:     flashRepo,
+		tokenRepo:     tokenRepo,
+		roleRepo:      roleRepo,
+		renderer:      renderer,
+		sessionTTL:    sessionTTL,
+		secureCookies: secureCookies,
+	}
+}
+
+// authenticate returns the user of the bearer token or, without one, of the
+// session cookie of the request. The ID of the session is empty for bearer
+// tokens.
+func (h *AuthHandler) authenticate(r *http.Request) (user models.User, sessionID string, ok bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == header {
+			return models.User{}, "", false
+		}
+		user, err := h.tokenRepo.WithContext(r.Context()).Authenticate(token)
+		return user, "", err == nil
+	}
+
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return models.User{}, "", false
+	}
+	session, err := h.sessionRepo.WithContext(r.Context()).Find(cookie.Value)
+	return session.User, session.ID, err == nil
+}
+
+// Middleware requires a signed in user for all but the public paths. The user
+// and the access of the user are stored in the request context, as are the
+// flash messages of browser sessions. API clients get a 401 response and
+// browsers are sent to the login page.
+func (h *AuthHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, StaticPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, sessionID, ok := h.authenticate(r)
+		if !ok {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSONError(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			target := r.URL.RequestURI()
+			if r.Method != http.MethodGet {
+				target = "/items"
+			}
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(target), http.StatusFound)
+			return
+		}
+		logging.SetUser(r.Context(), user.Username)
+		access, err := h.roleRepo.WithContext(r.Context()).AccessOf(user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ctx := withAccess(withUser(r.Context(), user), access)
+		if sessionID != "" {
+			f := &flashes{repo: h.flashRepo.WithContext(ctx), sessionID: sessionID}
+			ctx = context.WithValue(ctx, flashesContextKey, f)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// safeRedirect returns the given redirect target if it is a path on this
+// site, and /items otherwise.
+func safeRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/items"
+	}
+	return target
+}
+
+type loginPage struct {
+	Username string
+	Next     string
+	Error    error
+}
+
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	h.renderer.Render(w, r, "login.html", loginPage{Next: r.URL.Query().Get("next")})
+}
+
+func (h *AuthHandler) PostLogin(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	page := loginPage{
+		Username: r.FormValue("username"),
+		Next:     r.FormValue("next"),
+	}
+
+	user, err := h.userRepo.WithContext(r.Context()).Authenticate(page.Username, r.FormValue("password"))
+	if err != nil {
+		page.Error = err
+		h.renderer.Render(w, r, "login.html", page)
+		return
+	}
+
+	if _, err := h.sessionRepo.WithContext(r.Context()).DeleteExpired(); err != nil {
+		logging.Error(r.Context(), "Deleting expired sessions failed", "error", err)
+	}
+	token, session, err := h.sessionRepo.WithContext(r.Context()).Create(user.ID, h.sessionTTL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, safeRedirect(page.Next), http.StatusFound)
+}
+
+func (h *AuthHandler) PostLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		if err := h.sessionRepo.WithContext(r.Context()).Delete(cookie.Value); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+type tokensPage struct {
+	User   models.User
+	Tokens []models.AccessToken
+	// NewToken is the token that has just been created. It is shown only
+	// once.
+	NewToken string
+	Name     string
+	Error    error
+}
+
+func (h *AuthHandler) renderTokensPage(w http.ResponseWriter, r *http.Request, page tokensPage) {
+	tokens, err := h.tokenRepo.WithContext(r.Context()).FindByUserID(page.User.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page.Tokens = tokens
+	h.renderer.Render(w, r, "tokens.html", page)
+}
+
+// requireUser returns the signed in user and writes an error response if
+// there is none.
+func requireUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+	}
+	return user, ok
+}
+
+// ListTokens shows the personal access tokens of the signed in user.
+func (h *AuthHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	h.renderTokensPage(w, r, tokensPage{User: user})
+}
+
+func (h *AuthHandler) PostCreateToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	_ = r.ParseForm()
+	page := tokensPage{User: user, Name: r.FormValue("tokenName")}
+	token, _, err := h.tokenRepo.WithContext(r.Context()).Create(user.ID, page.Name)
+	if err != nil {
+		page.Error = err
+	} else {
+		page.NewToken = token
+		page.Name = ""
+	}
+	h.renderTokensPage(w, r, page)
+}
+
+func (h *AuthHandler) PostDeleteToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	tokenID, err := getParamID(r, "token")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.tokenRepo.WithContext(r.Context()).DeleteByID(user.ID, tokenID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "token not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Token revoked")
+	http.Redirect(w, r, "/tokens", http.StatusFound)
+}
+
+// HandleFuncs registers related handlers into a given Router.
+func (h *AuthHandler) HandleFuncs(router *mux.Router) {
+	router.HandleFunc("/login", h.Login).Methods(http.MethodGet).Name("login")
+	router.HandleFunc("/login", h.PostLogin).Methods(http.MethodPost).Name("login.post")
+	router.HandleFunc("/logout", h.PostLogout).Methods(http.MethodPost).Name("logout")
+	router.HandleFunc("/tokens", h.ListTokens).Methods(http.MethodGet).Name("tokens.list")
+	router.HandleFunc("/tokens", h.PostCreateToken).Methods(http.MethodPost).Name("tokens.create")
+	router.HandleFunc("/tokens/{id:[0-9]+}/delete", h.PostDeleteToken).Methods(http.MethodPost).Name("tokens.delete")
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+const testPassword = "correct horse"
+
+type AuthHandlerTestSuite struct {
+	suite.Suite
+
+	db          *gorm.DB
+	userRepo    *models.UserRepository
+	sessionRepo *models.SessionRepository
+	flashRepo   *models.FlashRepository
+	tokenRepo   *models.AccessTokenRepository
+	roleRepo    *models.RoleRepository
+
+	h        *AuthHandler
+	renderer *mockedRenderer
+
+	user models.User
+}
+
+func (s *AuthHandlerTestSuite) SetupTest() {
+	var err error
+	s.db, err = models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = models.Migrate(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.userRepo = &models.UserRepository{DB: s.db}
+	s.sessionRepo = &models.SessionRepository{DB: s.db}
+	s.flashRepo = &models.FlashRepository{DB: s.db}
+	s.tokenRepo = &models.AccessTokenRepository{DB: s.db}
+	s.roleRepo = &models.RoleRepository{DB: s.db}
+	s.user, err = s.userRepo.Create("alice", testPassword, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.renderer = &mockedRenderer{}
+	s.renderer.On("Render", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.h = NewAuthHandler(s.userRepo, s.sessionRepo, s.flashRepo, s.tokenRepo, s.roleRepo, s.renderer, time.Hour, false)
+}
+
+func (s *AuthHandlerTestSuite) TearDownTest() {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *AuthHandlerTestSuite) postForm(target string, form url.Values, handler http.HandlerFunc) *http.Response {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w.Result()
+}
+
+// serveMiddleware sends the request through the auth middleware to a handler
+// that echoes the signed in user.
+func (s *AuthHandlerTestSuite) serveMiddleware(req *http.Request) *http.Response {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		s.Require().True(ok)
+		_, ok = AccessFromContext(r.Context())
+		s.Require().True(ok)
+		fmt.Fprint(w, user.Username)
+	})
+	w := httptest.NewRecorder()
+	s.h.Middleware(next).ServeHTTP(w, req)
+	return w.Result()
+}
+
+func (s *AuthHandlerTestSuite) TestPostLogin() {
+	form := url.Values{}
+	form.Add("username", "alice")
+	form.Add("password", testPassword)
+	form.Add("next", "/inventories")
+	resp := s.postForm("/login", form, s.h.PostLogin)
+
+	s.Equal(http.StatusFound, resp.StatusCode)
+	s.Equal("/inventories", resp.Header.Get("Location"))
+	cookies := resp.Cookies()
+	s.Require().Len(cookies, 1)
+	s.Equal(SessionCookieName, cookies[0].Name)
+	s.True(cookies[0].HttpOnly)
+
+	session, err := s.sessionRepo.Find(cookies[0].Value)
+	s.Require().Nil(err)
+	s.Equal(s.user.ID, session.UserID)
+}
+
+func (s *AuthHandlerTestSuite) TestPostLogin_WrongPassword() {
+	form := url.Values{}
+	form.Add("username", "alice")
+	form.Add("password", "wrong password")
+	resp := s.postForm("/login", form, s.h.PostLogin)
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Empty(resp.Cookies())
+	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
+	page := s.renderer.Calls[0].Arguments[3].(loginPage)
+	s.ErrorIs(page.Error, models.ErrInvalidCredentials)
+	s.Equal("alice", page.Username)
+}
+
+func (s *AuthHandlerTestSuite) TestPostLogin_UnsafeNext() {
+	form := url.Values{}
+	form.Add("username", "alice")
+	form.Add("password", testPassword)
+	form.Add("next", "//evil.example.com")
+	resp := s.postForm("/login", form, s.h.PostLogin)
+
+	s.Equal(http.StatusFound, resp.StatusCode)
+	s.Equal("/items", resp.Header.Get("Location"))
+}
+
+func (s *AuthHandlerTestSuite) TestMiddleware_RedirectsToLogin() {
+	req := httptest.NewRequest(http.MethodGet, "/items?page=2", nil)
+	resp := s.serveMiddleware(req)
+
+	s.Equal(http.StatusFound, resp.StatusCode)
+	s.Equal("/login?next="+url.QueryEscape("/items?page=2"), resp.Header.Get("Location"))
+}
+
+func (s *AuthHandlerTestSuite) TestMiddleware_APIUnauthorized() {
+	req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	resp := s.serveMiddleware(req)
+
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	s.Equal("Bearer", resp.Header.Get("WWW-Authenticate"))
+}
+
+func (s *AuthHandlerTestSuite) TestMiddleware_Session() {
+	token, _, err := s.sessionRepo.Create(s.user.ID, time.Hour)
+	s.Require().Nil(err)
+
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: token})
+	resp := s.serveMiddleware(req)
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+}
+
+func (s *AuthHandlerTestSuite) TestMiddleware_Flashes() {
+	session, _, err := s.sessionRepo.Create(s.user.ID, time.Hour)
+	s.Require().Nil(err)
+	bearer, _, err := s.tokenRepo.Create(s.user.ID, "ci")
+	s.Require().Nil(err)
+
+	serve := func(req *http.Request, handler http.HandlerFunc) {
+		s.h.Middleware(handler).ServeHTTP(httptest.NewRecorder(), req)
+	}
+	add := func(w http.ResponseWriter, r *http.Request) {
+		addFlash(r, models.FlashSuccess, "Item '%s' deleted", "Pencil")
+	}
+	var got []models.Flash
+	pop := func(w http.ResponseWriter, r *http.Request) {
+		got, err = FlashesOf(r)
+		s.Require().Nil(err)
+	}
+	sessionReq := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: session})
+		return req
+	}
+	bearerReq := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		return req
+	}
+
+	serve(bearerReq(), add)
+	serve(sessionReq(), add)
+	serve(bearerReq(), pop)
+	s.Empty(got, "requests with access tokens have no flashes")
+	serve(sessionReq(), pop)
+	if s.Equal(1, len(got)) {
+		s.Equal("Item 'Pencil' deleted", got[0].Message)
+	}
+	serve(sessionReq(), pop)
+	s.Empty(got)
+}
+
+func (s *AuthHandlerTestSuite) TestMiddleware_BearerToken() {
+	token, _, err := s.tokenRepo.Create(s.user.ID, "ci")
+	s.Require().Nil(err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp := s.serveMiddleware(req)
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	resp = s.serveMiddleware(req)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
+
+func (s *AuthHandlerTestSuite) TestPostLogout() {
+	token, _, err := s.sessionRepo.Create(s.user.ID, time.Hour)
+	s.Require().Nil(err)
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: token})
+	w := httptest.NewRecorder()
+	s.h.PostLogout(w, req)
+
+	s.Equal(http.StatusFound, w.Result().StatusCode)
+	_, err = s.sessionRepo.Find(token)
+	s.ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
+func (s *AuthHandlerTestSuite) TestCreateAndDeleteToken() {
+	form := url.Values{}
+	form.Add("tokenName", "ci")
+	req := httptest.NewRequest(http.MethodPost, "/tokens", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(withUser(req.Context(), s.user))
+	w := httptest.NewRecorder()
+	s.h.PostCreateToken(w, req)
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
+	page := s.renderer.Calls[0].Arguments[3].(tokensPage)
+	s.Nil(page.Error)
+	s.True(strings.HasPrefix(page.NewToken, models.AccessTokenPrefix))
+	s.Require().Len(page.Tokens, 1)
+
+	tokenID := page.Tokens[0].ID
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/tokens/%d/delete", tokenID), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(tokenID))})
+	req = req.WithContext(withUser(req.Context(), s.user))
+	w = httptest.NewRecorder()
+	s.h.PostDeleteToken(w, req)
+
+	s.Equal(http.StatusFound, w.Result().StatusCode)
+	_, err := s.tokenRepo.Authenticate(page.NewToken)
+	s.NotNil(err)
+}
+
+func (s *AuthHandlerTestSuite) TestDeleteToken_OtherUser() {
+	other, err := s.userRepo.Create("bob", testPassword, false)
+	s.Require().Nil(err)
+	_, token, err := s.tokenRepo.Create(other.ID, "ci")
+	s.Require().Nil(err)
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/tokens/%d/delete", token.ID), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(token.ID))})
+	req = req.WithContext(withUser(req.Context(), s.user))
+	w := httptest.NewRecorder()
+	s.h.PostDeleteToken(w, req)
+
+	s.Equal(http.StatusNotFound, w.Result().StatusCode)
+}
+
+func TestAuthHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(AuthHandlerTestSuite))
+}
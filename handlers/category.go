@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"gorm.io/gorm"
+)
+
+// CategoryHandler implements web handlers related to Category entity and the
+// category report.
+type CategoryHandler struct {
+	categoryRepo *models.CategoryRepository
+	renderer     Renderer
+}
+
+func NewCategoryHandler(categoryRepo *models.CategoryRepository, renderer Renderer) *CategoryHandler {
+	return &CategoryHandler{
+		categoryRepo: categoryRepo,
+		renderer:     renderer,
+	}
+}
+
+type listCategoriesPage struct {
+	Report models.CategoryReport
+	// CanEdit is set for users who manage at least one inventory.
+	CanEdit bool
+	// Name and ParentID hold the values of a rejected create form.
+	Name     string
+	ParentID uint
+	Error    error
+}
+
+// ListCategories shows the category tree with the number of items and units
+// of every category, rolled up through the tree. Only the items of the
+// inventories the user can see are counted.
+func (h *CategoryHandler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	h.renderCategories(w, r, access, listCategoriesPage{})
+}
+
+func (h *CategoryHandler) renderCategories(w http.ResponseWriter, r *http.Request, access models.Access,
+	page listCategoriesPage) {
+	report, err := h.categoryRepo.WithContext(r.Context()).Report(access.Items(models.RoleViewer))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page.Report = report
+	page.CanEdit = access.CanAny(models.RoleManager)
+	h.renderer.Render(w, r, "categories.html", page)
+}
+
+// requireCategoryEditor writes an error response unless the signed in user
+// manages at least one inventory. Categories are shared by all inventories.
+func requireCategoryEditor(w http.ResponseWriter, r *http.Request) (models.Access, bool) {
+	access, ok := requireAccess(w, r, http.Error)
+	if ok && !access.CanAny(models.RoleManager) {
+		http.Error(w, models.ErrPermissionDenied.Error(), http.StatusForbidden)
+		return access, false
+	}
+	return access, ok
+}
+
+func (h *CategoryHandler) PostCreateCategory(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireCategoryEditor(w, r)
+	if !ok {
+		return
+	}
+
+	_ = r.ParseForm()
+	page := listCategoriesPage{Name: r.FormValue("categoryName")}
+	category := models.Category{Name: page.Name}
+	if str := r.FormValue("categoryParent"); str != "" {
+		parentID, err := strconv.ParseUint(str, 10, 0)
+		if err != nil {
+			page.Error = errors.New("invalid parent category")
+			h.renderCategories(w, r, access, page)
+			return
+		}
+		page.ParentID = uint(parentID)
+		category.ParentID = &page.ParentID
+	}
+
+	if _, err := h.categoryRepo.WithContext(r.Context()).Create(category); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = errors.New("parent category not found")
+		}
+		page.Error = err
+		h.renderCategories(w, r, access, page)
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Category '%s' created", category.Name)
+	http.Redirect(w, r, "/categories", http.StatusFound)
+}
+
+// PostDeleteCategory deletes a category without subcategories and items.
+func (h *CategoryHandler) PostDeleteCategory(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireCategoryEditor(w, r)
+	if !ok {
+		return
+	}
+	id, err := getParamID(r, "category")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.categoryRepo.WithContext(r.Context()).DeleteByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		h.renderCategories(w, r, access, listCategoriesPage{Error: err})
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Category deleted")
+	http.Redirect(w, r, "/categories", http.StatusFound)
+}
+
+// HandleFuncs registers related handlers into a given Router.
+func (h *CategoryHandler) HandleFuncs(router *mux.Router) {
+	router.HandleFunc("/categories", h.ListCategories).Methods(http.MethodGet).Name("categories.list")
+	router.HandleFunc("/categories/create", h.PostCreateCategory).Methods(http.MethodPost).Name("categories.create")
+	router.HandleFunc("/categories/{id:[0-9]+}/delete", h.PostDeleteCategory).Methods(http.MethodPost).Name("categories.delete")
+}
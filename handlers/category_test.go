@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/shayanh/shopify-challenge-2022/web"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type CategoryHandlerTestSuite struct {
+	suite.Suite
+
+	db           *gorm.DB
+	categoryRepo *models.CategoryRepository
+
+	h        *CategoryHandler
+	renderer *mockedRenderer
+
+	initInvs  []models.Inventory
+	initItems []models.Item
+}
+
+func (s *CategoryHandlerTestSuite) SetupTest() {
+	var err error
+	s.db, err = models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = models.Migrate(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.initInvs, s.initItems, err = fillInitialData(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.categoryRepo = &models.CategoryRepository{DB: s.db}
+	s.renderer = &mockedRenderer{}
+	s.renderer.On("Render", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.h = NewCategoryHandler(s.categoryRepo, s.renderer)
+}
+
+func (s *CategoryHandlerTestSuite) TearDownTest() {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *CategoryHandlerTestSuite) postCreateCategory(name, parent string, access models.Access) *http.Response {
+	form := url.Values{}
+	form.Add("categoryName", name)
+	form.Add("categoryParent", parent)
+	req := httptest.NewRequest(http.MethodPost, "/categories/create", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(withAccess(req.Context(), access))
+	w := httptest.NewRecorder()
+	s.h.PostCreateCategory(w, req)
+	return w.Result()
+}
+
+func (s *CategoryHandlerTestSuite) TestPostCreateCategory() {
+	resp := s.postCreateCategory("Kitchen", "", models.FullAccess)
+	s.Equal(http.StatusFound, resp.StatusCode)
+	categories, err := s.categoryRepo.FindAll()
+	s.Require().Nil(err)
+	s.Require().Equal(1, len(categories))
+
+	parent := strconv.Itoa(int(categories[0].ID))
+	resp = s.postCreateCategory("Cups", parent, models.FullAccess)
+	s.Equal(http.StatusFound, resp.StatusCode)
+
+	resp = s.postCreateCategory("Cups", parent, models.FullAccess)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	page := s.renderer.Calls[0].Arguments[3].(listCategoriesPage)
+	s.ErrorIs(page.Error, models.ErrDuplicateCategory)
+	s.Equal("Cups", page.Name)
+	s.Equal(categories[0].ID, page.ParentID)
+	s.Equal(2, len(page.Report.Nodes))
+}
+
+func (s *CategoryHandlerTestSuite) TestPostCreateCategory_Forbidden() {
+	access := models.Access{Roles: map[uint]models.Role{s.initInvs[0].ID: models.RoleClerk}}
+	resp := s.postCreateCategory("Kitchen", "", access)
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+}
+
+func (s *CategoryHandlerTestSuite) TestListCategories_VisibleItemsOnly() {
+	category, err := s.categoryRepo.Create(models.Category{Name: "Office"})
+	s.Require().Nil(err)
+	itemRepo := &models.ItemRepository{DB: s.db}
+	for _, item := range s.initItems {
+		item.CategoryID = &category.ID
+		_, err := itemRepo.Update(item)
+		s.Require().Nil(err)
+	}
+
+	access := models.Access{Roles: map[uint]models.Role{s.initItems[0].InventoryID: models.RoleViewer}}
+	req := httptest.NewRequest(http.MethodGet, "/categories", nil)
+	req = req.WithContext(withAccess(req.Context(), access))
+	s.h.ListCategories(httptest.NewRecorder(), req)
+
+	page := s.renderer.Calls[0].Arguments[3].(listCategoriesPage)
+	s.False(page.CanEdit)
+	s.Require().Equal(1, len(page.Report.Nodes))
+	s.Equal(int64(2), page.Report.Nodes[0].TotalItems)
+	s.Equal(int64(19), page.Report.Nodes[0].TotalQuantity)
+	s.Equal(int64(0), page.Report.UncategorizedItems)
+}
+
+func (s *CategoryHandlerTestSuite) TestPostDeleteCategory() {
+	category, err := s.categoryRepo.Create(models.Category{Name: "Office"})
+	s.Require().Nil(err)
+	item := s.initItems[0]
+	item.CategoryID = &category.ID
+	_, err = (&models.ItemRepository{DB: s.db}).Update(item)
+	s.Require().Nil(err)
+
+	path := "/categories/" + strconv.Itoa(int(category.ID)) + "/delete"
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	req = mux.SetURLVars(asAdmin(req), map[string]string{"id": strconv.Itoa(int(category.ID))})
+	w := httptest.NewRecorder()
+	s.h.PostDeleteCategory(w, req)
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	page := s.renderer.Calls[0].Arguments[3].(listCategoriesPage)
+	s.ErrorIs(page.Error, models.ErrCategoryNotEmpty)
+
+	req = httptest.NewRequest(http.MethodPost, "/categories/1000/delete", nil)
+	req = mux.SetURLVars(asAdmin(req), map[string]string{"id": "1000"})
+	w = httptest.NewRecorder()
+	s.h.PostDeleteCategory(w, req)
+	s.Equal(http.StatusNotFound, w.Result().StatusCode)
+}
+
+func (s *CategoryHandlerTestSuite) TestRenderTemplates() {
+	renderer, err := NewHTMLRenderer(web.Templates(), nil, false)
+	s.Require().Nil(err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	category, err := s.categoryRepo.Create(models.Category{Name: "Office"})
+	s.Require().Nil(err)
+	report, err := s.categoryRepo.Report()
+	s.Require().Nil(err)
+
+	w := httptest.NewRecorder()
+	renderer.Render(w, r, "categories.html", listCategoriesPage{Report: report, CanEdit: true})
+	s.Equal(http.StatusOK, w.Code)
+	s.Contains(w.Body.String(), "/items?category="+strconv.Itoa(int(category.ID)))
+	s.Contains(w.Body.String(), "Uncategorized")
+
+	tree, err := s.categoryRepo.Tree()
+	s.Require().Nil(err)
+	w = httptest.NewRecorder()
+	item := models.Item{Name: "Stapler", SKU: "STAPLER", CategoryID: &category.ID, Tags: []models.Tag{{Name: "desk"}}}
+	renderer.Render(w, r, "list.html", listItemsPage{
+		Items:          []models.Item{item},
+		Groups:         groupItems([]models.Item{item}),
+		Categories:     tree,
+		CategoryFacets: []facetLink{{Label: "Office", Count: 1, URL: "/items?category=1", Active: true}},
+	})
+	s.Equal(http.StatusOK, w.Code)
+	s.Contains(w.Body.String(), "desk")
+}
+
+func TestCategoryHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(CategoryHandlerTestSuite))
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+const (
+	// CSRFFieldName is the name of the form field of the CSRF token.
+	CSRFFieldName = "csrf_token"
+	// CSRFHeaderName is the header that carries the CSRF token of requests
+	// without a form, such as JSON API calls made by a signed in browser.
+	CSRFHeaderName = "X-CSRF-Token"
+	// csrfCookieName is the name of the cookie that keys the CSRF token of
+	// browsers without a session, which is what the login form needs.
+	csrfCookieName = "csrf"
+	// maxFormSize is the maximum accepted size of a posted form, except for
+	// the uploads to importPath.
+	maxFormSize = 1 << 20
+)
+
+// CSRF protects state-changing requests against cross-site request forgery.
+// Every browser session has its own token, which is derived from the session
+// cookie, and requests with unsafe methods must send it back in the
+// CSRFFieldName form field or the CSRFHeaderName header.
+type CSRF struct {
+	secureCookies bool
+}
+
+func NewCSRF(secureCookies bool) *CSRF {
+	return &CSRF{secureCookies: secureCookies}
+}
+
+// csrfToken derives the CSRF token of the given session key.
+func csrfToken(key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte("csrf"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// safeMethods do not change state and are not checked.
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// sessionKey returns the secret that the CSRF token of the request is derived
+// from: the session cookie, or without one the csrf cookie, which is set if
+// it is missing too.
+func (c *CSRF) sessionKey(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(SessionCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	if cookie, err := r.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    key,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   c.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return key, nil
+}
+
+// maxBodySize returns the maximum size of the body of the given request that
+// is read to find the CSRF token.
+func maxBodySize(r *http.Request) int64 {
+	if r.URL.Path == importPath {
+		return maxImportSize
+	}
+	return maxFormSize
+}
+
+// Middleware rejects requests with unsafe methods that do not carry the CSRF
+// token of the session with 403 Forbidden. Requests authenticated with a
+// bearer token are not checked, since browsers never send one on their own.
+// The token is handed to the HTMLRenderer through the request context.
+func (c *CSRF) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := c.sessionKey(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		token := csrfToken(key)
+
+		bearer := strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !safeMethods[r.Method] && !bearer {
+			got := r.Header.Get(CSRFHeaderName)
+			if got == "" {
+				size := maxBodySize(r)
+				r.Body = http.MaxBytesReader(w, r.Body, size)
+				if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+					_ = r.ParseMultipartForm(size)
+				}
+				got = r.PostFormValue(CSRFFieldName)
+			}
+			if !hmac.Equal([]byte(got), []byte(token)) {
+				http.Error(w, "invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(withCSRFToken(r.Context(), token)))
+	})
+}
+
+func withCSRFToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, csrfTokenContextKey, token)
+}
+
+// CSRFTokenOf returns the CSRF token of the given request, if it went through
+// the CSRF middleware.
+func CSRFTokenOf(r *http.Request) (string, bool) {
+	token, ok := r.Context().Value(csrfTokenContextKey).(string)
+	return token, ok
+}
+
+// csrfField returns the hidden form field of the given CSRF token. Templates
+// add it to every form that posts with {{ csrfField }}.
+func csrfField(token string) template.HTML {
+	if token == "" {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + CSRFFieldName + `" value="` +
+		template.HTMLEscapeString(token) + `">`)
+}
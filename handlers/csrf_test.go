@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/shayanh/shopify-challenge-2022/web"
+	"github.com/stretchr/testify/suite"
+)
+
+type CSRFTestSuite struct {
+	suite.Suite
+
+	h *CSRF
+	// served is set when a request reaches the protected handler.
+	served bool
+	token  string
+}
+
+func (s *CSRFTestSuite) SetupTest() {
+	s.h = NewCSRF(false)
+	s.served = false
+	s.token = ""
+}
+
+func (s *CSRFTestSuite) serve(req *http.Request) *http.Response {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.served = true
+		s.token, _ = CSRFTokenOf(r)
+	})
+	w := httptest.NewRecorder()
+	s.h.Middleware(next).ServeHTTP(w, req)
+	return w.Result()
+}
+
+func (s *CSRFTestSuite) postForm(form url.Values, cookies ...*http.Cookie) *http.Response {
+	req := httptest.NewRequest(http.MethodPost, "/items/1/delete", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return s.serve(req)
+}
+
+func (s *CSRFTestSuite) sessionCookie() *http.Cookie {
+	return &http.Cookie{Name: SessionCookieName, Value: "session token"}
+}
+
+func (s *CSRFTestSuite) TestGetIssuesCookie() {
+	resp := s.serve(httptest.NewRequest(http.MethodGet, "/login", nil))
+
+	s.True(s.served)
+	s.NotEmpty(s.token)
+	cookies := resp.Cookies()
+	s.Require().Len(cookies, 1)
+	s.Equal(csrfCookieName, cookies[0].Name)
+	s.Equal(csrfToken(cookies[0].Value), s.token)
+}
+
+func (s *CSRFTestSuite) TestGetWithSession() {
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.AddCookie(s.sessionCookie())
+	resp := s.serve(req)
+
+	s.True(s.served)
+	s.Empty(resp.Cookies(), "sessions key the token themselves")
+	s.Equal(csrfToken(s.sessionCookie().Value), s.token)
+}
+
+func (s *CSRFTestSuite) TestPostAccepted() {
+	form := url.Values{}
+	form.Add(CSRFFieldName, csrfToken(s.sessionCookie().Value))
+	resp := s.postForm(form, s.sessionCookie())
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.True(s.served)
+}
+
+func (s *CSRFTestSuite) TestPostHeaderAccepted() {
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/items/1", nil)
+	req.AddCookie(s.sessionCookie())
+	req.Header.Set(CSRFHeaderName, csrfToken(s.sessionCookie().Value))
+	resp := s.serve(req)
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.True(s.served)
+}
+
+func (s *CSRFTestSuite) TestPostLoginAccepted() {
+	cookie := &http.Cookie{Name: csrfCookieName, Value: "pre-session key"}
+	form := url.Values{}
+	form.Add(CSRFFieldName, csrfToken(cookie.Value))
+	resp := s.postForm(form, cookie)
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.True(s.served)
+}
+
+func (s *CSRFTestSuite) TestPostMultipartAccepted() {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	s.Require().Nil(mw.WriteField(CSRFFieldName, csrfToken(s.sessionCookie().Value)))
+	fw, err := mw.CreateFormFile("file", "items.csv")
+	s.Require().Nil(err)
+	_, err = fw.Write([]byte("name,inventory,qty\n"))
+	s.Require().Nil(err)
+	s.Require().Nil(mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/items/csv", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.AddCookie(s.sessionCookie())
+	resp := s.serve(req)
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.True(s.served)
+}
+
+func (s *CSRFTestSuite) TestPostMissingToken() {
+	resp := s.postForm(url.Values{}, s.sessionCookie())
+
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+	s.False(s.served)
+}
+
+func (s *CSRFTestSuite) TestPostWrongToken() {
+	form := url.Values{}
+	form.Add(CSRFFieldName, csrfToken("another session"))
+	resp := s.postForm(form, s.sessionCookie())
+
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+	s.False(s.served)
+}
+
+func (s *CSRFTestSuite) TestPostWithoutCookie() {
+	// A forged request from another site that guessed a token of its own
+	// still fails, since the browser does not send a matching cookie.
+	form := url.Values{}
+	form.Add(CSRFFieldName, csrfToken("attacker key"))
+	resp := s.postForm(form)
+
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+	s.False(s.served)
+}
+
+func (s *CSRFTestSuite) TestBearerTokenSkipsCheck() {
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/items/1", nil)
+	req.Header.Set("Authorization", "Bearer pat_token")
+	resp := s.serve(req)
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.True(s.served)
+}
+
+func (s *CSRFTestSuite) TestPostTooLarge() {
+	form := url.Values{}
+	form.Add("itemDescription", strings.Repeat("x", maxFormSize))
+	form.Add(CSRFFieldName, csrfToken(s.sessionCookie().Value))
+	resp := s.postForm(form, s.sessionCookie())
+
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+	s.False(s.served)
+}
+
+func (s *CSRFTestSuite) TestRendererAddsField() {
+	renderer, err := NewHTMLRenderer(web.Templates(), nil, false)
+	s.Require().Nil(err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/login", nil)
+	renderer.Render(w, r.WithContext(withCSRFToken(r.Context(), "t0ken")), "login.html", loginPage{})
+
+	s.Equal(http.StatusOK, w.Code)
+	field := `<input type="hidden" name="csrf_token" value="t0ken">`
+	s.Contains(w.Body.String(), field)
+	// The login page has the login form and no other posting form.
+	s.Equal(1, strings.Count(w.Body.String(), field))
+}
+
+func (s *CSRFTestSuite) TestTemplatesHaveField() {
+	postForm := regexp.MustCompile(`(?i)<form\b[^>]*\bmethod="post"[^>]*>\s*(\{\{ csrfField \}\})?`)
+	err := fs.WalkDir(web.Templates(), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(web.Templates(), name)
+		if err != nil {
+			return err
+		}
+		for _, m := range postForm.FindAllSubmatch(b, -1) {
+			s.NotEmpty(m[1], "%s: %s does not start with {{ csrfField }}", name, m[0])
+		}
+		return nil
+	})
+	s.Nil(err)
+}
+
+func TestCSRFTestSuite(t *testing.T) {
+	suite.Run(t, new(CSRFTestSuite))
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/shayanh/shopify-challenge-2022/logging"
+	"github.com/shayanh/shopify-challenge-2022/models"
+)
+
+// flashes are the flash messages of the browser session of a request. The
+// auth middleware puts them in the request context, for handlers to add
+// messages and for the HTMLRenderer to show them.
+type flashes struct {
+	repo      *models.FlashRepository
+	sessionID string
+}
+
+// addFlash adds a flash message, which is shown on the next page the browser
+// session of the request loads. It is dropped for requests without a session,
+// such as API calls.
+func addFlash(r *http.Request, kind models.FlashKind, format string, args ...interface{}) {
+	f, ok := r.Context().Value(flashesContextKey).(*flashes)
+	if !ok {
+		return
+	}
+	if err := f.repo.Add(f.sessionID, kind, fmt.Sprintf(format, args...)); err != nil {
+		logging.Error(r.Context(), "Adding flash message failed", "error", err)
+	}
+}
+
+// FlashesOf returns the flash messages of the session of the given request
+// and removes them from the session. Requests without a session have none.
+func FlashesOf(r *http.Request) ([]models.Flash, error) {
+	f, ok := r.Context().Value(flashesContextKey).(*flashes)
+	if !ok {
+		return nil, nil
+	}
+	return f.repo.Pop(f.sessionID)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/logging"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"gorm.io/gorm"
+)
+
+// readyTimeout bounds the checks of the readiness probe.
+const readyTimeout = 2 * time.Second
+
+// HealthHandler implements the liveness and readiness probes of the server.
+// Both can be requested without signing in.
+type HealthHandler struct {
+	db *gorm.DB
+}
+
+func NewHealthHandler(db *gorm.DB) *HealthHandler {
+	return &HealthHandler{db: db}
+}
+
+// Healthz tells that the process is alive and serving requests.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// Readyz tells whether the server can handle requests, which needs a
+// reachable database with a current schema. It responds with 503 otherwise,
+// and the reason is only logged since the probe is public.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	if err := models.Ready(ctx, h.db); err != nil {
+		logging.Warn(r.Context(), "Readiness check failed", "error", err)
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// HandleFuncs registers related handlers into a given Router.
+func (h *HealthHandler) HandleFuncs(router *mux.Router) {
+	router.HandleFunc("/healthz", h.Healthz).Methods(http.MethodGet).Name("healthz")
+	router.HandleFunc("/readyz", h.Readyz).Methods(http.MethodGet).Name("readyz")
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type HealthHandlerTestSuite struct {
+	suite.Suite
+
+	db *gorm.DB
+	h  *HealthHandler
+}
+
+func (s *HealthHandlerTestSuite) SetupTest() {
+	var err error
+	s.db, err = models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.h = NewHealthHandler(s.db)
+}
+
+func (s *HealthHandlerTestSuite) TearDownTest() {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	_ = sqlDB.Close()
+}
+
+func (s *HealthHandlerTestSuite) readyz() *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.h.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return w
+}
+
+func (s *HealthHandlerTestSuite) TestHealthz() {
+	w := httptest.NewRecorder()
+	s.h.Healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	s.Equal(http.StatusOK, w.Code)
+}
+
+func (s *HealthHandlerTestSuite) TestReadyz() {
+	w := s.readyz()
+	s.Equal(http.StatusServiceUnavailable, w.Code, "migrations are pending")
+	s.Equal("not ready\n", w.Body.String())
+
+	s.Require().Nil(models.Migrate(s.db))
+	s.Equal(http.StatusOK, s.readyz().Code)
+
+	sqlDB, err := s.db.DB()
+	s.Require().Nil(err)
+	s.Require().Nil(sqlDB.Close())
+	w = s.readyz()
+	s.Equal(http.StatusServiceUnavailable, w.Code)
+	s.Equal("not ready\n", w.Body.String())
+}
+
+func (s *HealthHandlerTestSuite) TestMiddleware_Public() {
+	auth := NewAuthHandler(nil, nil, nil, nil, nil, nil, 0, false)
+	handler := auth.Middleware(http.HandlerFunc(s.h.Healthz))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	s.Equal(http.StatusOK, w.Code)
+}
+
+func TestHealthHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthHandlerTestSuite))
+}
@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"go.uber.org/multierr"
+	"gorm.io/gorm"
+)
+
+// InventoryHandler implements web handlers related to Inventory entity and the
+// roles granted in inventories.
+type InventoryHandler struct {
+	invRepo  *models.InventoryRepository
+	roleRepo *models.RoleRepository
+	userRepo *models.UserRepository
+	renderer Renderer
+}
+
+func NewInventoryHandler(invRepo *models.InventoryRepository, roleRepo *models.RoleRepository,
+	userRepo *models.UserRepository, renderer Renderer) *InventoryHandler {
+	return &InventoryHandler{
+		invRepo:  invRepo,
+		roleRepo: roleRepo,
+		userRepo: userRepo,
+		renderer: renderer,
+	}
+}
+
+type inventoryRow struct {
+	models.Inventory
+	ItemCount int64
+}
+
+type listInventoriesPage struct {
+	Inventories []inventoryRow
+	// Access decides which actions are offered for every inventory.
+	Access models.Access
+}
+
+// ListInventories lists the inventories the user can see.
+func (h *InventoryHandler) ListInventories(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	inventories, err := h.invRepo.WithContext(r.Context()).FindAll(access.Inventories(models.RoleViewer))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	counts, err := h.invRepo.WithContext(r.Context()).CountAllItems()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := listInventoriesPage{Access: access}
+	for _, inv := range inventories {
+		page.Inventories = append(page.Inventories, inventoryRow{Inventory: inv, ItemCount: counts[inv.ID]})
+	}
+	h.renderer.Render(w, r, "inventory_list.html", page)
+}
+
+func getFormInventory(r *http.Request) (models.Inventory, error) {
+	var inv models.Inventory
+	_ = r.ParseForm()
+	inv.Name = r.FormValue("inventoryName")
+
+	var errs, err error
+	inv.ReorderPoint, err = getFormOptionalInt(r, "inventoryReorderPoint")
+	if err != nil {
+		errs = errors.New("invalid reorder point")
+	}
+	inv.ReorderQuantity, err = getFormOptionalInt(r, "inventoryReorderQuantity")
+	if err != nil {
+		errs = multierr.Append(errs, errors.New("invalid reorder quantity"))
+	}
+	return inv, errs
+}
+
+func validateInventory(inv *models.Inventory) error {
+	if inv.Name == "" {
+		return errors.New("inventory name cannot be empty")
+	}
+	return nil
+}
+
+type editInventoryPage struct {
+	Title      string
+	FormAction string
+	Inventory  models.Inventory
+	Error      error
+}
+
+// requireAdmin writes an error response unless the signed in user is an
+// admin.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	access, ok := requireAccess(w, r, http.Error)
+	if ok && !access.Admin {
+		http.Error(w, models.ErrPermissionDenied.Error(), http.StatusForbidden)
+		return false
+	}
+	return ok
+}
+
+// CreateInventory shows the form of a new inventory. Only admins create
+// inventories.
+func (h *InventoryHandler) CreateInventory(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	h.renderer.Render(w, r, "inventory_edit.html", editInventoryPage{
+		Title:      "Create Inventory",
+		FormAction: "/inventories/create",
+	})
+}
+
+func (h *InventoryHandler) PostCreateInventory(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	inv, err := getFormInventory(r)
+	page := editInventoryPage{
+		Title:      "Create Inventory",
+		FormAction: "/inventories/create",
+		Inventory:  inv,
+	}
+	if err != nil {
+		page.Error = err
+		h.renderer.Render(w, r, "inventory_edit.html", page)
+		return
+	}
+	if err := validateInventory(&inv); err != nil {
+		page.Error = err
+		h.renderer.Render(w, r, "inventory_edit.html", page)
+		return
+	}
+
+	if _, err := h.invRepo.WithContext(r.Context()).Create(inv); err != nil {
+		page.Error = err
+		h.renderer.Render(w, r, "inventory_edit.html", page)
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Inventory '%s' created", inv.Name)
+	http.Redirect(w, r, "/inventories", http.StatusFound)
+}
+
+func getParamInventoryID(r *http.Request) (uint, error) {
+	return getParamID(r, "inventory")
+}
+
+// findInventory looks up the inventory of the request for a user who needs
+// the given role in it and writes the error response if that fails.
+// Inventories the user cannot see are reported as not found.
+func (h *InventoryHandler) findInventory(w http.ResponseWriter, r *http.Request,
+	role models.Role) (models.Inventory, models.Access, bool) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return models.Inventory{}, access, false
+	}
+	invID, err := getParamInventoryID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return models.Inventory{}, access, false
+	}
+
+	inv, err := h.invRepo.WithContext(r.Context()).FindByID(invID, access.Inventories(models.RoleViewer))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "inventory not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return inv, access, false
+	}
+	if !access.Can(inv.ID, role) {
+		http.Error(w, models.ErrPermissionDenied.Error(), http.StatusForbidden)
+		return inv, access, false
+	}
+	return inv, access, true
+}
+
+func (h *InventoryHandler) EditInventory(w http.ResponseWriter, r *http.Request) {
+	inv, _, ok := h.findInventory(w, r, models.RoleManager)
+	if !ok {
+		return
+	}
+	h.renderer.Render(w, r, "inventory_edit.html", editInventoryPage{
+		Title:      "Edit Inventory",
+		FormAction: fmt.Sprintf("/inventories/%d/edit", inv.ID),
+		Inventory:  inv,
+	})
+}
+
+func (h *InventoryHandler) PostEditInventory(w http.ResponseWriter, r *http.Request) {
+	inv, _, ok := h.findInventory(w, r, models.RoleManager)
+	if !ok {
+		return
+	}
+
+	formInv, err := getFormInventory(r)
+	inv.Name = formInv.Name
+	inv.ReorderPoint = formInv.ReorderPoint
+	inv.ReorderQuantity = formInv.ReorderQuantity
+	page := editInventoryPage{
+		Title:      "Edit Inventory",
+		FormAction: fmt.Sprintf("/inventories/%d/edit", inv.ID),
+		Inventory:  inv,
+	}
+	if err != nil {
+		page.Error = err
+		h.renderer.Render(w, r, "inventory_edit.html", page)
+		return
+	}
+	if err := validateInventory(&inv); err != nil {
+		page.Error = err
+		h.renderer.Render(w, r, "inventory_edit.html", page)
+		return
+	}
+
+	if _, err := h.invRepo.WithContext(r.Context()).Update(inv); err != nil {
+		page.Error = err
+		h.renderer.Render(w, r, "inventory_edit.html", page)
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Inventory '%s' saved", inv.Name)
+	http.Redirect(w, r, "/inventories", http.StatusFound)
+}
+
+type deleteInventoryPage struct {
+	Inventory models.Inventory
+	ItemCount int64
+	// Targets are the inventories that can receive the items of the deleted
+	// inventory, which are the ones the user manages.
+	Targets []models.Inventory
+	Error   error
+}
+
+func (h *InventoryHandler) renderDeletePage(w http.ResponseWriter, r *http.Request, access models.Access,
+	page deleteInventoryPage) {
+	count, err := h.invRepo.WithContext(r.Context()).CountItems(page.Inventory.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	inventories, err := h.invRepo.WithContext(r.Context()).FindAll(access.Inventories(models.RoleManager))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page.ItemCount = count
+	for _, inv := range inventories {
+		if inv.ID != page.Inventory.ID {
+			page.Targets = append(page.Targets, inv)
+		}
+	}
+	h.renderer.Render(w, r, "inventory_delete.html", page)
+}
+
+// DeleteInventory shows the delete form of an inventory. Deleting an
+// inventory needs the admin role in it.
+func (h *InventoryHandler) DeleteInventory(w http.ResponseWriter, r *http.Request) {
+	inv, access, ok := h.findInventory(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+	h.renderDeletePage(w, r, access, deleteInventoryPage{Inventory: inv})
+}
+
+// PostDeleteInventory deletes an inventory. If the form names a target
+// inventory, the items are moved there first. Otherwise deleting a non-empty
+// inventory is refused.
+func (h *InventoryHandler) PostDeleteInventory(w http.ResponseWriter, r *http.Request) {
+	inv, access, ok := h.findInventory(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	_ = r.ParseForm()
+	var err error
+	if target := r.FormValue("targetInventory"); target != "" {
+		var targetID int
+		targetID, err = strconv.Atoi(target)
+		if err != nil || targetID < 0 || !access.Can(uint(targetID), models.RoleManager) {
+			err = errors.New("invalid target inventory")
+		} else {
+			err = h.invRepo.WithContext(r.Context()).MoveItemsAndDelete(inv.ID, uint(targetID))
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = errors.New("invalid target inventory")
+			}
+		}
+	} else {
+		err = h.invRepo.WithContext(r.Context()).DeleteByID(inv.ID)
+	}
+	if err != nil {
+		h.renderDeletePage(w, r, access, deleteInventoryPage{Inventory: inv, Error: err})
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Inventory '%s' deleted", inv.Name)
+	http.Redirect(w, r, "/inventories", http.StatusFound)
+}
+
+type inventoryRolesPage struct {
+	Inventory models.Inventory
+	Roles     []models.InventoryRole
+	// Users are the users that can be granted a role.
+	Users     []models.User
+	RoleNames []models.Role
+	Error     error
+}
+
+func (h *InventoryHandler) renderRolesPage(w http.ResponseWriter, r *http.Request, page inventoryRolesPage) {
+	roles, err := h.roleRepo.WithContext(r.Context()).FindByInventoryID(page.Inventory.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	users, err := h.userRepo.WithContext(r.Context()).FindAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page.Roles = roles
+	page.RoleNames = models.Roles
+	for _, user := range users {
+		if !user.Admin {
+			page.Users = append(page.Users, user)
+		}
+	}
+	h.renderer.Render(w, r, "inventory_roles.html", page)
+}
+
+// ListInventoryRoles shows the roles granted in an inventory. Managing roles
+// needs the admin role in the inventory.
+func (h *InventoryHandler) ListInventoryRoles(w http.ResponseWriter, r *http.Request) {
+	inv, _, ok := h.findInventory(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+	h.renderRolesPage(w, r, inventoryRolesPage{Inventory: inv})
+}
+
+// getFormUserID parses the roleUser form value.
+func getFormUserID(r *http.Request) (uint, error) {
+	userID, err := strconv.Atoi(r.FormValue("roleUser"))
+	if err != nil || userID <= 0 {
+		return 0, errors.New("invalid user")
+	}
+	return uint(userID), nil
+}
+
+// PostGrantInventoryRole grants a role in an inventory to a user, replacing
+// the role the user had there.
+func (h *InventoryHandler) PostGrantInventoryRole(w http.ResponseWriter, r *http.Request) {
+	inv, _, ok := h.findInventory(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	_ = r.ParseForm()
+	page := inventoryRolesPage{Inventory: inv}
+	userID, err := getFormUserID(r)
+	if err != nil {
+		page.Error = err
+		h.renderRolesPage(w, r, page)
+		return
+	}
+	user, err := h.userRepo.WithContext(r.Context()).FindByID(userID)
+	if err != nil {
+		page.Error = errors.New("invalid user")
+		h.renderRolesPage(w, r, page)
+		return
+	}
+	role := models.Role(r.FormValue("role"))
+	_, err = h.roleRepo.WithContext(r.Context()).Grant(inv.ID, userID, role)
+	if err != nil {
+		page.Error = err
+		h.renderRolesPage(w, r, page)
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Granted %s to %s", role, user.Username)
+	http.Redirect(w, r, fmt.Sprintf("/inventories/%d/roles", inv.ID), http.StatusFound)
+}
+
+func (h *InventoryHandler) PostRevokeInventoryRole(w http.ResponseWriter, r *http.Request) {
+	inv, _, ok := h.findInventory(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	_ = r.ParseForm()
+	userID, err := getFormUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.roleRepo.WithContext(r.Context()).Revoke(inv.ID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "role not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Role revoked")
+	http.Redirect(w, r, fmt.Sprintf("/inventories/%d/roles", inv.ID), http.StatusFound)
+}
+
+// HandleFuncs registers related handlers into a given Router.
+func (h *InventoryHandler) HandleFuncs(router *mux.Router) {
+	router.HandleFunc("/inventories", h.ListInventories).Methods(http.MethodGet).Name("inventories.list")
+	router.HandleFunc("/inventories/create", h.CreateInventory).Methods(http.MethodGet).Name("inventories.create")
+	router.HandleFunc("/inventories/create", h.PostCreateInventory).Methods(http.MethodPost).Name("inventories.create.post")
+	router.HandleFunc("/inventories/{id:[0-9]+}/edit", h.EditInventory).Methods(http.MethodGet).Name("inventories.edit")
+	router.HandleFunc("/inventories/{id:[0-9]+}/edit", h.PostEditInventory).Methods(http.MethodPost).Name("inventories.edit.post")
+	router.HandleFunc("/inventories/{id:[0-9]+}/delete", h.DeleteInventory).Methods(http.MethodGet).Name("inventories.delete")
+	router.HandleFunc("/inventories/{id:[0-9]+}/delete", h.PostDeleteInventory).Methods(http.MethodPost).Name("inventories.delete.post")
+	router.HandleFunc("/inventories/{id:[0-9]+}/roles", h.ListInventoryRoles).Methods(http.MethodGet).Name("inventories.roles")
+	router.HandleFunc("/inventories/{id:[0-9]+}/roles", h.PostGrantInventoryRole).Methods(http.MethodPost).Name("inventories.roles.grant")
+	router.HandleFunc("/inventories/{id:[0-9]+}/roles/delete", h.PostRevokeInventoryRole).Methods(http.MethodPost).Name("inventories.roles.revoke")
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type InventoryHandlerTestSuite struct {
+	suite.Suite
+
+	db       *gorm.DB
+	invRepo  *models.InventoryRepository
+	itemRepo *models.ItemRepository
+
+	h        *InventoryHandler
+	renderer *mockedRenderer
+
+	initInvs  []models.Inventory
+	initItems []models.Item
+}
+
+func (s *InventoryHandlerTestSuite) SetupTest() {
+	var err error
+	s.db, err = models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = models.Migrate(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.initInvs, s.initItems, err = fillInitialData(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.invRepo = &models.InventoryRepository{DB: s.db}
+	s.itemRepo = &models.ItemRepository{DB: s.db}
+	s.renderer = &mockedRenderer{}
+	s.renderer.On("Render", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.h = NewInventoryHandler(s.invRepo, &models.RoleRepository{DB: s.db}, &models.UserRepository{DB: s.db},
+		s.renderer)
+}
+
+func (s *InventoryHandlerTestSuite) TearDownTest() {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *InventoryHandlerTestSuite) postForm(target string, id uint, form url.Values,
+	handler http.HandlerFunc) *http.Response {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if id != 0 {
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(id))})
+	}
+	w := httptest.NewRecorder()
+	handler(w, asAdmin(req))
+	return w.Result()
+}
+
+func (s *InventoryHandlerTestSuite) TestListInventories() {
+	req := httptest.NewRequest(http.MethodGet, "/inventories", nil)
+	w := httptest.NewRecorder()
+
+	s.h.ListInventories(w, asAdmin(req))
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
+	page := s.renderer.Calls[0].Arguments[3].(listInventoriesPage)
+	s.Require().Equal(len(s.initInvs), len(page.Inventories))
+	s.Equal(int64(2), page.Inventories[0].ItemCount)
+}
+
+func (s *InventoryHandlerTestSuite) TestPostCreateInventory() {
+	form := url.Values{}
+	form.Add("inventoryName", "Garden")
+	resp := s.postForm("/inventories/create", 0, form, s.h.PostCreateInventory)
+
+	s.Equal(http.StatusFound, resp.StatusCode)
+	invs, err := s.invRepo.FindAll()
+	s.Require().Nil(err)
+	s.Equal(len(s.initInvs)+1, len(invs))
+}
+
+func (s *InventoryHandlerTestSuite) TestPostCreateInventory_NoName() {
+	resp := s.postForm("/inventories/create", 0, url.Values{}, s.h.PostCreateInventory)
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
+	page := s.renderer.Calls[0].Arguments[3].(editInventoryPage)
+	s.NotNil(page.Error)
+}
+
+func (s *InventoryHandlerTestSuite) TestPostEditInventory() {
+	inv := s.initInvs[1]
+	form := url.Values{}
+	form.Add("inventoryName", "Games")
+	resp := s.postForm(fmt.Sprintf("/inventories/%d/edit", inv.ID), inv.ID, form, s.h.PostEditInventory)
+
+	s.Equal(http.StatusFound, resp.StatusCode)
+	retInv, err := s.invRepo.FindByID(inv.ID)
+	s.Require().Nil(err)
+	s.Equal("Games", retInv.Name)
+}
+
+func (s *InventoryHandlerTestSuite) TestPostDeleteInventory_NotEmpty() {
+	inv := s.initInvs[0]
+	resp := s.postForm(fmt.Sprintf("/inventories/%d/delete", inv.ID), inv.ID, url.Values{},
+		s.h.PostDeleteInventory)
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
+	page := s.renderer.Calls[0].Arguments[3].(deleteInventoryPage)
+	s.ErrorIs(page.Error, models.ErrInventoryNotEmpty)
+	s.Equal(int64(2), page.ItemCount)
+
+	_, err := s.invRepo.FindByID(inv.ID)
+	s.Nil(err)
+}
+
+func (s *InventoryHandlerTestSuite) TestPostDeleteInventory_MoveItems() {
+	inv, target := s.initInvs[0], s.initInvs[1]
+	form := url.Values{}
+	form.Add("targetInventory", strconv.Itoa(int(target.ID)))
+	resp := s.postForm(fmt.Sprintf("/inventories/%d/delete", inv.ID), inv.ID, form,
+		s.h.PostDeleteInventory)
+
+	s.Equal(http.StatusFound, resp.StatusCode)
+	_, err := s.invRepo.FindByID(inv.ID)
+	s.ErrorIs(err, gorm.ErrRecordNotFound)
+
+	count, err := s.invRepo.CountItems(target.ID)
+	s.Require().Nil(err)
+	s.Equal(int64(3), count)
+}
+
+func TestInventoryHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(InventoryHandlerTestSuite))
+}
@@ -4,12 +4,13 @@ import (
 	"encoding/csv"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/logging"
 	"github.com/shayanh/shopify-challenge-2022/models"
 	"go.uber.org/multierr"
 	"gorm.io/gorm"
@@ -18,46 +19,190 @@ import (
 // ItemHandler implements web handlers related to Item entity. It uses repository
 // objects to fetch data from the data store.
 type ItemHandler struct {
-	itemRepo *models.ItemRepository
-	invRepo  *models.InventoryRepository
-	renderer Renderer
+	itemRepo     *models.ItemRepository
+	invRepo      *models.InventoryRepository
+	productRepo  *models.ProductRepository
+	categoryRepo *models.CategoryRepository
+	renderer     Renderer
 }
 
-func NewItemHandler(itemRepo *models.ItemRepository, invRepo *models.InventoryRepository, renderer Renderer) *ItemHandler {
+func NewItemHandler(itemRepo *models.ItemRepository, invRepo *models.InventoryRepository,
+	productRepo *models.ProductRepository, categoryRepo *models.CategoryRepository,
+	renderer Renderer) *ItemHandler {
 	return &ItemHandler{
-		itemRepo: itemRepo,
-		invRepo:  invRepo,
-		renderer: renderer,
+		itemRepo:     itemRepo,
+		invRepo:      invRepo,
+		productRepo:  productRepo,
+		categoryRepo: categoryRepo,
+		renderer:     renderer,
 	}
 }
 
+// itemGroup is a row group of the item list: the variants of a product, or a
+// single item that is not a variant.
+type itemGroup struct {
+	Product  *models.Product
+	Items    []models.Item
+	Quantity int
+}
+
+// groupItems groups the variants of every product, in the order of their
+// first appearance.
+func groupItems(items []models.Item) []itemGroup {
+	var groups []itemGroup
+	index := make(map[uint]int)
+	for _, item := range items {
+		if item.ProductID == nil || item.Product == nil {
+			groups = append(groups, itemGroup{Items: []models.Item{item}, Quantity: item.Quantity})
+			continue
+		}
+		i, ok := index[*item.ProductID]
+		if !ok {
+			i = len(groups)
+			index[*item.ProductID] = i
+			groups = append(groups, itemGroup{Product: item.Product})
+		}
+		groups[i].Items = append(groups[i].Items, item)
+		groups[i].Quantity += item.Quantity
+	}
+	return groups
+}
+
 type listItemsPage struct {
-	Items []models.Item
+	Items       []models.Item
+	Inventories []models.Inventory
+	Query       models.ItemQuery
+	Total       int64
+	Page        int
+	Pages       int
+	PrevURL     string
+	NextURL     string
+	ExportURL   string
+	// SortURLs maps every sort key to the URL that sorts the list by it.
+	SortURLs map[string]string
+	// Access decides which actions are offered for every item.
+	Access models.Access
+	// Groups are the items of the page grouped by product.
+	Groups []itemGroup
+	// Categories gives the category paths of the items.
+	Categories *models.CategoryTree
+	// CategoryFacets and TagFacets link to the list filtered by a category or
+	// a tag, and the clear URLs remove those filters.
+	CategoryFacets   []facetLink
+	TagFacets        []facetLink
+	ClearCategoryURL string
+	ClearTagURL      string
+}
+
+// facetLink is a category or a tag with the number of matching items.
+type facetLink struct {
+	Label  string
+	Count  int64
+	URL    string
+	Active bool
 }
 
+// ListItems lists the items matching the search, filter and sort query
+// parameters, one page at a time. Only the items of the inventories the user
+// can see are listed.
 func (h *ItemHandler) ListItems(w http.ResponseWriter, r *http.Request) {
-	items, err := h.itemRepo.FindAll()
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	q, err := parseItemQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Page == 0 {
+		q.Page = 1
+	}
+
+	items, total, err := h.itemRepo.WithContext(r.Context()).Find(q, models.WithInventory(), models.WithProduct(),
+		models.WithTags(), access.Items(models.RoleViewer))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	facets, err := h.itemRepo.WithContext(r.Context()).Facets(q, access.Items(models.RoleViewer))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tree, err := h.categoryRepo.WithContext(r.Context()).Tree()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	for i := range items {
-		items[i].Inventory, err = h.invRepo.FindByID(items[i].InventoryID)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	inventories, err := h.invRepo.WithContext(r.Context()).FindAll(access.Inventories(models.RoleViewer))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	page := listItemsPage{Items: items}
-	h.renderer.Render(w, "list.html", page)
+	page := listItemsPage{
+		Items:       items,
+		Groups:      groupItems(items),
+		Inventories: inventories,
+		Access:      access,
+		Query:       q,
+		Total:       total,
+		Page:        q.Page,
+		Pages:       int((total + int64(q.Limit()) - 1) / int64(q.Limit())),
+		ExportURL:   itemQueryURL("/items/csv", q, 0),
+		SortURLs:    make(map[string]string),
+		Categories:  tree,
+	}
+	fq := q
+	fq.Page = 0
+	for _, node := range facets.Categories {
+		fq.CategoryID = node.ID
+		page.CategoryFacets = append(page.CategoryFacets, facetLink{
+			Label:  node.Path,
+			Count:  node.TotalItems,
+			URL:    itemQueryURL("/items", fq, 0),
+			Active: node.ID == q.CategoryID,
+		})
+	}
+	fq.CategoryID = 0
+	page.ClearCategoryURL = itemQueryURL("/items", fq, 0)
+	fq = q
+	fq.Page = 0
+	for _, tag := range facets.Tags {
+		fq.Tag = tag.Name
+		page.TagFacets = append(page.TagFacets, facetLink{
+			Label:  tag.Name,
+			Count:  tag.Count,
+			URL:    itemQueryURL("/items", fq, 0),
+			Active: tag.Name == strings.ToLower(q.Tag),
+		})
+	}
+	fq.Tag = ""
+	page.ClearTagURL = itemQueryURL("/items", fq, 0)
+	if page.Page > 1 {
+		page.PrevURL = itemQueryURL("/items", q, page.Page-1)
+	}
+	if page.Page < page.Pages {
+		page.NextURL = itemQueryURL("/items", q, page.Page+1)
+	}
+	sortBy := q.SortBy
+	if sortBy == "" {
+		sortBy = "id"
+	}
+	for key := range models.ItemSortColumns {
+		sq := q
+		sq.SortBy = key
+		sq.SortDesc = sortBy == key && !q.SortDesc
+		page.SortURLs[key] = itemQueryURL("/items", sq, 0)
+	}
+	h.renderer.Render(w, r, "list.html", page)
 }
 
 func getFormItem(r *http.Request) (models.Item, error) {
 	var item models.Item
 	_ = r.ParseForm()
-	log.Println(r.PostForm)
 	item.Name = r.FormValue("itemName")
 	item.Description = r.FormValue("itemDescription")
 
@@ -67,20 +212,110 @@ func getFormItem(r *http.Request) (models.Item, error) {
 		errs = errors.New("invalid quantity")
 	}
 
+	item.SKU = strings.TrimSpace(r.FormValue("itemSKU"))
+	if str := strings.TrimSpace(r.FormValue("itemBarcode")); str != "" {
+		barcode, err := models.ParseBarcode(str)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+		} else {
+			item.Barcode = &barcode
+		}
+	}
+
 	invID, err := strconv.Atoi(r.FormValue("itemInventory"))
 	if err != nil || invID < 0 {
 		errs = multierr.Append(errs, errors.New("invalid inventory"))
 	} else {
 		item.InventoryID = uint(invID)
 	}
+
+	item.ReorderPoint, err = getFormOptionalInt(r, "itemReorderPoint")
+	if err != nil {
+		errs = multierr.Append(errs, errors.New("invalid reorder point"))
+	}
+	item.ReorderQuantity, err = getFormOptionalInt(r, "itemReorderQuantity")
+	if err != nil {
+		errs = multierr.Append(errs, errors.New("invalid reorder quantity"))
+	}
+
+	if str := r.FormValue("itemProduct"); str != "" {
+		productID, err := strconv.ParseUint(str, 10, 0)
+		if err != nil {
+			errs = multierr.Append(errs, errors.New("invalid product"))
+		} else {
+			id := uint(productID)
+			item.ProductID = &id
+		}
+	}
+	item.Options, err = models.ParseOptionValues(r.FormValue("itemOptions"))
+	if err != nil {
+		errs = multierr.Append(errs, err)
+	}
+
+	if str := r.FormValue("itemCategory"); str != "" {
+		categoryID, err := strconv.ParseUint(str, 10, 0)
+		if err != nil {
+			errs = multierr.Append(errs, errors.New("invalid category"))
+		} else {
+			id := uint(categoryID)
+			item.CategoryID = &id
+		}
+	}
+	item.Tags, err = models.ParseTags(r.FormValue("itemTags"))
+	if err != nil {
+		errs = multierr.Append(errs, err)
+	}
+
+	// The version is only sent by the edit form.
+	if str := r.FormValue("itemVersion"); str != "" {
+		version, err := strconv.ParseUint(str, 10, 0)
+		if err != nil {
+			errs = multierr.Append(errs, errors.New("invalid version"))
+		}
+		item.Version = uint(version)
+	}
 	return item, errs
 }
 
-func (h *ItemHandler) validateItem(item *models.Item) error {
+// getFormOptionalInt parses a non-negative form value that may be left empty.
+func getFormOptionalInt(r *http.Request, key string) (*int, error) {
+	str := r.FormValue(key)
+	if str == "" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(str)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("invalid %s", key)
+	}
+	return &v, nil
+}
+
+// stringValue returns the string of an optional field, or an empty string.
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// joinTags formats tags in the format of models.ParseTags.
+func joinTags(tags []models.Tag) string {
+	return strings.Join(models.TagNames(tags), ", ")
+}
+
+// validateItem checks the given item against the business rules. It is shared
+// between the HTML and the JSON handlers.
+func validateItem(invRepo *models.InventoryRepository, item *models.Item) error {
 	if item.Name == "" {
 		return errors.New("item name cannot be empty")
 	}
-	_, err := h.invRepo.FindByID(item.InventoryID)
+	if item.SKU == "" {
+		return errors.New("item SKU cannot be empty")
+	}
+	if item.Quantity < 0 {
+		return errors.New("invalid quantity")
+	}
+	_, err := invRepo.FindByID(item.InventoryID)
 	if err != nil {
 		return errors.New("invalid inventory")
 	}
@@ -91,21 +326,57 @@ type editItemPage struct {
 	Title       string
 	FormAction  string
 	Inventories []models.Inventory
-	Item        models.Item
-	Error       error
+	Products    []models.Product
+	// ProductID is the product of the item, or zero.
+	ProductID uint
+	// Categories are all categories in tree order and CategoryID is the
+	// category of the item, or zero.
+	Categories []models.CategoryNode
+	CategoryID uint
+	Item       models.Item
+	// Reasons are the stock movement reasons to choose from when the quantity
+	// of an existing item is changed. It is empty for new items.
+	Reasons []models.MovementReason
+	Reason  models.MovementReason
+	Note    string
+	Error   error
 }
 
-func (h *ItemHandler) renderEditPage(w http.ResponseWriter, page editItemPage) {
-	inventories, err := h.invRepo.FindAll()
+// renderEditPage renders the item form. The inventories to choose from are
+// the ones the user manages, the products are all products.
+func (h *ItemHandler) renderEditPage(w http.ResponseWriter, r *http.Request, access models.Access,
+	page editItemPage) {
+	inventories, err := h.invRepo.WithContext(r.Context()).FindAll(access.Inventories(models.RoleManager))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	page.Inventories = inventories
-	h.renderer.Render(w, "edit.html", page)
+	page.Products, err = h.productRepo.WithContext(r.Context()).FindAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if page.Item.ProductID != nil {
+		page.ProductID = *page.Item.ProductID
+	}
+	tree, err := h.categoryRepo.WithContext(r.Context()).Tree()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page.Categories = tree.Nodes
+	if page.Item.CategoryID != nil {
+		page.CategoryID = *page.Item.CategoryID
+	}
+	h.renderer.Render(w, r, "edit.html", page)
 }
 
 func (h *ItemHandler) PostCreateItem(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
 	item, err := getFormItem(r)
 	page := editItemPage{
 		Title:      "Create Item",
@@ -114,154 +385,351 @@ func (h *ItemHandler) PostCreateItem(w http.ResponseWriter, r *http.Request) {
 	}
 	if err != nil {
 		page.Error = err
-		h.renderEditPage(w, page)
+		h.renderEditPage(w, r, access, page)
 		return
 	}
-	err = h.validateItem(&item)
+	err = validateItem(h.invRepo.WithContext(r.Context()), &item)
 	if err != nil {
 		page.Error = err
-		h.renderEditPage(w, page)
+		h.renderEditPage(w, r, access, page)
+		return
+	}
+	if !access.Can(item.InventoryID, models.RoleManager) {
+		page.Error = models.ErrPermissionDenied
+		h.renderEditPage(w, r, access, page)
 		return
 	}
 
-	_, err = h.itemRepo.Create(item)
+	_, err = h.itemRepo.WithContext(r.Context()).Create(item)
 	if err != nil {
 		page.Error = err
-		h.renderEditPage(w, page)
+		h.renderEditPage(w, r, access, page)
 		return
 	}
+	addFlash(r, models.FlashSuccess, "Item '%s' created", item.Name)
 	http.Redirect(w, r, "/items", http.StatusFound)
 }
 
 func (h *ItemHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
-	h.renderEditPage(w, editItemPage{
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	h.renderEditPage(w, r, access, editItemPage{
 		Title:      "Create Item",
 		FormAction: "/items/create",
 	})
 }
 
-func getParamItemID(r *http.Request) (uint, error) {
+// getParamID parses the id route variable of the given entity.
+func getParamID(r *http.Request, entity string) (uint, error) {
 	params := mux.Vars(r)
 	strID, ok := params["id"]
 	if !ok {
-		return 0, errors.New("missing item id")
+		return 0, fmt.Errorf("missing %s id", entity)
 	}
 	intID, err := strconv.Atoi(strID)
 	if err != nil || intID < 0 {
-		return 0, errors.New("invalid item id")
+		return 0, fmt.Errorf("invalid %s id", entity)
 	}
 	return uint(intID), nil
 }
 
-func (h *ItemHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
-	itemID, err := getParamItemID(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+func getParamItemID(r *http.Request) (uint, error) {
+	return getParamID(r, "item")
+}
 
-	_, err = h.itemRepo.FindByID(itemID)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			http.Error(w, "item not found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+func (h *ItemHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	item, _, ok := findAccessibleItem(w, r, http.Error, h.itemRepo, models.RoleManager)
+	if !ok {
 		return
 	}
 
-	err = h.itemRepo.DeleteByID(itemID)
+	err := h.itemRepo.WithContext(r.Context()).DeleteByID(item.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	addFlash(r, models.FlashSuccess, "Item '%s' deleted", item.Name)
 	http.Redirect(w, r, "/items", http.StatusFound)
 }
 
+// PostEditItem saves the edit form of an item. Clerks may only change the
+// quantity.
 func (h *ItemHandler) PostEditItem(w http.ResponseWriter, r *http.Request) {
-	itemID, err := getParamItemID(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	_, err = h.itemRepo.FindByID(itemID)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			http.Error(w, "item not found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+	item, access, ok := findAccessibleItem(w, r, http.Error, h.itemRepo, models.RoleClerk, models.WithTags())
+	if !ok {
 		return
 	}
-
-	item, err := getFormItem(r)
+	current := item
+
+	formItem, err := getFormItem(r)
+	item.Name = formItem.Name
+	item.Description = formItem.Description
+	item.Quantity = formItem.Quantity
+	item.InventoryID = formItem.InventoryID
+	item.ReorderPoint = formItem.ReorderPoint
+	item.ReorderQuantity = formItem.ReorderQuantity
+	item.ProductID = formItem.ProductID
+	item.Options = formItem.Options
+	item.SKU = formItem.SKU
+	item.Barcode = formItem.Barcode
+	item.CategoryID = formItem.CategoryID
+	item.Tags = formItem.Tags
+	item.Version = formItem.Version
 	page := editItemPage{
 		Title:      "Edit Item",
-		FormAction: fmt.Sprintf("/items/%d/edit", itemID),
+		FormAction: fmt.Sprintf("/items/%d/edit", item.ID),
 		Item:       item,
+		Reasons:    models.MovementReasons,
+		Reason:     models.MovementReason(r.FormValue("movementReason")),
+		Note:       r.FormValue("movementNote"),
+	}
+	if page.Reason == "" {
+		page.Reason = models.ReasonAdjust
 	}
 	if err != nil {
 		page.Error = err
-		h.renderEditPage(w, page)
+		h.renderEditPage(w, r, access, page)
 		return
 	}
-	err = h.validateItem(&item)
+	err = validateItem(h.invRepo.WithContext(r.Context()), &item)
 	if err != nil {
 		page.Error = err
-		h.renderEditPage(w, page)
+		h.renderEditPage(w, r, access, page)
+		return
+	}
+	if err := checkItemEdit(access, current, item); err != nil {
+		page.Error = err
+		h.renderEditPage(w, r, access, page)
 		return
 	}
 
-	item.ID = itemID
-	_, err = h.itemRepo.Update(item)
-	if err != nil {
+	_, err = h.itemRepo.WithContext(r.Context()).UpdateWithMovement(item, page.Reason, page.Note)
+	if errors.Is(err, models.ErrVersionConflict) {
+		h.renderConflictPage(w, r, page)
+		return
+	} else if err != nil {
 		page.Error = err
-		h.renderEditPage(w, page)
+		h.renderEditPage(w, r, access, page)
 		return
 	}
+	addFlash(r, models.FlashSuccess, "Item '%s' saved", item.Name)
 	http.Redirect(w, r, "/items", http.StatusFound)
 }
 
-func (h *ItemHandler) EditItem(w http.ResponseWriter, r *http.Request) {
-	itemID, err := getParamItemID(r)
+// conflictField is a field of an item as currently stored and as submitted.
+type conflictField struct {
+	Label     string
+	Current   string
+	Submitted string
+}
+
+func (f conflictField) Differs() bool {
+	return f.Current != f.Submitted
+}
+
+type conflictItemPage struct {
+	FormAction string
+	// Current is the stored item and Submitted the rejected edit of it. The
+	// version of Submitted is the one it was based on.
+	Current   models.Item
+	Submitted models.Item
+	Fields    []conflictField
+	Reason    models.MovementReason
+	Note      string
+}
+
+// renderConflictPage shows the stored item next to the rejected edit of the
+// given page, so that the user can either discard or reapply the edit.
+func (h *ItemHandler) renderConflictPage(w http.ResponseWriter, r *http.Request, page editItemPage) {
+	current, err := h.itemRepo.WithContext(r.Context()).FindByID(page.Item.ID, models.WithInventory(), models.WithTags())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	item, err := h.itemRepo.FindByID(itemID)
+	submitted := page.Item
+	submitted.Inventory, err = h.invRepo.WithContext(r.Context()).FindByID(submitted.InventoryID)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			http.Error(w, "item not found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	optionalInt := func(v *int) string {
+		if v == nil {
+			return ""
 		}
+		return strconv.Itoa(*v)
+	}
+	fields := []conflictField{
+		{"Name", current.Name, submitted.Name},
+		{"SKU", current.SKU, submitted.SKU},
+		{"Barcode", stringValue(current.Barcode), stringValue(submitted.Barcode)},
+		{"Inventory", current.Inventory.Name, submitted.Inventory.Name},
+		{"Quantity", strconv.Itoa(current.Quantity), strconv.Itoa(submitted.Quantity)},
+		{"Reorder point", optionalInt(current.ReorderPoint), optionalInt(submitted.ReorderPoint)},
+		{"Reorder quantity", optionalInt(current.ReorderQuantity), optionalInt(submitted.ReorderQuantity)},
+		{"Options", current.Options.String(), submitted.Options.String()},
+		{"Tags", joinTags(current.Tags), joinTags(submitted.Tags)},
+		{"Description", current.Description, submitted.Description},
+	}
+
+	h.renderer.Render(w, WithStatus(r, http.StatusConflict), "conflict.html", conflictItemPage{
+		FormAction: page.FormAction,
+		Current:    current,
+		Submitted:  submitted,
+		Fields:     fields,
+		Reason:     page.Reason,
+		Note:       page.Note,
+	})
+}
+
+func (h *ItemHandler) EditItem(w http.ResponseWriter, r *http.Request) {
+	item, access, ok := findAccessibleItem(w, r, http.Error, h.itemRepo, models.RoleClerk, models.WithTags())
+	if !ok {
 		return
 	}
 
-	h.renderEditPage(w, editItemPage{
+	h.renderEditPage(w, r, access, editItemPage{
 		Title:      "Edit Item",
-		FormAction: fmt.Sprintf("/items/%d/edit", itemID),
+		FormAction: fmt.Sprintf("/items/%d/edit", item.ID),
 		Item:       item,
+		Reasons:    models.MovementReasons,
+		Reason:     models.ReasonAdjust,
 	})
 }
 
+type transferItemPage struct {
+	Item        models.Item
+	Inventories []models.Inventory
+	TargetID    uint
+	Quantity    int
+	Note        string
+	Error       error
+}
+
+// renderTransferPage renders the transfer form. The target inventories to
+// choose from are the other ones in which the user is a clerk.
+func (h *ItemHandler) renderTransferPage(w http.ResponseWriter, r *http.Request, access models.Access,
+	page transferItemPage) {
+	inventories, err := h.invRepo.WithContext(r.Context()).FindAll(access.Inventories(models.RoleClerk))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, inv := range inventories {
+		if inv.ID != page.Item.InventoryID {
+			page.Inventories = append(page.Inventories, inv)
+		}
+	}
+	h.renderer.Render(w, r, "transfer.html", page)
+}
+
+func (h *ItemHandler) TransferItem(w http.ResponseWriter, r *http.Request) {
+	item, access, ok := findAccessibleItem(w, r, http.Error, h.itemRepo, models.RoleClerk)
+	if !ok {
+		return
+	}
+	h.renderTransferPage(w, r, access, transferItemPage{Item: item})
+}
+
+// PostTransferItem moves some units of an item to another inventory. The user
+// must be a clerk of both inventories.
+func (h *ItemHandler) PostTransferItem(w http.ResponseWriter, r *http.Request) {
+	item, access, ok := findAccessibleItem(w, r, http.Error, h.itemRepo, models.RoleClerk)
+	if !ok {
+		return
+	}
+
+	_ = r.ParseForm()
+	page := transferItemPage{Item: item, Note: r.FormValue("transferNote")}
+	var errs, err error
+	page.Quantity, err = strconv.Atoi(r.FormValue("transferQuantity"))
+	if err != nil || page.Quantity <= 0 {
+		errs = errors.New("invalid quantity")
+	}
+	targetID, err := strconv.Atoi(r.FormValue("transferInventory"))
+	if err != nil || targetID < 0 {
+		errs = multierr.Append(errs, errors.New("invalid inventory"))
+	} else {
+		page.TargetID = uint(targetID)
+	}
+	if errs == nil && !access.Can(page.TargetID, models.RoleClerk) {
+		errs = errors.New("invalid inventory")
+	}
+	if errs != nil {
+		page.Error = errs
+		h.renderTransferPage(w, r, access, page)
+		return
+	}
+
+	_, _, err = h.itemRepo.WithContext(r.Context()).Transfer(item.ID, page.TargetID, page.Quantity, page.Note)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = errors.New("invalid inventory")
+		}
+		page.Error = err
+		h.renderTransferPage(w, r, access, page)
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Transferred %d of '%s'", page.Quantity, item.Name)
+	http.Redirect(w, r, "/items", http.StatusFound)
+}
+
+// ExportCSV writes the items matching the filters of ListItems as CSV.
 func (h *ItemHandler) ExportCSV(w http.ResponseWriter, r *http.Request) {
-	items, err := h.itemRepo.FindAll()
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	q, err := parseItemQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Page = 0
+
+	items, _, err := h.itemRepo.WithContext(r.Context()).Find(q, models.WithInventory(), models.WithProduct(),
+		models.WithTags(), access.Items(models.RoleViewer))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	records := [][]string{
-		{"id", "name", "inventory", "qty", "created_at", "updated_at", "description"},
+	// Every option of the exported variants gets a column, in the order of
+	// the options of their products.
+	var options []string
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if item.Product == nil {
+			continue
+		}
+		for _, name := range item.Product.Options {
+			if !seen[name] {
+				seen[name] = true
+				options = append(options, name)
+			}
+		}
+	}
+
+	header := []string{"id", "name", "inventory", "qty", "created_at", "updated_at", "description",
+		"sku", "barcode", "tags", "product"}
+	for _, name := range options {
+		header = append(header, models.OptionColumnPrefix+name)
 	}
+	records := [][]string{header}
 	for _, item := range items {
 		record := []string{
 			strconv.Itoa(int(item.ID)), item.Name, item.Inventory.Name,
 			strconv.Itoa(item.Quantity), item.CreatedAt.Format(time.RFC3339),
 			item.UpdatedAt.Format(time.RFC3339), item.Description,
+			item.SKU, stringValue(item.Barcode), joinTags(item.Tags), "",
+		}
+		if item.Product != nil {
+			record[10] = item.Product.Name
+		}
+		for _, name := range options {
+			record = append(record, item.Options[name])
 		}
 		records = append(records, record)
 	}
@@ -275,17 +743,242 @@ func (h *ItemHandler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 	}
 	csvWriter.Flush()
 	if err := csvWriter.Error(); err != nil {
-		log.Println(err)
+		logging.Error(r.Context(), "Writing CSV failed", "error", err)
+	}
+}
+
+type lowStockRow struct {
+	models.Item
+	// Threshold is the effective reorder point of the item.
+	Threshold int
+}
+
+type lowStockPage struct {
+	Items []lowStockRow
+}
+
+// ListLowStock lists the items that have reached their reorder point.
+func (h *ItemHandler) ListLowStock(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	items, err := h.itemRepo.WithContext(r.Context()).FindLowStock(access.Items(models.RoleViewer))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var page lowStockPage
+	for _, item := range items {
+		threshold, _ := item.EffectiveReorderPoint()
+		page.Items = append(page.Items, lowStockRow{Item: item, Threshold: threshold})
+	}
+	h.renderer.Render(w, r, "low_stock.html", page)
+}
+
+type deletedItemsPage struct {
+	Items []models.Item
+	Error error
+}
+
+func (h *ItemHandler) renderDeletedItems(w http.ResponseWriter, r *http.Request, access models.Access,
+	page deletedItemsPage) {
+	items, err := h.itemRepo.WithContext(r.Context()).FindDeleted(access.Items(models.RoleViewer))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page.Items = items
+	h.renderer.Render(w, r, "deleted.html", page)
+}
+
+// ListDeletedItems shows the recycle bin of soft-deleted items.
+func (h *ItemHandler) ListDeletedItems(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	h.renderDeletedItems(w, r, access, deletedItemsPage{})
+}
+
+// findDeletedItem looks up the soft-deleted item of the request for a user
+// who needs the given role in its inventory and writes the error response if
+// that fails.
+func (h *ItemHandler) findDeletedItem(w http.ResponseWriter, r *http.Request,
+	role models.Role) (models.Item, models.Access, bool) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return models.Item{}, access, false
+	}
+	itemID, err := getParamItemID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return models.Item{}, access, false
+	}
+
+	item, err := h.itemRepo.WithContext(r.Context()).FindDeletedByID(itemID, access.Items(models.RoleViewer))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "item not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return item, access, false
+	}
+	if !access.Can(item.InventoryID, role) {
+		http.Error(w, models.ErrPermissionDenied.Error(), http.StatusForbidden)
+		return item, access, false
+	}
+	return item, access, true
+}
+
+func (h *ItemHandler) RestoreItem(w http.ResponseWriter, r *http.Request) {
+	item, access, ok := h.findDeletedItem(w, r, models.RoleManager)
+	if !ok {
+		return
+	}
+
+	err := h.itemRepo.WithContext(r.Context()).Restore(item.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "item not found", http.StatusNotFound)
+		} else if errors.Is(err, models.ErrInventoryDeleted) {
+			h.renderDeletedItems(w, r, access, deletedItemsPage{Error: err})
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Item '%s' restored", item.Name)
+	http.Redirect(w, r, "/items/deleted", http.StatusFound)
+}
+
+// PurgeItem permanently deletes a soft-deleted item. It needs the admin role
+// in the inventory of the item.
+func (h *ItemHandler) PurgeItem(w http.ResponseWriter, r *http.Request) {
+	item, _, ok := h.findDeletedItem(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	err := h.itemRepo.WithContext(r.Context()).PurgeByID(item.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "item not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Item '%s' purged", item.Name)
+	http.Redirect(w, r, "/items/deleted", http.StatusFound)
+}
+
+type importItemsPage struct {
+	Report *models.ImportReport
+	Error  error
+}
+
+const (
+	// importPath is where CSV files are posted to be imported.
+	importPath = "/items/csv"
+	// maxImportSize is the maximum accepted size of an uploaded CSV file.
+	maxImportSize = 10 << 20
+)
+
+func (h *ItemHandler) ImportItems(w http.ResponseWriter, r *http.Request) {
+	h.renderer.Render(w, r, "import.html", importItemsPage{})
+}
+
+// ImportCSV reads an uploaded CSV file in the layout of ExportCSV. With the
+// dryRun form value set the changes are only previewed. Rows of inventories
+// the user does not manage are rejected.
+func (h *ItemHandler) ImportCSV(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	var page importItemsPage
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		page.Error = errors.New("invalid upload")
+		h.renderer.Render(w, r, "import.html", page)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		page.Error = errors.New("missing csv file")
+		h.renderer.Render(w, r, "import.html", page)
+		return
+	}
+	defer file.Close()
+
+	dryRun := r.FormValue("dryRun") != ""
+	report, err := h.itemRepo.WithContext(r.Context()).ImportCSV(file, dryRun, access)
+	if err != nil {
+		page.Error = err
+	} else {
+		page.Report = &report
+	}
+	h.renderer.Render(w, r, "import.html", page)
+}
+
+type scanPage struct {
+	Code  string
+	Error error
+}
+
+// ScanItem shows a form that takes a SKU or a barcode, typed or read by a
+// barcode scanner that ends its input with Enter.
+func (h *ItemHandler) ScanItem(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAccess(w, r, http.Error); !ok {
+		return
+	}
+	h.renderer.Render(w, r, "scan.html", scanPage{})
+}
+
+// LookupItem finds the item with the SKU or barcode given in the code query
+// parameter and redirects to its stock page, ready to record a movement.
+// Unknown codes are reported on the scan page.
+func (h *ItemHandler) LookupItem(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	code := strings.TrimSpace(r.URL.Query().Get("code"))
+	if code == "" {
+		h.renderer.Render(w, r, "scan.html", scanPage{})
+		return
+	}
+	item, err := h.itemRepo.WithContext(r.Context()).FindByCode(code, access.Items(models.RoleViewer))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.renderer.Render(w, WithStatus(r, http.StatusNotFound), "scan.html", scanPage{Code: code, Error: fmt.Errorf("no item with code %s", code)})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	http.Redirect(w, r, fmt.Sprintf("/items/%d/movements?scan=1", item.ID), http.StatusFound)
 }
 
 // HandleFuncs registers related handlers into a given Router.
 func (h *ItemHandler) HandleFuncs(router *mux.Router) {
-	router.HandleFunc("/items", h.ListItems).Methods(http.MethodGet)
-	router.HandleFunc("/items/create", h.CreateItem).Methods(http.MethodGet)
-	router.HandleFunc("/items/create", h.PostCreateItem).Methods(http.MethodPost)
-	router.HandleFunc("/items/{id:[0-9]+}/delete", h.DeleteItem).Methods(http.MethodPost)
-	router.HandleFunc("/items/{id:[0-9]+}/edit", h.EditItem).Methods(http.MethodGet)
-	router.HandleFunc("/items/{id:[0-9]+}/edit", h.PostEditItem).Methods(http.MethodPost)
-	router.HandleFunc("/items/csv", h.ExportCSV).Methods(http.MethodGet)
+	router.HandleFunc("/items", h.ListItems).Methods(http.MethodGet).Name("items.list")
+	router.HandleFunc("/items/create", h.CreateItem).Methods(http.MethodGet).Name("items.create")
+	router.HandleFunc("/items/scan", h.ScanItem).Methods(http.MethodGet).Name("items.scan")
+	router.HandleFunc("/items/lookup", h.LookupItem).Methods(http.MethodGet).Name("items.lookup")
+	router.HandleFunc("/items/create", h.PostCreateItem).Methods(http.MethodPost).Name("items.create.post")
+	router.HandleFunc("/items/{id:[0-9]+}/delete", h.DeleteItem).Methods(http.MethodPost).Name("items.delete")
+	router.HandleFunc("/items/{id:[0-9]+}/edit", h.EditItem).Methods(http.MethodGet).Name("items.edit")
+	router.HandleFunc("/items/{id:[0-9]+}/edit", h.PostEditItem).Methods(http.MethodPost).Name("items.edit.post")
+	router.HandleFunc("/items/csv", h.ExportCSV).Methods(http.MethodGet).Name("items.export")
+	router.HandleFunc(importPath, h.ImportCSV).Methods(http.MethodPost).Name("items.import.post")
+	router.HandleFunc("/items/import", h.ImportItems).Methods(http.MethodGet).Name("items.import")
+	router.HandleFunc("/items/deleted", h.ListDeletedItems).Methods(http.MethodGet).Name("items.deleted")
+	router.HandleFunc("/items/low-stock", h.ListLowStock).Methods(http.MethodGet).Name("items.low_stock")
+	router.HandleFunc("/items/{id:[0-9]+}/transfer", h.TransferItem).Methods(http.MethodGet).Name("items.transfer")
+	router.HandleFunc("/items/{id:[0-9]+}/transfer", h.PostTransferItem).Methods(http.MethodPost).Name("items.transfer.post")
+	router.HandleFunc("/items/{id:[0-9]+}/restore", h.RestoreItem).Methods(http.MethodPost).Name("items.restore")
+	router.HandleFunc("/items/{id:[0-9]+}/purge", h.PurgeItem).Methods(http.MethodPost).Name("items.purge")
 }
@@ -1,12 +1,13 @@
 package handlers
 
 import (
+	"bytes"
 	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"testing"
@@ -15,8 +16,8 @@ import (
 	"github.com/shayanh/shopify-challenge-2022/models"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 func fillInitialData(db *gorm.DB) ([]models.Inventory, []models.Item, error) {
@@ -37,13 +38,13 @@ func fillInitialData(db *gorm.DB) ([]models.Inventory, []models.Item, error) {
 	}
 
 	var items = []models.Item{
-		{Name: "Pencil", InventoryID: invs[0].ID, Quantity: 8,
+		{Name: "Pencil", SKU: "PENCIL", InventoryID: invs[0].ID, Quantity: 8,
 			Description: "Black writing pencil for school days."},
-		{Name: "Backpack", InventoryID: invs[0].ID, Quantity: 11,
+		{Name: "Backpack", SKU: "BACKPACK", InventoryID: invs[0].ID, Quantity: 11,
 			Description: "Medium sized school backpack."},
-		{Name: "Anti Virus", InventoryID: invs[1].ID, Quantity: 3,
+		{Name: "Anti Virus", SKU: "ANTI-VIRUS", InventoryID: invs[1].ID, Quantity: 3,
 			Description: "Strong protection for your machine."},
-		{Name: "iPhone 13", InventoryID: invs[2].ID, Quantity: 9,
+		{Name: "iPhone 13", SKU: "IPHONE-13", InventoryID: invs[2].ID, Quantity: 9,
 			Description: "Smartphone by Apple company."},
 	}
 	itemRepo := models.ItemRepository{
@@ -59,12 +60,21 @@ func fillInitialData(db *gorm.DB) ([]models.Inventory, []models.Item, error) {
 	return invs, items, nil
 }
 
+// asAdmin returns the request as sent by a signed in admin.
+func asAdmin(req *http.Request) *http.Request {
+	ctx := withAccess(withUser(req.Context(), models.User{Admin: true}), models.FullAccess)
+	return req.WithContext(ctx)
+}
+
 type mockedRenderer struct {
 	mock.Mock
 }
 
-func (m *mockedRenderer) Render(w http.ResponseWriter, name string, data interface{}) {
-	m.Called(w, name, data)
+// Render records the call and writes the status of the request, as the page
+// would be written with it.
+func (m *mockedRenderer) Render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	m.Called(w, r, name, data)
+	w.WriteHeader(StatusOf(r))
 }
 
 type ItemHandlerTestSuite struct {
@@ -83,7 +93,7 @@ type ItemHandlerTestSuite struct {
 
 func (s *ItemHandlerTestSuite) SetupTest() {
 	var err error
-	s.db, err = gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	s.db, err = models.Open("sqlite://:memory:", &gorm.Config{})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -101,12 +111,17 @@ func (s *ItemHandlerTestSuite) SetupTest() {
 	s.invRepo = &models.InventoryRepository{DB: s.db}
 	s.itemRepo = &models.ItemRepository{DB: s.db}
 	s.renderer = &mockedRenderer{}
-	s.renderer.On("Render", mock.Anything, mock.Anything, mock.Anything)
-	s.h = NewItemHandler(s.itemRepo, s.invRepo, s.renderer)
+	s.renderer.On("Render", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.h = NewItemHandler(s.itemRepo, s.invRepo, &models.ProductRepository{DB: s.db},
+		&models.CategoryRepository{DB: s.db}, s.renderer)
 }
 
 func (s *ItemHandlerTestSuite) TearDownTest() {
-	if err := os.Remove("test.db"); err != nil {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -115,12 +130,12 @@ func (s *ItemHandlerTestSuite) TestListItems() {
 	req := httptest.NewRequest(http.MethodGet, "/items", nil)
 	w := httptest.NewRecorder()
 
-	s.h.ListItems(w, req)
+	s.h.ListItems(w, asAdmin(req))
 
 	resp := w.Result()
 	s.Equal(resp.StatusCode, http.StatusOK, "status must be ok")
 	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
-	calledListItemsPage := s.renderer.Calls[0].Arguments[2].(listItemsPage)
+	calledListItemsPage := s.renderer.Calls[0].Arguments[3].(listItemsPage)
 	s.Require().Equal(len(calledListItemsPage.Items), len(s.initItems))
 	for i := range s.initItems {
 		s.Equal(s.initItems[i].Name, calledListItemsPage.Items[i].Name)
@@ -129,18 +144,203 @@ func (s *ItemHandlerTestSuite) TestListItems() {
 	}
 }
 
+func (s *ItemHandlerTestSuite) TestListItems_Filtered() {
+	target := fmt.Sprintf("/items?inventory=%d&sort=qty&order=desc&per_page=1&page=2", s.initInvs[0].ID)
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	w := httptest.NewRecorder()
+
+	s.h.ListItems(w, asAdmin(req))
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
+	page := s.renderer.Calls[0].Arguments[3].(listItemsPage)
+	s.Equal(int64(2), page.Total)
+	s.Equal(2, page.Pages)
+	s.Require().Equal(1, len(page.Items))
+	s.Equal(s.initItems[0].Name, page.Items[0].Name)
+	s.NotEmpty(page.PrevURL)
+	s.Empty(page.NextURL)
+	exportURL, err := url.Parse(page.ExportURL)
+	s.Require().Nil(err)
+	s.Equal("qty", exportURL.Query().Get("sort"))
+	s.Empty(exportURL.Query().Get("page"))
+}
+
+func (s *ItemHandlerTestSuite) TestListItems_InvalidQuery() {
+	req := httptest.NewRequest(http.MethodGet, "/items?sort=password", nil)
+	w := httptest.NewRecorder()
+
+	s.h.ListItems(w, asAdmin(req))
+
+	s.Equal(http.StatusBadRequest, w.Result().StatusCode)
+	s.renderer.AssertNumberOfCalls(s.T(), "Render", 0)
+}
+
+func (s *ItemHandlerTestSuite) TestExportCSV_Filtered() {
+	req := httptest.NewRequest(http.MethodGet, "/items/csv?q=smartphone", nil)
+	w := httptest.NewRecorder()
+
+	s.h.ExportCSV(w, asAdmin(req))
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	s.Require().Equal(2, len(lines))
+	s.Contains(lines[1], "iPhone 13")
+	s.Contains(lines[1], s.initInvs[2].Name)
+}
+
+// createVariants creates a T-shirt product with a variant in School, a
+// variant in Phones and a variant in School again.
+func (s *ItemHandlerTestSuite) createVariants() models.Product {
+	product, err := (&models.ProductRepository{DB: s.db}).Create(models.Product{
+		Name:    "T-shirt",
+		Options: models.OptionNames{"Size", "Color"},
+	})
+	s.Require().Nil(err)
+	variants := []models.Item{
+		{Name: "T-shirt S", SKU: "T-SHIRT-S", InventoryID: s.initInvs[0].ID, Quantity: 2,
+			Options: models.OptionValues{"Size": "S", "Color": "Red"}},
+		{Name: "T-shirt M", SKU: "T-SHIRT-M", InventoryID: s.initInvs[2].ID, Quantity: 4,
+			Options: models.OptionValues{"Size": "M", "Color": "Red"}},
+		{Name: "T-shirt L", SKU: "T-SHIRT-L", InventoryID: s.initInvs[0].ID, Quantity: 1,
+			Options: models.OptionValues{"Size": "L", "Color": "Blue"}},
+	}
+	for _, variant := range variants {
+		variant.ProductID = &product.ID
+		_, err := s.itemRepo.Create(variant)
+		s.Require().Nil(err)
+	}
+	return product
+}
+
+func (s *ItemHandlerTestSuite) TestListItems_GroupsVariants() {
+	product := s.createVariants()
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	w := httptest.NewRecorder()
+
+	s.h.ListItems(w, asAdmin(req))
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	page := s.renderer.Calls[0].Arguments[3].(listItemsPage)
+	s.Require().Equal(len(s.initItems)+1, len(page.Groups))
+	group := page.Groups[len(s.initItems)]
+	s.Require().NotNil(group.Product)
+	s.Equal(product.Name, group.Product.Name)
+	s.Equal(3, len(group.Items))
+	s.Equal(7, group.Quantity)
+	s.Nil(page.Groups[0].Product)
+}
+
+func (s *ItemHandlerTestSuite) TestExportCSV_VariantsRoundTrip() {
+	s.createVariants()
+	req := httptest.NewRequest(http.MethodGet, "/items/csv", nil)
+	w := httptest.NewRecorder()
+
+	s.h.ExportCSV(w, asAdmin(req))
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	exported := w.Body.String()
+	header := strings.SplitN(exported, "\n", 2)[0]
+	s.True(strings.HasSuffix(header, ",product,option:Size,option:Color"), header)
+	s.Contains(exported, ",T-shirt,M,Red\n")
+
+	report, err := s.itemRepo.ImportCSV(strings.NewReader(exported), false, models.FullAccess)
+	s.Require().Nil(err)
+	s.Equal(0, report.Rejected)
+	s.Equal(len(s.initItems)+3, report.Updated)
+	items, err := s.itemRepo.FindAll()
+	s.Require().Nil(err)
+	s.Equal(models.OptionValues{"Size": "L", "Color": "Blue"}, items[len(items)-1].Options)
+}
+
+func (s *ItemHandlerTestSuite) createTaggedItems() models.Category {
+	categoryRepo := &models.CategoryRepository{DB: s.db}
+	kitchen, err := categoryRepo.Create(models.Category{Name: "Kitchen"})
+	s.Require().Nil(err)
+	cups, err := categoryRepo.Create(models.Category{Name: "Cups", ParentID: &kitchen.ID})
+	s.Require().Nil(err)
+	_, err = s.itemRepo.Create(models.Item{Name: "Mug", SKU: "MUG", InventoryID: s.initInvs[0].ID, Quantity: 2,
+		CategoryID: &cups.ID, Tags: []models.Tag{{Name: "fragile"}, {Name: "sale"}}})
+	s.Require().Nil(err)
+	_, err = s.itemRepo.Create(models.Item{Name: "Pan", SKU: "PAN", InventoryID: s.initInvs[0].ID, Quantity: 1,
+		CategoryID: &kitchen.ID, Tags: []models.Tag{{Name: "sale"}}})
+	s.Require().Nil(err)
+	return kitchen
+}
+
+func (s *ItemHandlerTestSuite) TestListItems_Facets() {
+	kitchen := s.createTaggedItems()
+	req := httptest.NewRequest(http.MethodGet, "/items?tag=fragile", nil)
+	w := httptest.NewRecorder()
+
+	s.h.ListItems(w, asAdmin(req))
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	page := s.renderer.Calls[0].Arguments[3].(listItemsPage)
+	s.Require().Equal(1, len(page.Items))
+	s.Equal("Mug", page.Items[0].Name)
+	s.Require().Equal(2, len(page.CategoryFacets))
+	s.Equal("Kitchen", page.CategoryFacets[0].Label)
+	s.Equal(int64(1), page.CategoryFacets[0].Count)
+	s.Contains(page.CategoryFacets[0].URL, "category="+strconv.Itoa(int(kitchen.ID)))
+	s.Contains(page.CategoryFacets[0].URL, "tag=fragile")
+	s.Equal("Kitchen / Cups", page.CategoryFacets[1].Label)
+	s.Require().Equal(2, len(page.TagFacets))
+	s.True(page.TagFacets[0].Active)
+	s.NotContains(page.ClearTagURL, "tag=")
+
+	s.renderer.Calls = nil
+	req = httptest.NewRequest(http.MethodGet, "/items?category="+strconv.Itoa(int(kitchen.ID)), nil)
+	s.h.ListItems(httptest.NewRecorder(), asAdmin(req))
+	page = s.renderer.Calls[0].Arguments[3].(listItemsPage)
+	s.Equal(2, len(page.Items))
+	s.Equal([]facetLink{
+		{Label: "sale", Count: 2, URL: page.TagFacets[0].URL},
+		{Label: "fragile", Count: 1, URL: page.TagFacets[1].URL},
+	}, page.TagFacets)
+}
+
+func (s *ItemHandlerTestSuite) TestExportCSV_TagsRoundTrip() {
+	s.createTaggedItems()
+	req := httptest.NewRequest(http.MethodGet, "/items/csv", nil)
+	w := httptest.NewRecorder()
+
+	s.h.ExportCSV(w, asAdmin(req))
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	exported := w.Body.String()
+	s.Contains(strings.SplitN(exported, "\n", 2)[0], ",tags,product")
+	s.Contains(exported, `"fragile, sale"`)
+
+	// Tags of the export replace the current tags on import.
+	exported = strings.Replace(exported, `"fragile, sale"`, "kitchen", 1)
+	report, err := s.itemRepo.ImportCSV(strings.NewReader(exported), false, models.FullAccess)
+	s.Require().Nil(err)
+	s.Equal(0, report.Rejected)
+	items, _, err := s.itemRepo.Find(models.ItemQuery{Tag: "kitchen"}, models.WithTags())
+	s.Require().Nil(err)
+	s.Require().Equal(1, len(items))
+	s.Equal("Mug", items[0].Name)
+	s.Equal([]string{"kitchen"}, models.TagNames(items[0].Tags))
+}
+
 func makeItemPostForm(item models.Item) url.Values {
 	form := url.Values{}
 	form.Add("itemName", item.Name)
 	form.Add("itemDescription", item.Description)
+	form.Add("itemSKU", item.SKU)
 	form.Add("itemQuantity", strconv.Itoa(item.Quantity))
 	form.Add("itemInventory", strconv.Itoa(int(item.InventoryID)))
+	if item.Version != 0 {
+		form.Add("itemVersion", strconv.Itoa(int(item.Version)))
+	}
 	return form
 }
 
 func (s *ItemHandlerTestSuite) TestPostCreateItem_Successful() {
 	item := models.Item{
 		Name:        "test",
+		SKU:         "TEST",
 		Description: "test test",
 		Quantity:    10,
 		InventoryID: s.initInvs[2].ID,
@@ -151,7 +351,7 @@ func (s *ItemHandlerTestSuite) TestPostCreateItem_Successful() {
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	w := httptest.NewRecorder()
 
-	s.h.PostCreateItem(w, req)
+	s.h.PostCreateItem(w, asAdmin(req))
 
 	resp := w.Result()
 	s.Equal(resp.StatusCode, http.StatusFound)
@@ -164,6 +364,7 @@ func (s *ItemHandlerTestSuite) TestPostCreateItem_Successful() {
 
 func (s *ItemHandlerTestSuite) TestPostCreateItem_NoName() {
 	item := models.Item{
+		SKU:         "TEST",
 		Description: "test test",
 		Quantity:    10,
 		InventoryID: s.initInvs[2].ID,
@@ -174,12 +375,12 @@ func (s *ItemHandlerTestSuite) TestPostCreateItem_NoName() {
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	w := httptest.NewRecorder()
 
-	s.h.PostCreateItem(w, req)
+	s.h.PostCreateItem(w, asAdmin(req))
 
 	resp := w.Result()
 	s.Equal(resp.StatusCode, http.StatusOK, "status must be ok")
 	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
-	calledEditItemPage := s.renderer.Calls[0].Arguments[2].(editItemPage)
+	calledEditItemPage := s.renderer.Calls[0].Arguments[3].(editItemPage)
 	s.NotNil(calledEditItemPage.Error)
 }
 
@@ -194,7 +395,7 @@ func (s *ItemHandlerTestSuite) TestPostEditItem_Successful() {
 	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(item.ID))})
 	w := httptest.NewRecorder()
 
-	s.h.PostEditItem(w, req)
+	s.h.PostEditItem(w, asAdmin(req))
 
 	resp := w.Result()
 	s.Equal(resp.StatusCode, http.StatusFound)
@@ -205,6 +406,38 @@ func (s *ItemHandlerTestSuite) TestPostEditItem_Successful() {
 	s.Equal(item.Quantity, retItem.Quantity)
 }
 
+func (s *ItemHandlerTestSuite) TestPostEditItem_Conflict() {
+	item := s.initItems[1]
+	changed := item
+	changed.Name = "changed"
+	_, err := s.itemRepo.Update(changed)
+	s.Require().Nil(err)
+
+	item.Description = "stale edit"
+	data := makeItemPostForm(item)
+	target := fmt.Sprintf("/items/%d/edit", item.ID)
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(data.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(item.ID))})
+	w := httptest.NewRecorder()
+
+	s.h.PostEditItem(w, asAdmin(req))
+
+	resp := w.Result()
+	s.Equal(http.StatusConflict, resp.StatusCode)
+	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
+	s.Equal("conflict.html", s.renderer.Calls[0].Arguments[2])
+	page := s.renderer.Calls[0].Arguments[3].(conflictItemPage)
+	s.Equal("changed", page.Current.Name)
+	s.Equal(item.Version+1, page.Current.Version)
+	s.Equal("stale edit", page.Submitted.Description)
+
+	retItem, err := s.itemRepo.FindByID(item.ID)
+	s.Require().Nil(err)
+	s.Equal("changed", retItem.Name)
+	s.Equal(s.initItems[1].Description, retItem.Description)
+}
+
 func (s *ItemHandlerTestSuite) TestPostEditItem_NotFound() {
 	id := 100
 	target := fmt.Sprintf("/items/%d/edit", id)
@@ -213,12 +446,197 @@ func (s *ItemHandlerTestSuite) TestPostEditItem_NotFound() {
 	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(id)})
 	w := httptest.NewRecorder()
 
-	s.h.PostEditItem(w, req)
+	s.h.PostEditItem(w, asAdmin(req))
 
 	resp := w.Result()
 	s.Equal(resp.StatusCode, http.StatusNotFound)
 }
 
+func (s *ItemHandlerTestSuite) TestImportCSV_DryRun() {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "items.csv")
+	s.Require().Nil(err)
+	_, err = fw.Write([]byte("name,sku,inventory,qty\nRuler,RULER,School,4\n"))
+	s.Require().Nil(err)
+	s.Require().Nil(mw.WriteField("dryRun", "1"))
+	s.Require().Nil(mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/items/csv", &body)
+	req.Header.Add("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	s.h.ImportCSV(w, asAdmin(req))
+
+	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
+	page := s.renderer.Calls[0].Arguments[3].(importItemsPage)
+	s.Nil(page.Error)
+	s.Require().NotNil(page.Report)
+	s.Equal(1, page.Report.Created)
+	s.True(page.Report.DryRun)
+
+	items, err := s.itemRepo.FindAll()
+	s.Require().Nil(err)
+	s.Equal(len(s.initItems), len(items))
+}
+
+// postWithCSRF posts the given form to the routes of the handler through the
+// CSRF middleware, as a signed in admin.
+func (s *ItemHandlerTestSuite) postWithCSRF(target string, form url.Values) *http.Response {
+	router := mux.NewRouter()
+	s.h.HandleFuncs(router)
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: "session token"})
+	w := httptest.NewRecorder()
+	NewCSRF(false).Middleware(router).ServeHTTP(w, asAdmin(req))
+	return w.Result()
+}
+
+func (s *ItemHandlerTestSuite) TestDeleteItem_CSRF() {
+	target := fmt.Sprintf("/items/%d/delete", s.initItems[0].ID)
+	resp := s.postWithCSRF(target, url.Values{})
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+	_, err := s.itemRepo.FindByID(s.initItems[0].ID)
+	s.Nil(err, "the item is kept")
+
+	form := url.Values{}
+	form.Add(CSRFFieldName, csrfToken("session token"))
+	resp = s.postWithCSRF(target, form)
+	s.Equal(http.StatusFound, resp.StatusCode)
+	_, err = s.itemRepo.FindByID(s.initItems[0].ID)
+	s.ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
+func (s *ItemHandlerTestSuite) TestRestoreItem() {
+	item := s.initItems[0]
+	s.Require().Nil(s.itemRepo.DeleteByID(item.ID))
+
+	target := fmt.Sprintf("/items/%d/restore", item.ID)
+	req := httptest.NewRequest(http.MethodPost, target, nil)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(item.ID))})
+	w := httptest.NewRecorder()
+
+	s.h.RestoreItem(w, asAdmin(req))
+
+	s.Equal(http.StatusFound, w.Result().StatusCode)
+	_, err := s.itemRepo.FindByID(item.ID)
+	s.Nil(err)
+}
+
+func (s *ItemHandlerTestSuite) TestLookupItem() {
+	item := s.initItems[1]
+	barcode := "4006381333931"
+	item.SKU, item.Barcode = "BP-11", &barcode
+	_, err := s.itemRepo.Update(item)
+	s.Require().Nil(err)
+
+	for _, code := range []string{"BP-11", "4006381333931"} {
+		req := httptest.NewRequest(http.MethodGet, "/items/lookup?code="+code, nil)
+		w := httptest.NewRecorder()
+		s.h.LookupItem(w, asAdmin(req))
+		s.Equal(http.StatusFound, w.Result().StatusCode, code)
+		s.Equal(fmt.Sprintf("/items/%d/movements?scan=1", item.ID), w.Result().Header.Get("Location"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/items/lookup?code=BP-12", nil)
+	w := httptest.NewRecorder()
+	s.h.LookupItem(w, asAdmin(req))
+	s.Equal(http.StatusNotFound, w.Result().StatusCode)
+	s.Equal("scan.html", s.renderer.Calls[0].Arguments[2])
+	s.NotNil(s.renderer.Calls[0].Arguments[3].(scanPage).Error)
+}
+
+func (s *ItemHandlerTestSuite) TestPostEditItem_InvalidBarcode() {
+	item := s.initItems[0]
+	data := makeItemPostForm(item)
+	data.Set("itemBarcode", "4006381333932")
+	target := fmt.Sprintf("/items/%d/edit", item.ID)
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(data.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(item.ID))})
+	w := httptest.NewRecorder()
+
+	s.h.PostEditItem(w, asAdmin(req))
+
+	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
+	page := s.renderer.Calls[0].Arguments[3].(editItemPage)
+	s.ErrorIs(page.Error, models.ErrInvalidBarcode)
+}
+
 func TestItemHandlerTestSuite(t *testing.T) {
 	suite.Run(t, new(ItemHandlerTestSuite))
 }
+
+// countQueries counts the queries run through the given database.
+func countQueries(db *gorm.DB) *int {
+	count := new(int)
+	err := db.Callback().Query().After("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		*count++
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return count
+}
+
+// BenchmarkItemHandler_QueryCount measures the list and export paths with a
+// growing number of items. Both must issue a constant number of queries.
+func BenchmarkItemHandler_QueryCount(b *testing.B) {
+	paths := []struct {
+		name    string
+		target  string
+		handler func(h *ItemHandler) http.HandlerFunc
+	}{
+		{"ListItems", "/items?per_page=500", func(h *ItemHandler) http.HandlerFunc { return h.ListItems }},
+		{"ExportCSV", "/items/csv", func(h *ItemHandler) http.HandlerFunc { return h.ExportCSV }},
+	}
+
+	for _, path := range paths {
+		queriesPerOp := -1
+		for _, n := range []int{10, 100, 500} {
+			b.Run(fmt.Sprintf("%s/items=%d", path.name, n), func(b *testing.B) {
+				db, err := models.Open("sqlite://:memory:", &gorm.Config{
+					Logger: logger.Default.LogMode(logger.Silent),
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := models.Migrate(db); err != nil {
+					b.Fatal(err)
+				}
+				invs, _, err := fillInitialData(db)
+				if err != nil {
+					b.Fatal(err)
+				}
+				items := make([]models.Item, n)
+				for i := range items {
+					items[i] = models.Item{Name: fmt.Sprintf("item %d", i), SKU: fmt.Sprintf("ITEM-%d", i), InventoryID: invs[i%len(invs)].ID}
+				}
+				if err := db.CreateInBatches(items, 100).Error; err != nil {
+					b.Fatal(err)
+				}
+
+				renderer := &mockedRenderer{}
+				renderer.On("Render", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				h := NewItemHandler(&models.ItemRepository{DB: db}, &models.InventoryRepository{DB: db},
+					&models.ProductRepository{DB: db}, &models.CategoryRepository{DB: db}, renderer)
+				count := countQueries(db)
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					path.handler(h)(httptest.NewRecorder(), asAdmin(httptest.NewRequest(http.MethodGet, path.target, nil)))
+				}
+				b.StopTimer()
+
+				perOp := *count / b.N
+				b.ReportMetric(float64(perOp), "queries/op")
+				if queriesPerOp == -1 {
+					queriesPerOp = perOp
+				} else if perOp != queriesPerOp {
+					b.Fatalf("%d queries/op with %d items, want %d", perOp, n, queriesPerOp)
+				}
+			})
+		}
+	}
+}
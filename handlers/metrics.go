@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shayanh/shopify-challenge-2022/models"
+)
+
+// MetricsHandler exposes the metrics of the server in the Prometheus text
+// format, together with gauges of the stock of all inventories.
+type MetricsHandler struct {
+	handler http.Handler
+}
+
+// NewMetricsHandler registers the stock gauges with the given registry and
+// serves its metrics.
+func NewMetricsHandler(registry *prometheus.Registry, invRepo *models.InventoryRepository) *MetricsHandler {
+	registry.MustRegister(newStockCollector(invRepo))
+	return &MetricsHandler{handler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{})}
+}
+
+// stockCollector reports the stock gauges, which are refreshed with a single
+// query on every scrape.
+type stockCollector struct {
+	invRepo *models.InventoryRepository
+
+	items      *prometheus.Desc
+	units      *prometheus.Desc
+	outOfStock *prometheus.Desc
+}
+
+func newStockCollector(invRepo *models.InventoryRepository) *stockCollector {
+	return &stockCollector{
+		invRepo: invRepo,
+		items:   prometheus.NewDesc("inventory_items", "Number of items.", nil, nil),
+		units: prometheus.NewDesc("inventory_units", "Number of units in stock per inventory.",
+			[]string{"inventory_id", "inventory"}, nil),
+		outOfStock: prometheus.NewDesc("inventory_items_out_of_stock", "Number of items at zero stock.", nil, nil),
+	}
+}
+
+func (c *stockCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.items
+	ch <- c.units
+	ch <- c.outOfStock
+}
+
+// Collect fails the scrape if the stock cannot be read.
+func (c *stockCollector) Collect(ch chan<- prometheus.Metric) {
+	stock, err := c.invRepo.Stock()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.items, err)
+		return
+	}
+	var items, outOfStock int64
+	for _, inv := range stock {
+		items += inv.Items
+		outOfStock += inv.OutOfStock
+		ch <- prometheus.MustNewConstMetric(c.units, prometheus.GaugeValue, float64(inv.Units),
+			strconv.FormatUint(uint64(inv.InventoryID), 10), inv.Name)
+	}
+	ch <- prometheus.MustNewConstMetric(c.items, prometheus.GaugeValue, float64(items))
+	ch <- prometheus.MustNewConstMetric(c.outOfStock, prometheus.GaugeValue, float64(outOfStock))
+}
+
+// Metrics writes the metrics. They cover all inventories, so only admins can
+// read them. Prometheus authenticates with the access token of an admin.
+func (h *MetricsHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	if !access.Admin {
+		http.Error(w, models.ErrPermissionDenied.Error(), http.StatusForbidden)
+		return
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// HandleFuncs registers related handlers into a given Router.
+func (h *MetricsHandler) HandleFuncs(router *mux.Router) {
+	router.HandleFunc("/metrics", h.Metrics).Methods(http.MethodGet).Name("metrics")
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type MetricsHandlerTestSuite struct {
+	suite.Suite
+
+	db *gorm.DB
+	h  *MetricsHandler
+
+	initInvs  []models.Inventory
+	initItems []models.Item
+}
+
+func (s *MetricsHandlerTestSuite) SetupTest() {
+	var err error
+	s.db, err = models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = models.Migrate(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.initInvs, s.initItems, err = fillInitialData(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.h = NewMetricsHandler(prometheus.NewRegistry(), &models.InventoryRepository{DB: s.db})
+}
+
+func (s *MetricsHandlerTestSuite) TearDownTest() {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *MetricsHandlerTestSuite) TestMetrics() {
+	item := s.initItems[2]
+	_, err := (&models.StockMovementRepository{DB: s.db}).Record(item.ID, models.ReasonCount, 0, "")
+	s.Require().Nil(err)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	s.h.Metrics(w, asAdmin(req))
+
+	s.Equal(http.StatusOK, w.Code)
+	body := w.Body.String()
+	s.Contains(body, "inventory_items 4\n")
+	s.Contains(body, `inventory_units{inventory="School",inventory_id="1"} 19`)
+	s.Contains(body, `inventory_units{inventory="Software",inventory_id="2"} 0`)
+	s.Contains(body, "inventory_items_out_of_stock 1\n")
+}
+
+func (s *MetricsHandlerTestSuite) TestMetrics_DatabaseDown() {
+	sqlDB, err := s.db.DB()
+	s.Require().Nil(err)
+	s.Require().Nil(sqlDB.Close())
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	s.h.Metrics(w, asAdmin(req))
+
+	s.Equal(http.StatusInternalServerError, w.Code)
+}
+
+func (s *MetricsHandlerTestSuite) TestMetrics_Forbidden() {
+	access := models.Access{Roles: map[uint]models.Role{s.initInvs[0].ID: models.RoleManager}}
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req = req.WithContext(withAccess(req.Context(), access))
+	w := httptest.NewRecorder()
+	s.h.Metrics(w, req)
+
+	s.Equal(http.StatusForbidden, w.Code)
+}
+
+func TestMetricsHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(MetricsHandlerTestSuite))
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/logging"
+	"github.com/shayanh/shopify-challenge-2022/models"
+)
+
+// StockMovementHandler implements web handlers of the stock ledger.
+type StockMovementHandler struct {
+	itemRepo     *models.ItemRepository
+	movementRepo *models.StockMovementRepository
+	renderer     Renderer
+}
+
+func NewStockMovementHandler(itemRepo *models.ItemRepository, movementRepo *models.StockMovementRepository,
+	renderer Renderer) *StockMovementHandler {
+	return &StockMovementHandler{
+		itemRepo:     itemRepo,
+		movementRepo: movementRepo,
+		renderer:     renderer,
+	}
+}
+
+type itemMovementsPage struct {
+	Item      models.Item
+	Movements []models.StockMovement
+	Reasons   []models.MovementReason
+	// At and QuantityAt hold the result of a point in time quantity query.
+	At         *time.Time
+	QuantityAt int
+	// Scan is set when the item was found from the scan page. The amount then
+	// gets the focus and recording a movement returns to the scan page.
+	Scan  bool
+	Error error
+}
+
+func (h *StockMovementHandler) renderMovementsPage(w http.ResponseWriter, r *http.Request, page itemMovementsPage) {
+	movements, err := h.movementRepo.WithContext(r.Context()).FindByItemID(page.Item.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page.Movements = movements
+	page.Reasons = models.MovementReasons
+	h.renderer.Render(w, r, "movements.html", page)
+}
+
+// ListItemMovements shows the movement history of an item. With the at query
+// parameter (YYYY-MM-DD) it also shows the quantity at the end of that day.
+func (h *StockMovementHandler) ListItemMovements(w http.ResponseWriter, r *http.Request) {
+	item, _, ok := findAccessibleItem(w, r, http.Error, h.itemRepo, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	page := itemMovementsPage{Item: item, Scan: r.URL.Query().Get("scan") != ""}
+	if at := r.URL.Query().Get("at"); at != "" {
+		day, err := time.ParseInLocation("2006-01-02", at, time.Local)
+		if err != nil {
+			page.Error = errors.New("invalid date")
+		} else {
+			end := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			page.At = &end
+			page.QuantityAt, page.Error = h.movementRepo.WithContext(r.Context()).QuantityAt(item.ID, end)
+		}
+	}
+	h.renderMovementsPage(w, r, page)
+}
+
+// PostItemMovement records a stock movement of an item. It needs the clerk
+// role in the inventory of the item.
+func (h *StockMovementHandler) PostItemMovement(w http.ResponseWriter, r *http.Request) {
+	item, _, ok := findAccessibleItem(w, r, http.Error, h.itemRepo, models.RoleClerk)
+	if !ok {
+		return
+	}
+
+	_ = r.ParseForm()
+	scan := r.FormValue("scan") != ""
+	reason := models.MovementReason(r.FormValue("movementReason"))
+	amount, err := strconv.Atoi(r.FormValue("movementAmount"))
+	if err != nil {
+		h.renderMovementsPage(w, r, itemMovementsPage{Item: item, Scan: scan, Error: errors.New("invalid amount")})
+		return
+	}
+
+	movement, err := h.movementRepo.WithContext(r.Context()).Record(item.ID, reason, amount, r.FormValue("movementNote"))
+	if err != nil {
+		h.renderMovementsPage(w, r, itemMovementsPage{Item: item, Scan: scan, Error: err})
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Recorded %+d of '%s', %d in stock",
+		movement.Delta, item.Name, movement.QuantityAfter)
+	if scan {
+		http.Redirect(w, r, "/items/scan", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/items/%d/movements", item.ID), http.StatusFound)
+}
+
+// ExportCSV writes the stock ledger of the inventories the user can see as
+// CSV.
+func (h *StockMovementHandler) ExportCSV(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	movements, err := h.movementRepo.WithContext(r.Context()).FindAll(models.WithItem(),
+		access.Movements(models.RoleViewer))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	records := [][]string{
+		{"id", "created_at", "item_id", "item_name", "reason", "delta", "quantity_after", "note"},
+	}
+	for _, m := range movements {
+		record := []string{
+			strconv.Itoa(int(m.ID)), m.CreatedAt.Format(time.RFC3339),
+			strconv.Itoa(int(m.ItemID)), m.Item.Name, string(m.Reason),
+			strconv.Itoa(m.Delta), strconv.Itoa(m.QuantityAfter), m.Note,
+		}
+		records = append(records, record)
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="movements.csv"`)
+	csvWriter := csv.NewWriter(w)
+	for _, record := range records {
+		if err := csvWriter.Write(record); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		logging.Error(r.Context(), "Writing CSV failed", "error", err)
+	}
+}
+
+// HandleFuncs registers related handlers into a given Router.
+func (h *StockMovementHandler) HandleFuncs(router *mux.Router) {
+	router.HandleFunc("/items/{id:[0-9]+}/movements", h.ListItemMovements).Methods(http.MethodGet).Name("movements.list")
+	router.HandleFunc("/items/{id:[0-9]+}/movements", h.PostItemMovement).Methods(http.MethodPost).Name("movements.create")
+	router.HandleFunc("/movements/csv", h.ExportCSV).Methods(http.MethodGet).Name("movements.export")
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type StockMovementHandlerTestSuite struct {
+	suite.Suite
+
+	db           *gorm.DB
+	itemRepo     *models.ItemRepository
+	movementRepo *models.StockMovementRepository
+
+	h        *StockMovementHandler
+	renderer *mockedRenderer
+
+	initItems []models.Item
+}
+
+func (s *StockMovementHandlerTestSuite) SetupTest() {
+	var err error
+	s.db, err = models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = models.Migrate(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, s.initItems, err = fillInitialData(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.itemRepo = &models.ItemRepository{DB: s.db}
+	s.movementRepo = &models.StockMovementRepository{DB: s.db}
+	s.renderer = &mockedRenderer{}
+	s.renderer.On("Render", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.h = NewStockMovementHandler(s.itemRepo, s.movementRepo, s.renderer)
+}
+
+func (s *StockMovementHandlerTestSuite) TearDownTest() {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *StockMovementHandlerTestSuite) postMovement(item models.Item, reason models.MovementReason,
+	amount int) *http.Response {
+	form := url.Values{}
+	form.Add("movementReason", string(reason))
+	form.Add("movementAmount", strconv.Itoa(amount))
+	target := fmt.Sprintf("/items/%d/movements", item.ID)
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(item.ID))})
+	w := httptest.NewRecorder()
+
+	s.h.PostItemMovement(w, asAdmin(req))
+	return w.Result()
+}
+
+func (s *StockMovementHandlerTestSuite) TestPostItemMovement_Successful() {
+	item := s.initItems[0]
+	resp := s.postMovement(item, models.ReasonReceive, 5)
+
+	s.Equal(http.StatusFound, resp.StatusCode)
+	retItem, err := s.itemRepo.FindByID(item.ID)
+	s.Require().Nil(err)
+	s.Equal(item.Quantity+5, retItem.Quantity)
+}
+
+func (s *StockMovementHandlerTestSuite) TestPostItemMovement_NegativeStock() {
+	item := s.initItems[0]
+	resp := s.postMovement(item, models.ReasonShip, item.Quantity+1)
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.renderer.AssertNumberOfCalls(s.T(), "Render", 1)
+	page := s.renderer.Calls[0].Arguments[3].(itemMovementsPage)
+	s.ErrorIs(page.Error, models.ErrNegativeStock)
+	s.Equal(1, len(page.Movements))
+}
+
+func (s *StockMovementHandlerTestSuite) TestPostItemMovement_Scan() {
+	item := s.initItems[0]
+	form := url.Values{}
+	form.Add("movementReason", string(models.ReasonReceive))
+	form.Add("movementAmount", "2")
+	form.Add("scan", "1")
+	target := fmt.Sprintf("/items/%d/movements", item.ID)
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(item.ID))})
+	w := httptest.NewRecorder()
+
+	s.h.PostItemMovement(w, asAdmin(req))
+
+	s.Equal(http.StatusFound, w.Result().StatusCode)
+	s.Equal("/items/scan", w.Result().Header.Get("Location"))
+}
+
+func (s *StockMovementHandlerTestSuite) TestExportCSV() {
+	req := httptest.NewRequest(http.MethodGet, "/movements/csv", nil)
+	w := httptest.NewRecorder()
+
+	s.h.ExportCSV(w, asAdmin(req))
+
+	s.Equal(http.StatusOK, w.Result().StatusCode)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	s.Equal(len(s.initItems)+1, len(lines))
+}
+
+func TestStockMovementHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(StockMovementHandlerTestSuite))
+}
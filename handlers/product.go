@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/shayanh/shopify-challenge-2022/models"
+)
+
+// ProductHandler implements web handlers related to Product entity, the
+// parents of item variants.
+type ProductHandler struct {
+	productRepo *models.ProductRepository
+	renderer    Renderer
+}
+
+func NewProductHandler(productRepo *models.ProductRepository, renderer Renderer) *ProductHandler {
+	return &ProductHandler{
+		productRepo: productRepo,
+		renderer:    renderer,
+	}
+}
+
+type productRow struct {
+	models.Product
+	// VariantCount is the number of variants in the inventories the user can
+	// see.
+	VariantCount int64
+}
+
+type listProductsPage struct {
+	Products []productRow
+	// CanCreate is set for users who manage at least one inventory.
+	CanCreate bool
+	// Product holds the values of a rejected create form.
+	Product models.Product
+	Error   error
+}
+
+// ListProducts lists all products together with the number of their
+// variants.
+func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	h.renderProducts(w, r, access, listProductsPage{})
+}
+
+func (h *ProductHandler) renderProducts(w http.ResponseWriter, r *http.Request, access models.Access,
+	page listProductsPage) {
+	products, err := h.productRepo.WithContext(r.Context()).FindAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	counts, err := h.productRepo.WithContext(r.Context()).CountVariants(access.Items(models.RoleViewer))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, product := range products {
+		page.Products = append(page.Products, productRow{Product: product, VariantCount: counts[product.ID]})
+	}
+	page.CanCreate = access.CanAny(models.RoleManager)
+	h.renderer.Render(w, r, "products.html", page)
+}
+
+// PostCreateProduct creates a product. Only managers of some inventory
+// create products.
+func (h *ProductHandler) PostCreateProduct(w http.ResponseWriter, r *http.Request) {
+	access, ok := requireAccess(w, r, http.Error)
+	if !ok {
+		return
+	}
+	if !access.CanAny(models.RoleManager) {
+		http.Error(w, models.ErrPermissionDenied.Error(), http.StatusForbidden)
+		return
+	}
+
+	_ = r.ParseForm()
+	product := models.Product{
+		Name:        r.FormValue("productName"),
+		Description: r.FormValue("productDescription"),
+	}
+	var err error
+	product.Options, err = models.ParseOptionNames(r.FormValue("productOptions"))
+	if err == nil {
+		_, err = h.productRepo.WithContext(r.Context()).Create(product)
+	}
+	if err != nil {
+		h.renderProducts(w, r, access, listProductsPage{Product: product, Error: err})
+		return
+	}
+	addFlash(r, models.FlashSuccess, "Product '%s' created", product.Name)
+	http.Redirect(w, r, "/products", http.StatusFound)
+}
+
+// HandleFuncs registers related handlers into a given Router.
+func (h *ProductHandler) HandleFuncs(router *mux.Router) {
+	router.HandleFunc("/products", h.ListProducts).Methods(http.MethodGet).Name("products.list")
+	router.HandleFunc("/products/create", h.PostCreateProduct).Methods(http.MethodPost).Name("products.create")
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/shayanh/shopify-challenge-2022/web"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type ProductHandlerTestSuite struct {
+	suite.Suite
+
+	db          *gorm.DB
+	productRepo *models.ProductRepository
+
+	h        *ProductHandler
+	renderer *mockedRenderer
+
+	initInvs []models.Inventory
+}
+
+func (s *ProductHandlerTestSuite) SetupTest() {
+	var err error
+	s.db, err = models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = models.Migrate(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.initInvs, _, err = fillInitialData(s.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s.productRepo = &models.ProductRepository{DB: s.db}
+	s.renderer = &mockedRenderer{}
+	s.renderer.On("Render", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.h = NewProductHandler(s.productRepo, s.renderer)
+}
+
+func (s *ProductHandlerTestSuite) TearDownTest() {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *ProductHandlerTestSuite) postCreateProduct(name, options string, access models.Access) *http.Response {
+	form := url.Values{}
+	form.Add("productName", name)
+	form.Add("productOptions", options)
+	req := httptest.NewRequest(http.MethodPost, "/products/create", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(withAccess(req.Context(), access))
+	w := httptest.NewRecorder()
+	s.h.PostCreateProduct(w, req)
+	return w.Result()
+}
+
+func (s *ProductHandlerTestSuite) TestPostCreateProduct() {
+	resp := s.postCreateProduct("T-shirt", "Size, Color", models.FullAccess)
+	s.Equal(http.StatusFound, resp.StatusCode)
+	products, err := s.productRepo.FindAll()
+	s.Require().Nil(err)
+	s.Require().Equal(1, len(products))
+	s.Equal(models.OptionNames{"Size", "Color"}, products[0].Options)
+
+	resp = s.postCreateProduct("Mug", "Size, Size", models.FullAccess)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	page := s.renderer.Calls[0].Arguments[3].(listProductsPage)
+	s.ErrorIs(page.Error, models.ErrInvalidOptions)
+	s.Equal("Mug", page.Product.Name)
+	s.Equal(1, len(page.Products))
+}
+
+func (s *ProductHandlerTestSuite) TestPostCreateProduct_Forbidden() {
+	access := models.Access{Roles: map[uint]models.Role{s.initInvs[0].ID: models.RoleClerk}}
+	resp := s.postCreateProduct("T-shirt", "Size", access)
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+}
+
+func (s *ProductHandlerTestSuite) TestRenderTemplates() {
+	renderer, err := NewHTMLRenderer(web.Templates(), nil, false)
+	s.Require().Nil(err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	product, err := s.productRepo.Create(models.Product{Name: "T-shirt", Options: models.OptionNames{"Size"}})
+	s.Require().Nil(err)
+
+	w := httptest.NewRecorder()
+	renderer.Render(w, r, "products.html", listProductsPage{
+		Products:  []productRow{{Product: product, VariantCount: 2}},
+		CanCreate: true,
+	})
+	s.Equal(http.StatusOK, w.Code)
+	s.Contains(w.Body.String(), "T-shirt")
+
+	w = httptest.NewRecorder()
+	renderer.Render(w, r, "edit.html", editItemPage{
+		Products:  []models.Product{product},
+		ProductID: product.ID,
+		Item:      models.Item{ProductID: &product.ID, Options: models.OptionValues{"Size": "M"}},
+	})
+	s.Equal(http.StatusOK, w.Code)
+	s.Contains(w.Body.String(), `value="Size=M"`)
+
+	w = httptest.NewRecorder()
+	item := models.Item{Name: "T-shirt M", SKU: "T-SHIRT-M", ProductID: &product.ID, Product: &product,
+		Options: models.OptionValues{"Size": "M"}}
+	renderer.Render(w, r, "list.html", listItemsPage{
+		Items:  []models.Item{item},
+		Groups: groupItems([]models.Item{item}),
+	})
+	s.Equal(http.StatusOK, w.Code)
+	s.Contains(w.Body.String(), "Size: M")
+}
+
+func TestProductHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(ProductHandlerTestSuite))
+}
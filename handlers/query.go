@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/shayanh/shopify-challenge-2022/models"
+)
+
+// parseItemQuery reads the search, filter, sort and pagination parameters of
+// the item list from the given URL query.
+func parseItemQuery(values url.Values) (models.ItemQuery, error) {
+	q := models.ItemQuery{
+		Search: values.Get("q"),
+		Tag:    values.Get("tag"),
+		SortBy: values.Get("sort"),
+	}
+
+	parseInt := func(key string, min int) (*int, error) {
+		str := values.Get(key)
+		if str == "" {
+			return nil, nil
+		}
+		v, err := strconv.Atoi(str)
+		if err != nil || v < min {
+			return nil, errors.New("invalid " + key)
+		}
+		return &v, nil
+	}
+
+	inv, err := parseInt("inventory", 0)
+	if err != nil {
+		return q, err
+	}
+	if inv != nil {
+		q.InventoryID = uint(*inv)
+	}
+	category, err := parseInt("category", 0)
+	if err != nil {
+		return q, err
+	}
+	if category != nil {
+		q.CategoryID = uint(*category)
+	}
+	if q.MinQuantity, err = parseInt("min_qty", 0); err != nil {
+		return q, err
+	}
+	if q.MaxQuantity, err = parseInt("max_qty", 0); err != nil {
+		return q, err
+	}
+
+	if q.SortBy != "" {
+		if _, ok := models.ItemSortColumns[q.SortBy]; !ok {
+			return q, errors.New("invalid sort")
+		}
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.SortDesc = true
+	default:
+		return q, errors.New("invalid order")
+	}
+
+	page, err := parseInt("page", 1)
+	if err != nil {
+		return q, err
+	}
+	if page != nil {
+		q.Page = *page
+	}
+	perPage, err := parseInt("per_page", 1)
+	if err != nil {
+		return q, err
+	}
+	if perPage != nil {
+		q.PageSize = *perPage
+	}
+	return q, nil
+}
+
+// encodeItemQuery is the inverse of parseItemQuery. Pagination is left out,
+// so the result can be used for exports and as the base of page links.
+func encodeItemQuery(q models.ItemQuery) url.Values {
+	values := url.Values{}
+	if q.Search != "" {
+		values.Set("q", q.Search)
+	}
+	if q.InventoryID != 0 {
+		values.Set("inventory", strconv.Itoa(int(q.InventoryID)))
+	}
+	if q.CategoryID != 0 {
+		values.Set("category", strconv.Itoa(int(q.CategoryID)))
+	}
+	if q.Tag != "" {
+		values.Set("tag", q.Tag)
+	}
+	if q.MinQuantity != nil {
+		values.Set("min_qty", strconv.Itoa(*q.MinQuantity))
+	}
+	if q.MaxQuantity != nil {
+		values.Set("max_qty", strconv.Itoa(*q.MaxQuantity))
+	}
+	if q.SortBy != "" {
+		values.Set("sort", q.SortBy)
+	}
+	if q.SortDesc {
+		values.Set("order", "desc")
+	}
+	if q.PageSize != 0 {
+		values.Set("per_page", strconv.Itoa(q.PageSize))
+	}
+	return values
+}
+
+// itemQueryURL returns the URL of the given path with the query encoded.
+func itemQueryURL(path string, q models.ItemQuery, page int) string {
+	values := encodeItemQuery(q)
+	if page > 1 {
+		values.Set("page", strconv.Itoa(page))
+	}
+	if len(values) == 0 {
+		return path
+	}
+	return path + "?" + values.Encode()
+}
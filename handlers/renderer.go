@@ -1,39 +1,194 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"html/template"
+	"io/fs"
 	"net/http"
-	"path/filepath"
+	"path"
+
+	"github.com/shayanh/shopify-challenge-2022/logging"
+	"github.com/shayanh/shopify-challenge-2022/models"
 )
 
 // Renderer renders some output related to the given name and data to the given
-// http response.
+// http response of the given request, with the status of the request.
 type Renderer interface {
-	Render(w http.ResponseWriter, name string, data interface{})
+	Render(w http.ResponseWriter, r *http.Request, name string, data interface{})
+}
+
+// WithStatus returns the request with the status that its page is rendered
+// with, such as http.StatusConflict for a form that has to be submitted again.
+// Handlers cannot write the status themselves, since a page that fails to
+// render is an internal server error instead.
+func WithStatus(r *http.Request, status int) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), statusContextKey, status))
+}
+
+// StatusOf returns the status that the page of the given request is rendered
+// with, which is http.StatusOK unless set with WithStatus.
+func StatusOf(r *http.Request) int {
+	if status, ok := r.Context().Value(statusContextKey).(int); ok {
+		return status
+	}
+	return http.StatusOK
 }
 
+const (
+	// layoutsPattern matches the layouts of the pages. A page uses one by
+	// executing it, and fills its blocks with its own definitions.
+	layoutsPattern = "layouts/*.html"
+	// partialsPattern matches the partials, which are templates that any page
+	// can execute.
+	partialsPattern = "partials/*.html"
+	// pagesPattern matches the pages, which are rendered by the name of their
+	// file.
+	pagesPattern = "*.html"
+)
+
 // HTMLRenderer renders HTML output using templates.
 type HTMLRenderer struct {
-	templates *template.Template
+	fsys   fs.FS
+	static *StaticHandler
+	reload bool
+	pages  map[string]*template.Template
 }
 
-func NewHTMLRenderer(templatesBaseDir string) *HTMLRenderer {
-	templateNames := []string{
-		"list.html",
-		"edit.html",
+// pageView is what pages are executed with. Layouts hand Page to the blocks of
+// the page, so that the blocks see the page data as dot.
+type pageView struct {
+	Page    interface{}
+	Flashes []models.Flash
+}
+
+// NewHTMLRenderer parses the templates of the given file system. Templates
+// link to the files of static with {{ asset "bootstrap/css/bootstrap.min.css" }},
+// which is the versioned URL of the file, or its plain URL if static is nil.
+// With reload, the templates are parsed again on every render, so that edits
+// to them show up without restarting the server.
+func NewHTMLRenderer(fsys fs.FS, static *StaticHandler, reload bool) (*HTMLRenderer, error) {
+	pages, err := parseTemplates(fsys)
+	if err != nil {
+		return nil, err
 	}
-	var templateFileNames []string
-	for _, tn := range templateNames {
-		templateFileNames = append(templateFileNames, filepath.Join(templatesBaseDir, tn))
+	return &HTMLRenderer{fsys: fsys, static: static, reload: reload, pages: pages}, nil
+}
+
+// templateFuncs are the functions of the templates. Their definitions here
+// only serve parsing, Render replaces them with the ones of the request.
+var templateFuncs = template.FuncMap{
+	"asset":     func(name string) string { return StaticPrefix + name },
+	"csrfField": func() template.HTML { return "" },
+}
+
+// parseTemplates parses every page of the given file system on top of its own
+// copy of the layouts and partials, since the pages define the same blocks.
+// The returned pages are never executed, so that they can be cloned.
+func parseTemplates(fsys fs.FS) (map[string]*template.Template, error) {
+	shared := template.New("").Funcs(templateFuncs)
+	for _, pattern := range []string{layoutsPattern, partialsPattern} {
+		if err := parseGlob(shared, fsys, pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	names, err := fs.Glob(fsys, pagesPattern)
+	if err != nil {
+		return nil, fmt.Errorf("parsing templates: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("parsing templates: no pages match %s", pagesPattern)
 	}
-	return &HTMLRenderer{
-		templates: template.Must(template.ParseFiles(templateFileNames...)),
+	pages := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		page, err := shared.Clone()
+		if err != nil {
+			return nil, fmt.Errorf("parsing templates: %w", err)
+		}
+		if err := parseFile(page, fsys, name); err != nil {
+			return nil, err
+		}
+		pages[name] = page
 	}
+	return pages, nil
 }
 
-func (h *HTMLRenderer) Render(w http.ResponseWriter, tmpl string, data interface{}) {
-	err := h.templates.ExecuteTemplate(w, tmpl, data)
+func parseGlob(t *template.Template, fsys fs.FS, pattern string) error {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return fmt.Errorf("parsing templates: %w", err)
+	}
+	for _, name := range names {
+		if err := parseFile(t, fsys, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseFile parses the given file as a template named after the file.
+func parseFile(t *template.Template, fsys fs.FS, name string) error {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return fmt.Errorf("parsing templates: %w", err)
+	}
+	if _, err := t.New(path.Base(name)).Parse(string(b)); err != nil {
+		return fmt.Errorf("parsing templates: %w", err)
+	}
+	return nil
+}
+
+// Render executes a copy of the given page together with the flash messages
+// of the session of the request, which are shown only once. The page is
+// written with the status of the request once it has been executed. If the request
+// went through the CSRF middleware, {{ csrfField }} writes the hidden field of
+// its CSRF token.
+func (h *HTMLRenderer) Render(w http.ResponseWriter, r *http.Request, tmpl string, data interface{}) {
+	pages := h.pages
+	if h.reload {
+		var err error
+		if pages, err = parseTemplates(h.fsys); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	page, ok := pages[tmpl]
+	if !ok {
+		http.Error(w, fmt.Sprintf("no template %q", tmpl), http.StatusInternalServerError)
+		return
+	}
+	page, err := page.Clone()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token, _ := CSRFTokenOf(r)
+	funcs := template.FuncMap{
+		"csrfField": func() template.HTML { return csrfField(token) },
+	}
+	if h.static != nil {
+		funcs["asset"] = h.static.URL
+	}
+	page.Funcs(funcs)
+
+	view := pageView{Page: data}
+	flashes, err := FlashesOf(r)
+	if err != nil {
+		logging.Error(r.Context(), "Reading flash messages failed", "error", err)
+	}
+	view.Flashes = flashes
+
+	var buf bytes.Buffer
+	err = page.ExecuteTemplate(&buf, tmpl, view)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(StatusOf(r))
+	if _, err := buf.WriteTo(w); err != nil {
+		logging.Error(r.Context(), "Writing page failed", "template", tmpl, "error", err)
 	}
 }
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/shayanh/shopify-challenge-2022/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func templatesFS(page string) fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/base.html": {Data: []byte(
+			`{{ define "base" }}<title>{{ block "title" .Page }}Inventory{{ end }}</title>` +
+				`{{ range .Flashes }}[{{ .Kind }}: {{ .Message }}]{{ end }}` +
+				`{{ block "content" .Page }}{{ end }}{{ end }}`)},
+		"partials/greeting.html": {Data: []byte(`{{ define "greeting" }}Hello {{ . }}{{ end }}`)},
+		"page.html":              {Data: []byte(page)},
+		"other.html":             {Data: []byte(`{{ template "base" . }}{{ define "content" }}other{{ end }}`)},
+	}
+}
+
+func render(h *HTMLRenderer, r *http.Request, tmpl string, data interface{}) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	if r == nil {
+		r = httptest.NewRequest(http.MethodGet, "/", nil)
+	}
+	h.Render(w, r, tmpl, data)
+	return w
+}
+
+func TestHTMLRenderer_Layout(t *testing.T) {
+	renderer, err := NewHTMLRenderer(templatesFS(
+		`{{ template "base" . }}{{ define "title" }}Hi {{ .Name }}{{ end }}`+
+			`{{ define "content" }}{{ template "greeting" .Name }}!{{ end }}`), nil, false)
+	require.Nil(t, err)
+
+	w := render(renderer, nil, "page.html", struct{ Name string }{"Alice"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<title>Hi Alice</title>Hello Alice!", w.Body.String())
+	assert.Equal(t, "<title>Inventory</title>other", render(renderer, nil, "other.html", nil).Body.String(),
+		"blocks of other pages are not shared")
+	assert.Equal(t, http.StatusInternalServerError, render(renderer, nil, "missing.html", nil).Code)
+}
+
+func TestHTMLRenderer_Reload(t *testing.T) {
+	fsys := templatesFS("first")
+	cached, err := NewHTMLRenderer(fsys, nil, false)
+	require.Nil(t, err)
+	reloading, err := NewHTMLRenderer(fsys, nil, true)
+	require.Nil(t, err)
+
+	fsys["page.html"].Data = []byte("second")
+	fsys["new.html"] = &fstest.MapFile{Data: []byte("new")}
+	assert.Equal(t, "first", render(cached, nil, "page.html", nil).Body.String())
+	assert.Equal(t, "second", render(reloading, nil, "page.html", nil).Body.String())
+	assert.Equal(t, "new", render(reloading, nil, "new.html", nil).Body.String(), "new pages are discovered")
+
+	fsys["page.html"].Data = []byte("{{ if }}")
+	assert.Equal(t, http.StatusInternalServerError, render(reloading, nil, "page.html", nil).Code)
+	assert.Equal(t, http.StatusOK, render(cached, nil, "page.html", nil).Code)
+}
+
+func TestHTMLRenderer_Status(t *testing.T) {
+	renderer, err := NewHTMLRenderer(templatesFS(`{{ template "base" . }}`), nil, false)
+	require.Nil(t, err)
+	r := WithStatus(httptest.NewRequest(http.MethodGet, "/", nil), http.StatusConflict)
+	w := render(renderer, r, "page.html", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "<title>Inventory</title>", w.Body.String())
+
+	renderer, err = NewHTMLRenderer(templatesFS(`{{ template "missing" }}`), nil, false)
+	require.Nil(t, err)
+	w = render(renderer, r, "page.html", nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "pages that fail to execute are errors")
+}
+
+func TestHTMLRenderer_Flashes(t *testing.T) {
+	db, err := models.Open("sqlite://:memory:", &gorm.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	require.Nil(t, models.Migrate(db))
+	repo := &models.FlashRepository{DB: db}
+	require.Nil(t, repo.Add("s1", models.FlashSuccess, "Item 'Pencil' deleted"))
+
+	renderer, err := NewHTMLRenderer(templatesFS(`{{ template "base" . }}`), nil, false)
+	require.Nil(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), flashesContextKey, &flashes{repo: repo, sessionID: "s1"}))
+	w := render(renderer, r, "page.html", nil)
+	assert.Equal(t, "<title>Inventory</title>[success: Item &#39;Pencil&#39; deleted]", w.Body.String())
+
+	w = render(renderer, r, "page.html", nil)
+	assert.Equal(t, "<title>Inventory</title>", w.Body.String(), "flashes are shown once")
+}
+
+func TestNewHTMLRenderer_Invalid(t *testing.T) {
+	_, err := NewHTMLRenderer(fstest.MapFS{}, nil, false)
+	assert.NotNil(t, err, "there are no pages")
+
+	fsys := templatesFS("")
+	fsys["partials/broken.html"] = &fstest.MapFile{Data: []byte("{{ end }}")}
+	_, err = NewHTMLRenderer(fsys, nil, false)
+	assert.NotNil(t, err)
+}
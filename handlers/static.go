@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// StaticPrefix is the path prefix of the static files.
+const StaticPrefix = "/static/"
+
+const (
+	// staticMaxAge is how long browsers use a static file before they check
+	// whether it has changed.
+	staticMaxAge = time.Hour
+	// versionedMaxAge is how long browsers use a static file requested with
+	// its current version, which changes with its content.
+	versionedMaxAge = 365 * 24 * time.Hour
+)
+
+type staticFile struct {
+	content []byte
+	version string
+}
+
+// StaticHandler serves static files, such as the stylesheet of the pages.
+// The files are read once and served from memory with an ETag, so that
+// browsers can revalidate them cheaply. Pages link to them with URL, which
+// adds the version of the file so that browsers can keep it until it
+// changes. They can be requested without signing in.
+type StaticHandler struct {
+	files map[string]staticFile
+}
+
+// NewStaticHandler reads all files of the given file system.
+func NewStaticHandler(fsys fs.FS) (*StaticHandler, error) {
+	h := &StaticHandler{files: make(map[string]staticFile)}
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		h.files[path] = staticFile{
+			content: content,
+			version: hex.EncodeToString(sum[:8]),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading static files: %w", err)
+	}
+	return h, nil
+}
+
+// URL returns the URL of the given static file with the version of its
+// content, such as /static/bootstrap/css/bootstrap.min.css?v=1a2b3c4d5e6f7a8b. Unknown files get
+// their URL without a version.
+func (h *StaticHandler) URL(name string) string {
+	file, ok := h.files[name]
+	if !ok {
+		return StaticPrefix + name
+	}
+	return StaticPrefix + name + "?v=" + file.version
+}
+
+// ServeHTTP serves the file of the request path. Unknown files and
+// directories are not found. Requests for the current version of a file may
+// be cached for a year, others for staticMaxAge.
+func (h *StaticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	file, ok := h.files[strings.TrimPrefix(r.URL.Path, StaticPrefix)]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	cacheControl := fmt.Sprintf("public, max-age=%d", int(staticMaxAge.Seconds()))
+	if r.URL.Query().Get("v") == file.version {
+		cacheControl = fmt.Sprintf("public, max-age=%d, immutable", int(versionedMaxAge.Seconds()))
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", `"`+file.version+`"`)
+	http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(file.content))
+}
+
+// HandleFuncs registers related handlers into a given Router.
+func (h *StaticHandler) HandleFuncs(router *mux.Router) {
+	router.PathPrefix(StaticPrefix).Handler(h).Methods(http.MethodGet, http.MethodHead).Name("static")
+}
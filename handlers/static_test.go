@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/shayanh/shopify-challenge-2022/web"
+	"github.com/stretchr/testify/suite"
+)
+
+type StaticHandlerTestSuite struct {
+	suite.Suite
+
+	h *StaticHandler
+}
+
+func (s *StaticHandlerTestSuite) SetupTest() {
+	var err error
+	s.h, err = NewStaticHandler(web.Static())
+	s.Require().Nil(err)
+}
+
+func (s *StaticHandlerTestSuite) get(path, etag string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	w := httptest.NewRecorder()
+	s.h.ServeHTTP(w, r)
+	return w
+}
+
+// bootstrapCSS is the vendored Bootstrap stylesheet.
+const bootstrapCSS = "bootstrap/css/bootstrap.min.css"
+
+func (s *StaticHandlerTestSuite) TestServe() {
+	w := s.get("/static/"+bootstrapCSS, "")
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal("text/css; charset=utf-8", w.Header().Get("Content-Type"))
+	s.Equal("public, max-age=3600", w.Header().Get("Cache-Control"))
+	s.Contains(w.Body.String(), ".btn-primary")
+
+	etag := w.Header().Get("ETag")
+	s.NotEmpty(etag)
+	w = s.get("/static/"+bootstrapCSS, etag)
+	s.Equal(http.StatusNotModified, w.Code)
+	s.Empty(w.Body.String())
+}
+
+func (s *StaticHandlerTestSuite) TestServe_Versioned() {
+	url := s.h.URL(bootstrapCSS)
+	s.Regexp(`^/static/bootstrap/css/bootstrap\.min\.css\?v=[0-9a-f]{16}$`, url)
+	w := s.get(url, "")
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal("public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+
+	w = s.get("/static/"+bootstrapCSS+"?v=0000000000000000", "")
+	s.Equal(http.StatusOK, w.Code)
+	s.Equal("public, max-age=3600", w.Header().Get("Cache-Control"))
+	s.Equal("/static/css/missing.css", s.h.URL("css/missing.css"))
+}
+
+func (s *StaticHandlerTestSuite) TestNotFound() {
+	s.Equal(http.StatusNotFound, s.get("/static/css/missing.css", "").Code)
+	s.Equal(http.StatusNotFound, s.get("/static/css", "").Code)
+	s.Equal(http.StatusNotFound, s.get("/static/", "").Code)
+}
+
+func (s *StaticHandlerTestSuite) TestTemplatesUseStaticFiles() {
+	renderer, err := NewHTMLRenderer(web.Templates(), s.h, false)
+	s.Require().Nil(err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	renderer.Render(w, r, "login.html", loginPage{})
+	s.Contains(w.Body.String(), `href="`+s.h.URL(bootstrapCSS)+`"`)
+	s.Contains(w.Body.String(), `src="`+s.h.URL("bootstrap/js/bootstrap.bundle.min.js")+`"`)
+	s.NotContains(w.Body.String(), "https://")
+}
+
+// TestStylesheetCoversClasses checks that the stylesheet defines every class
+// that the templates use, which catches misspelled classes.
+func (s *StaticHandlerTestSuite) TestStylesheetCoversClasses() {
+	css, err := fs.ReadFile(web.Static(), bootstrapCSS)
+	s.Require().Nil(err)
+	// These Bootstrap classes have no styles of their own.
+	defined := map[string]bool{"nav-item": true, "form-check-label": true}
+	for _, m := range cssClassPattern.FindAllStringSubmatch(string(css), -1) {
+		defined[m[1]] = true
+	}
+
+	err = fs.WalkDir(web.Templates(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(web.Templates(), path)
+		if err != nil {
+			return err
+		}
+		// Actions are left out, classes set by them are in the strings.
+		text := templateActionPattern.ReplaceAllStringFunc(string(b), func(action string) string {
+			var classes []string
+			for _, m := range templateStringPattern.FindAllStringSubmatch(action, -1) {
+				classes = append(classes, m[1])
+			}
+			return " " + strings.Join(classes, " ") + " "
+		})
+		for _, m := range classAttrPattern.FindAllStringSubmatch(text, -1) {
+			for _, class := range strings.Fields(m[1]) {
+				s.True(isDefined(defined, class), "class %q of %s is not in %s", class, path, bootstrapCSS)
+			}
+		}
+		return nil
+	})
+	s.Require().Nil(err)
+}
+
+// isDefined tells whether the given class is defined. A class ending with a
+// dash is completed by an action, such as alert-{{ .Kind }}, and is defined
+// if any class starts with it.
+func isDefined(defined map[string]bool, class string) bool {
+	if !strings.HasSuffix(class, "-") {
+		return defined[class]
+	}
+	for name := range defined {
+		if strings.HasPrefix(name, class) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	cssClassPattern       = regexp.MustCompile(`\.([a-zA-Z][\w-]*)`)
+	templateActionPattern = regexp.MustCompile(`{{.*?}}`)
+	templateStringPattern = regexp.MustCompile(`"([^"]*)"`)
+	classAttrPattern      = regexp.MustCompile(`class="([^"]*)"`)
+)
+
+func (s *StaticHandlerTestSuite) TestMiddleware_Public() {
+	auth := NewAuthHandler(nil, nil, nil, nil, nil, nil, 0, false)
+	w := httptest.NewRecorder()
+	auth.Middleware(s.h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/"+bootstrapCSS, nil))
+	s.Equal(http.StatusOK, w.Code)
+}
+
+func TestStaticHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(StaticHandlerTestSuite))
+}
@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/config"
+	"go.uber.org/multierr"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// DefaultSlowQueryThreshold is the duration after which queries are logged as
+// slow.
+const DefaultSlowQueryThreshold = 200 * time.Millisecond
+
+// GormLogger writes the log of GORM through a Logger, so SQL statements carry
+// the request ID of the context they run with. Repositories take the context
+// with WithContext.
+//
+// Failed queries are logged as errors and slow queries as warnings. Other
+// statements are only logged at the debug level. Queries that find no record
+// are not considered failed.
+//
+// The statements are logged with their placeholders and without the values
+// bound to them, which hold passwords and token hashes. The logger reads them
+// from the statements, so it has to be installed as a plugin with
+// gorm.DB.Use too. Without the plugin, statements are logged without their SQL.
+type GormLogger struct {
+	Logger        *Logger
+	SlowThreshold time.Duration
+}
+
+// NewGormLogger returns a GORM logger writing through the given logger.
+func NewGormLogger(l *Logger) *GormLogger {
+	return &GormLogger{Logger: l, SlowThreshold: DefaultSlowQueryThreshold}
+}
+
+type sqlContextKey struct{}
+
+func (g *GormLogger) Name() string {
+	return "logging"
+}
+
+func (g *GormLogger) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return multierr.Combine(
+		cb.Create().After("gorm:create").Register("logging:sql_create", keepSQL),
+		cb.Query().After("gorm:query").Register("logging:sql_query", keepSQL),
+		cb.Update().After("gorm:update").Register("logging:sql_update", keepSQL),
+		cb.Delete().After("gorm:delete").Register("logging:sql_delete", keepSQL),
+		cb.Row().After("gorm:row").Register("logging:sql_row", keepSQL),
+		cb.Raw().After("gorm:raw").Register("logging:sql_raw", keepSQL),
+	)
+}
+
+// keepSQL hands the SQL of the statement to Trace, which GORM calls with the
+// context of the statement once its callbacks have run. The SQL passed to
+// Trace itself has the values of the placeholders filled in.
+func keepSQL(db *gorm.DB) {
+	if db.Statement.SQL.Len() > 0 {
+		db.Statement.Context = context.WithValue(db.Statement.Context, sqlContextKey{}, db.Statement.SQL.String())
+	}
+}
+
+// LogMode is a no-op, the level of the underlying Logger applies.
+func (g *GormLogger) LogMode(logger.LogLevel) logger.Interface {
+	return g
+}
+
+func (g *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	g.Logger.Info(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (g *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	g.Logger.Warn(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (g *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	g.Logger.Error(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (g *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	var level config.LogLevel
+	var msg string
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, msg = config.LevelError, "query failed"
+	case g.SlowThreshold > 0 && elapsed > g.SlowThreshold:
+		level, msg = config.LevelWarn, "slow query"
+	default:
+		level, msg = config.LevelDebug, "query"
+	}
+	if !g.Logger.Enabled(level) {
+		return
+	}
+	_, rows := fc()
+	var keyvals []interface{}
+	if sql, ok := ctx.Value(sqlContextKey{}).(string); ok {
+		keyvals = append(keyvals, "sql", sql)
+	}
+	keyvals = append(keyvals, "rows", rows, "duration_ms", Milliseconds(elapsed))
+	if level == config.LevelError {
+		keyvals = append(keyvals, "error", err)
+	}
+	g.Logger.Log(ctx, level, msg, keyvals...)
+}
@@ -0,0 +1,242 @@
+// Package logging writes structured log entries as JSON lines.
+//
+// Every entry has a time, a level and a message followed by key-value pairs.
+// Entries logged with the context of an HTTP request also carry the ID of the
+// request and the name of the signed in user, see WithRequest.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/config"
+)
+
+// Logger writes entries of its level and above to an io.Writer. It is safe
+// for concurrent use.
+type Logger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level config.LogLevel
+	now   func() time.Time
+}
+
+// New returns a logger writing entries of the given level and above to out.
+func New(out io.Writer, level config.LogLevel) *Logger {
+	return &Logger{out: out, level: level, now: time.Now}
+}
+
+var defaultLogger = New(os.Stderr, config.LevelInfo)
+
+// Default returns the logger used by the package level functions.
+func Default() *Logger {
+	return defaultLogger
+}
+
+// SetDefault replaces the logger used by the package level functions. It is
+// meant to be called once on start.
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+// Enabled reports whether entries of the given level are written.
+func (l *Logger) Enabled(level config.LogLevel) bool {
+	return l.level.Enabled(level)
+}
+
+// Log writes an entry with the given level and message. The key-value pairs
+// are written in order after the request ID and the user of the context.
+// Errors are written as their message.
+func (l *Logger) Log(ctx context.Context, level config.LogLevel, msg string, keyvals ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeField(&buf, "time", l.now().UTC().Format(time.RFC3339Nano))
+	buf.WriteByte(',')
+	writeField(&buf, "level", string(level))
+	buf.WriteByte(',')
+	writeField(&buf, "msg", msg)
+	if req := requestOf(ctx); req != nil {
+		buf.WriteByte(',')
+		writeField(&buf, "request_id", req.id)
+		if user := req.User(); user != "" {
+			buf.WriteByte(',')
+			writeField(&buf, "user", user)
+		}
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		var value interface{}
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		buf.WriteByte(',')
+		writeField(&buf, key, value)
+	}
+	buf.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.out.Write(buf.Bytes())
+}
+
+func writeField(buf *bytes.Buffer, key string, value interface{}) {
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	k, _ := json.Marshal(key)
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(k)
+	buf.WriteByte(':')
+	buf.Write(v)
+}
+
+func (l *Logger) Debug(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Log(ctx, config.LevelDebug, msg, keyvals...)
+}
+
+func (l *Logger) Info(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Log(ctx, config.LevelInfo, msg, keyvals...)
+}
+
+func (l *Logger) Warn(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Log(ctx, config.LevelWarn, msg, keyvals...)
+}
+
+func (l *Logger) Error(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Log(ctx, config.LevelError, msg, keyvals...)
+}
+
+// Writer returns a writer that logs every line written to it as the message
+// of an entry with the given level. It lets the standard log package and
+// other libraries write through the logger.
+func (l *Logger) Writer(level config.LogLevel) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+			l.Log(context.Background(), level, line)
+		}
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func Debug(ctx context.Context, msg string, keyvals ...interface{}) {
+	defaultLogger.Debug(ctx, msg, keyvals...)
+}
+
+func Info(ctx context.Context, msg string, keyvals ...interface{}) {
+	defaultLogger.Info(ctx, msg, keyvals...)
+}
+
+func Warn(ctx context.Context, msg string, keyvals ...interface{}) {
+	defaultLogger.Warn(ctx, msg, keyvals...)
+}
+
+func Error(ctx context.Context, msg string, keyvals ...interface{}) {
+	defaultLogger.Error(ctx, msg, keyvals...)
+}
+
+// Milliseconds returns a duration in fractional milliseconds, the unit of
+// durations in log entries.
+func Milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// request holds the request ID and the user of a request. The user is only
+// known after authentication, which happens further down the handler chain,
+// so it is set on the shared request instead of a new context.
+type request struct {
+	id string
+
+	mu   sync.Mutex
+	user string
+}
+
+func (r *request) User() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.user
+}
+
+type requestContextKey struct{}
+
+// WithRequest returns a context whose log entries carry the given request ID.
+func WithRequest(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestContextKey{}, &request{id: id})
+}
+
+func requestOf(ctx context.Context) *request {
+	if ctx == nil {
+		return nil
+	}
+	req, _ := ctx.Value(requestContextKey{}).(*request)
+	return req
+}
+
+// RequestID returns the request ID of the context, or an empty string.
+func RequestID(ctx context.Context) string {
+	if req := requestOf(ctx); req != nil {
+		return req.id
+	}
+	return ""
+}
+
+// SetUser records the signed in user of the request of the context, so that
+// all entries of the request carry it, including the ones logged by earlier
+// middlewares after the request has been served.
+func SetUser(ctx context.Context, user string) {
+	if req := requestOf(ctx); req != nil {
+		req.mu.Lock()
+		req.user = user
+		req.mu.Unlock()
+	}
+}
+
+// maxRequestIDLength is the maximum length of request IDs taken from clients.
+const maxRequestIDLength = 128
+
+// ValidRequestID reports whether a request ID received from a client can be
+// used as is. IDs must be short and consist of printable ASCII characters
+// without spaces, so that they cannot break log lines or headers.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
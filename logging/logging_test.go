@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestLogger(level config.LogLevel) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	l := New(&buf, level)
+	l.now = func() time.Time { return time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return l, &buf
+}
+
+func entries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		require.Nil(t, json.Unmarshal([]byte(line), &entry), line)
+		result = append(result, entry)
+	}
+	return result
+}
+
+func TestLogger(t *testing.T) {
+	l, buf := newTestLogger(config.LevelInfo)
+	l.Debug(context.Background(), "hidden")
+	l.Info(context.Background(), "saved", "id", 7, "error", errors.New("boom"), "odd")
+
+	assert.Equal(t, `{"time":"2022-01-02T03:04:05Z","level":"info","msg":"saved","id":7,"error":"boom","odd":null}`+"\n",
+		buf.String())
+}
+
+func TestLogger_Request(t *testing.T) {
+	l, buf := newTestLogger(config.LevelDebug)
+	ctx := WithRequest(context.Background(), "req-1")
+	l.Info(ctx, "anonymous")
+	SetUser(ctx, "alice")
+	l.Warn(ctx, "signed in")
+	SetUser(context.Background(), "ignored")
+
+	got := entries(t, buf)
+	require.Equal(t, 2, len(got))
+	assert.Equal(t, "req-1", got[0]["request_id"])
+	assert.NotContains(t, got[0], "user")
+	assert.Equal(t, "alice", got[1]["user"])
+	assert.Equal(t, "warn", got[1]["level"])
+	assert.Equal(t, "req-1", RequestID(ctx))
+	assert.Equal(t, "", RequestID(context.Background()))
+}
+
+func TestLogger_Writer(t *testing.T) {
+	l, buf := newTestLogger(config.LevelInfo)
+	std := log.New(l.Writer(config.LevelWarn), "", 0)
+	std.Printf("first\nsecond")
+
+	got := entries(t, buf)
+	require.Equal(t, 2, len(got))
+	assert.Equal(t, "first", got[0]["msg"])
+	assert.Equal(t, "second", got[1]["msg"])
+	assert.Equal(t, "warn", got[1]["level"])
+}
+
+func TestValidRequestID(t *testing.T) {
+	assert.True(t, ValidRequestID("0f8a-b2c4"))
+	assert.False(t, ValidRequestID(""))
+	assert.False(t, ValidRequestID("two words"))
+	assert.False(t, ValidRequestID("line\nbreak"))
+	assert.False(t, ValidRequestID(strings.Repeat("a", 129)))
+	assert.True(t, ValidRequestID(NewRequestID()))
+	assert.NotEqual(t, NewRequestID(), NewRequestID())
+}
+
+func TestGormLogger(t *testing.T) {
+	sql := func() (string, int64) { return "SELECT 1", 1 }
+	ctx := WithRequest(context.Background(), "req-1")
+
+	l, buf := newTestLogger(config.LevelInfo)
+	g := NewGormLogger(l)
+	g.Trace(ctx, time.Now(), sql, nil)
+	g.Trace(ctx, time.Now(), sql, gorm.ErrRecordNotFound)
+	assert.Equal(t, "", buf.String())
+
+	g.Trace(ctx, time.Now(), sql, errors.New("no such table"))
+	g.Trace(ctx, time.Now().Add(-time.Second), sql, nil)
+	got := entries(t, buf)
+	require.Equal(t, 2, len(got))
+	assert.Equal(t, "query failed", got[0]["msg"])
+	assert.Equal(t, "no such table", got[0]["error"])
+	assert.Equal(t, "req-1", got[0]["request_id"])
+	assert.Equal(t, "slow query", got[1]["msg"])
+	assert.GreaterOrEqual(t, got[1]["duration_ms"], 1000.0)
+
+	l, buf = newTestLogger(config.LevelDebug)
+	NewGormLogger(l).Trace(context.WithValue(ctx, sqlContextKey{}, "SELECT ?"), time.Now(), sql, nil)
+	NewGormLogger(l).Trace(ctx, time.Now(), sql, nil)
+	got = entries(t, buf)
+	require.Equal(t, 2, len(got))
+	assert.Equal(t, "SELECT ?", got[0]["sql"])
+	assert.Equal(t, "debug", got[0]["level"])
+	assert.NotContains(t, got[1], "sql", "the SQL of fc has the values filled in")
+	assert.Equal(t, 1.0, got[1]["rows"])
+}
+
+func TestGormLogger_Params(t *testing.T) {
+	l, buf := newTestLogger(config.LevelDebug)
+	g := NewGormLogger(l)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: g})
+	require.Nil(t, err)
+	require.Nil(t, db.Use(g))
+
+	type secret struct {
+		ID    uint
+		Token string
+	}
+	require.Nil(t, db.AutoMigrate(&secret{}))
+	buf.Reset()
+	require.Nil(t, db.Create(&secret{Token: "hunter2"}).Error)
+	require.Nil(t, db.Where("token = ?", "hunter2").First(&secret{}).Error)
+	assert.NotContains(t, buf.String(), "hunter2")
+
+	got := entries(t, buf)
+	require.Equal(t, 2, len(got))
+	assert.Contains(t, got[0]["sql"], "VALUES (?)")
+	assert.Equal(t, 1.0, got[0]["rows"])
+	assert.Contains(t, got[1]["sql"], "WHERE token = ?")
+}
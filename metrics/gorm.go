@@ -0,0 +1,83 @@
+// Package metrics records the metrics of the database operations of the
+// server with the Prometheus client.
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/multierr"
+	"gorm.io/gorm"
+)
+
+const startKey = "metrics:start"
+
+// GormPlugin is a GORM plugin that records the duration of every database
+// operation, labeled by the kind of the operation and the table. Queries that
+// find no record are not counted as failed.
+type GormPlugin struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// NewGormPlugin registers the database metrics with the given registerer.
+// The plugin is installed with gorm.DB.Use.
+func NewGormPlugin(r prometheus.Registerer) *GormPlugin {
+	factory := promauto.With(r)
+	return &GormPlugin{
+		duration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "db_query_duration_seconds",
+			Help: "Duration of database operations.",
+		}, []string{"operation", "table"}),
+		errors: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "db_query_errors_total",
+			Help: "Number of failed database operations.",
+		}, []string{"operation", "table"}),
+	}
+}
+
+func (p *GormPlugin) Name() string {
+	return "metrics"
+}
+
+func (p *GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return multierr.Combine(
+		cb.Create().Before("gorm:create").Register("metrics:before_create", p.start),
+		cb.Create().After("gorm:create").Register("metrics:after_create", p.finish("create")),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", p.start),
+		cb.Query().After("gorm:query").Register("metrics:after_query", p.finish("query")),
+		cb.Update().Before("gorm:update").Register("metrics:before_update", p.start),
+		cb.Update().After("gorm:update").Register("metrics:after_update", p.finish("update")),
+		cb.Delete().Before("gorm:delete").Register("metrics:before_delete", p.start),
+		cb.Delete().After("gorm:delete").Register("metrics:after_delete", p.finish("delete")),
+		cb.Row().Before("gorm:row").Register("metrics:before_row", p.start),
+		cb.Row().After("gorm:row").Register("metrics:after_row", p.finish("row")),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", p.start),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", p.finish("raw")),
+	)
+}
+
+func (p *GormPlugin) start(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func (p *GormPlugin) finish(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		start, ok := v.(time.Time)
+		if !ok {
+			return
+		}
+		table := db.Statement.Table
+		p.duration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			p.errors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
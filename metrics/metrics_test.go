@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// scrape returns the metrics of the registry in the text format.
+func scrape(t *testing.T, r *prometheus.Registry) string {
+	w := httptest.NewRecorder()
+	promhttp.HandlerFor(r, promhttp.HandlerOpts{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestGormPlugin(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.Nil(t, err)
+	r := prometheus.NewRegistry()
+	require.Nil(t, db.Use(NewGormPlugin(r)))
+
+	type Thing struct {
+		ID   uint
+		Name string
+	}
+	require.Nil(t, db.AutoMigrate(&Thing{}))
+	require.Nil(t, db.Create(&Thing{Name: "a"}).Error)
+	var thing Thing
+	require.ErrorIs(t, db.First(&thing, 100).Error, gorm.ErrRecordNotFound)
+	require.NotNil(t, db.Table("missing").Find(&thing).Error)
+
+	body := scrape(t, r)
+	assert.Contains(t, body, `db_query_duration_seconds_count{operation="create",table="things"} 1`)
+	assert.Contains(t, body, `db_query_duration_seconds_count{operation="query",table="things"} 1`)
+	assert.Contains(t, body, `db_query_errors_total{operation="query",table="missing"} 1`)
+	assert.NotContains(t, body, `db_query_errors_total{operation="query",table="things"}`)
+}
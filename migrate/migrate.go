@@ -0,0 +1,240 @@
+// Package migrate applies versioned changes to the database schema and keeps
+// track of them in the schema_migrations table.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSchemaTooNew is returned when the database has migrations applied that
+// are newer than the known ones, which means it has been migrated by a newer
+// version of the program.
+var ErrSchemaTooNew = errors.New("database schema is newer than this program")
+
+// ErrPendingMigrations is returned by Current when known migrations have not
+// been applied yet.
+var ErrPendingMigrations = errors.New("database has pending migrations")
+
+// Migration is a versioned change of the database schema. Versions are
+// timestamps of the form YYYYMMDDHHMMSS, so that migrations written in
+// parallel get distinct versions. Up and Down run in a transaction.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// TableName is the name of the table of the applied migrations.
+const TableName = "schema_migrations"
+
+// schemaMigration is a row of the schema_migrations table.
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return TableName
+}
+
+// Status is the state of a migration in the database.
+type Status struct {
+	Version int64
+	Name    string
+	// AppliedAt is nil for pending migrations.
+	AppliedAt *time.Time
+	// Unknown is set for applied migrations that are not known to the
+	// program.
+	Unknown bool
+}
+
+// Migrator runs a set of migrations against a database.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New returns a Migrator of the given migrations. It panics if two migrations
+// share a version, since that is a programming error.
+func New(db *gorm.DB, migrations []Migration) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			panic(fmt.Sprintf("migrate: duplicate migration version %d", sorted[i].Version))
+		}
+	}
+	return &Migrator{db: db, migrations: sorted}
+}
+
+func (m *Migrator) applied() (map[int64]schemaMigration, error) {
+	if err := m.db.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+	return m.load()
+}
+
+// load reads the applied migrations without creating the table of applied
+// migrations.
+func (m *Migrator) load() (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Check returns ErrSchemaTooNew if the database has an applied migration that
+// is newer than every known migration.
+func (m *Migrator) Check() error {
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+	return m.check(applied)
+}
+
+// Current returns nil if exactly the known migrations are applied, and
+// ErrSchemaTooNew or ErrPendingMigrations otherwise. Unlike the other
+// methods, it only reads from the database.
+func (m *Migrator) Current() error {
+	applied, err := m.load()
+	if err != nil {
+		return err
+	}
+	if err := m.check(applied); err != nil {
+		return err
+	}
+	var pending int
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d of %d not applied", ErrPendingMigrations, pending, len(m.migrations))
+	}
+	return nil
+}
+
+func (m *Migrator) check(applied map[int64]schemaMigration) error {
+	var latest int64
+	if len(m.migrations) > 0 {
+		latest = m.migrations[len(m.migrations)-1].Version
+	}
+	for version := range applied {
+		if version > latest {
+			return fmt.Errorf("%w: version %d is applied, the latest known is %d",
+				ErrSchemaTooNew, version, latest)
+		}
+	}
+	return nil
+}
+
+// Up applies every pending migration in order and returns them.
+func (m *Migrator) Up() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.check(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the given number of the most recently applied migrations and
+// returns them. A negative number reverts all of them.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.check(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && steps != 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+		steps--
+	}
+	return done, nil
+}
+
+// Status returns the state of every known migration and of every applied
+// migration that is not known, ordered by version.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range applied {
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, Status{
+			Version:   row.Version,
+			Name:      row.Name,
+			AppliedAt: &appliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
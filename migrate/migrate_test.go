@@ -0,0 +1,136 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var dbCount int
+
+func setupDB(t *testing.T) *gorm.DB {
+	dbCount++
+	dsn := fmt.Sprintf("file:migrate%d?mode=memory&cache=shared", dbCount)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func createTable(name string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Exec("CREATE TABLE " + name + " (id INTEGER PRIMARY KEY)").Error
+	}
+}
+
+func dropTable(name string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Exec("DROP TABLE " + name).Error
+	}
+}
+
+var testMigrations = []Migration{
+	{Version: 20220102000000, Name: "create_b", Up: createTable("b"), Down: dropTable("b")},
+	{Version: 20220101000000, Name: "create_a", Up: createTable("a"), Down: dropTable("a")},
+}
+
+func TestMigrator_UpDown(t *testing.T) {
+	db := setupDB(t)
+	m := New(db, testMigrations)
+
+	assert.NotNil(t, m.Current(), "the migrations table does not exist yet")
+	applied, err := m.Up()
+	assert.Nil(t, err)
+	assert.Nil(t, m.Current())
+	if assert.Equal(t, 2, len(applied)) {
+		assert.Equal(t, "create_a", applied[0].Name)
+		assert.Equal(t, "create_b", applied[1].Name)
+	}
+	assert.True(t, db.Migrator().HasTable("a"))
+	assert.True(t, db.Migrator().HasTable("b"))
+
+	applied, err = m.Up()
+	assert.Nil(t, err)
+	assert.Empty(t, applied)
+
+	reverted, err := m.Down(1)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(reverted)) {
+		assert.Equal(t, "create_b", reverted[0].Name)
+	}
+	assert.False(t, db.Migrator().HasTable("b"))
+	assert.ErrorIs(t, m.Current(), ErrPendingMigrations)
+
+	statuses, err := m.Status()
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(statuses)) {
+		assert.NotNil(t, statuses[0].AppliedAt)
+		assert.Nil(t, statuses[1].AppliedAt)
+	}
+
+	reverted, err = m.Down(-1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(reverted))
+	assert.False(t, db.Migrator().HasTable("a"))
+}
+
+func TestMigrator_FailedMigrationIsRolledBack(t *testing.T) {
+	db := setupDB(t)
+	failing := Migration{
+		Version: 20220103000000,
+		Name:    "failing",
+		Up: func(tx *gorm.DB) error {
+			if err := createTable("c")(tx); err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+		Down: dropTable("c"),
+	}
+	m := New(db, append([]Migration{failing}, testMigrations...))
+
+	applied, err := m.Up()
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, len(applied))
+	assert.False(t, db.Migrator().HasTable("c"))
+
+	statuses, err := m.Status()
+	assert.Nil(t, err)
+	assert.Nil(t, statuses[2].AppliedAt)
+}
+
+func TestMigrator_SchemaTooNew(t *testing.T) {
+	db := setupDB(t)
+	_, err := New(db, testMigrations).Up()
+	assert.Nil(t, err)
+
+	older := New(db, testMigrations[1:])
+	assert.ErrorIs(t, older.Check(), ErrSchemaTooNew)
+	assert.ErrorIs(t, older.Current(), ErrSchemaTooNew)
+	_, err = older.Up()
+	assert.ErrorIs(t, err, ErrSchemaTooNew)
+	_, err = older.Down(1)
+	assert.ErrorIs(t, err, ErrSchemaTooNew)
+
+	statuses, err := older.Status()
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(statuses)) {
+		assert.True(t, statuses[1].Unknown)
+	}
+}
+
+func TestNew_DuplicateVersion(t *testing.T) {
+	assert.Panics(t, func() {
+		New(nil, append(testMigrations, testMigrations[0]))
+	})
+}
@@ -0,0 +1,483 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuditAction is the kind of change recorded by an AuditEvent.
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	// AuditPurge is the permanent deletion of a soft-deleted entity.
+	AuditPurge AuditAction = "purge"
+)
+
+// AuditActions lists every audit action.
+var AuditActions = []AuditAction{AuditCreate, AuditUpdate, AuditDelete, AuditRestore, AuditPurge}
+
+// The entity types of audit events.
+const (
+	EntityItem      = "item"
+	EntityInventory = "inventory"
+)
+
+// SystemActor is the actor of changes made outside of a signed in request,
+// such as the command line and the retention purge.
+const SystemActor = "system"
+
+// AuditEvent records a change of an item or an inventory. Events are written
+// by database callbacks in the transaction of the change, so that no change
+// goes unrecorded, and are never modified afterwards.
+type AuditEvent struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	// ActorID is the user who made the change, or nil for SystemActor. Actor
+	// keeps the name of the user at the time of the change.
+	ActorID    *uint       `gorm:"index"`
+	Actor      string      `gorm:"not null"`
+	Action     AuditAction `gorm:"not null;size:16"`
+	EntityType string      `gorm:"not null;size:32;index:idx_audit_events_entity"`
+	EntityID   uint        `gorm:"not null;index:idx_audit_events_entity"`
+	// InventoryID is the inventory of the entity after the change. It decides
+	// who may see the event.
+	InventoryID uint `gorm:"index"`
+	// Changes is a JSON object that maps every changed column to a
+	// FieldChange.
+	Changes string `gorm:"type:text"`
+}
+
+// FieldChange is the old and new JSON value of a changed column. Old is
+// missing for created entities and New is missing for purged ones.
+type FieldChange struct {
+	Field string          `json:"-"`
+	Old   json.RawMessage `json:"old,omitempty"`
+	New   json.RawMessage `json:"new,omitempty"`
+}
+
+// FieldChanges returns the changes of the event sorted by column.
+func (e AuditEvent) FieldChanges() ([]FieldChange, error) {
+	var changes map[string]FieldChange
+	if err := json.Unmarshal([]byte(e.Changes), &changes); err != nil {
+		return nil, err
+	}
+	res := make([]FieldChange, 0, len(changes))
+	for field, change := range changes {
+		change.Field = field
+		res = append(res, change)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Field < res[j].Field })
+	return res, nil
+}
+
+type actorContextKey struct{}
+
+type actor struct {
+	id   uint
+	name string
+}
+
+// WithActor returns a context that attributes the changes made with it to
+// the given user. Repositories take the context with WithContext.
+func WithActor(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor{id: user.ID, name: user.Username})
+}
+
+func actorOf(ctx context.Context) (*uint, string) {
+	if ctx != nil {
+		if a, ok := ctx.Value(actorContextKey{}).(actor); ok {
+			return &a.id, a.name
+		}
+	}
+	return nil, SystemActor
+}
+
+// auditedTables maps the tables whose changes are audited to their entity
+// types.
+var auditedTables = map[string]string{
+	"items":       EntityItem,
+	"inventories": EntityInventory,
+}
+
+// auditIgnoredColumns are bookkeeping columns left out of the changes.
+var auditIgnoredColumns = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+	"version":    true,
+}
+
+const (
+	auditSnapshotKey = "audit:snapshot"
+	auditTagsKey     = "audit:tags"
+)
+
+// registerAuditCallbacks hooks the audit log into every create, update and
+// delete of the audited tables. The callbacks run before the transaction of
+// the statement is committed and roll it back if the events cannot be
+// written.
+func registerAuditCallbacks(db *gorm.DB) error {
+	cb := db.Callback()
+	const commit = "gorm:commit_or_rollback_transaction"
+	return multierr.Combine(
+		cb.Create().After("gorm:create").Before(commit).Register("audit:create", auditCreate),
+		cb.Update().Before("gorm:update").Register("audit:before_update", auditSnapshot),
+		cb.Update().After("gorm:update").Before(commit).Register("audit:update", auditChanges),
+		cb.Delete().Before("gorm:delete").Register("audit:before_delete", auditSnapshot),
+		cb.Delete().After("gorm:delete").Before(commit).Register("audit:delete", auditChanges),
+	)
+}
+
+// auditedEntity returns the entity type of the statement of db, if it is
+// audited and has not failed.
+func auditedEntity(db *gorm.DB) (string, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return "", false
+	}
+	entity, ok := auditedTables[db.Statement.Schema.Table]
+	return entity, ok
+}
+
+// auditRow is the state of an audited row.
+type auditRow struct {
+	id          uint
+	inventoryID uint
+	values      map[string]json.RawMessage
+}
+
+func newAuditRow(db *gorm.DB, rv reflect.Value) (auditRow, error) {
+	sch := db.Statement.Schema
+	row := auditRow{values: map[string]json.RawMessage{}}
+	for _, field := range sch.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		value, _ := field.ValueOf(rv)
+		switch field.DBName {
+		case "id":
+			row.id, _ = value.(uint)
+		case "inventory_id":
+			row.inventoryID, _ = value.(uint)
+		}
+		if auditIgnoredColumns[field.DBName] {
+			continue
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return row, err
+		}
+		row.values[field.DBName] = b
+	}
+	if _, ok := sch.FieldsByDBName["inventory_id"]; !ok {
+		row.inventoryID = row.id
+	}
+	return row, nil
+}
+
+// loadAuditRows reads the rows of the audited table that match the given
+// query, deleted ones included.
+func loadAuditRows(db *gorm.DB, query func(tx *gorm.DB) *gorm.DB) (map[uint]auditRow, error) {
+	rows := reflect.New(reflect.SliceOf(db.Statement.Schema.ModelType))
+	tx := query(db.Session(&gorm.Session{NewDB: true}).Unscoped())
+	if err := tx.Find(rows.Interface()).Error; err != nil {
+		return nil, err
+	}
+	res := make(map[uint]auditRow, rows.Elem().Len())
+	for i := 0; i < rows.Elem().Len(); i++ {
+		row, err := newAuditRow(db, rows.Elem().Index(i))
+		if err != nil {
+			return nil, err
+		}
+		res[row.id] = row
+	}
+	return res, nil
+}
+
+// auditSnapshot keeps the rows that an update or delete is about to change.
+// They are found with the conditions of the statement, or the primary key of
+// its model.
+func auditSnapshot(db *gorm.DB) {
+	if _, ok := auditedEntity(db); !ok {
+		return
+	}
+	stmt := db.Statement
+	rows, err := loadAuditRows(db, func(tx *gorm.DB) *gorm.DB {
+		if c, ok := stmt.Clauses["WHERE"]; ok {
+			if where, ok := c.Expression.(clause.Where); ok {
+				tx = tx.Clauses(where)
+			}
+		}
+		if stmt.ReflectValue.Kind() == reflect.Struct {
+			for _, field := range stmt.Schema.PrimaryFields {
+				if value, zero := field.ValueOf(stmt.ReflectValue); !zero {
+					tx = tx.Where(clause.Eq{Column: field.DBName, Value: value})
+				}
+			}
+		}
+		return tx
+	})
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(auditSnapshotKey, rows)
+}
+
+// auditChanges compares the rows kept by auditSnapshot with their state after
+// the statement and records the differences.
+func auditChanges(db *gorm.DB) {
+	entity, ok := auditedEntity(db)
+	if !ok {
+		return
+	}
+	v, ok := db.InstanceGet(auditSnapshotKey)
+	if !ok {
+		return
+	}
+	before := v.(map[uint]auditRow)
+	if len(before) == 0 {
+		return
+	}
+	ids := make([]uint, 0, len(before))
+	for id := range before {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	after, err := loadAuditRows(db, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(clause.IN{Column: clause.PrimaryColumn, Values: toInterfaces(ids)})
+	})
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+
+	var events []AuditEvent
+	for _, id := range ids {
+		old := before[id]
+		row, found := after[id]
+		var event AuditEvent
+		if found {
+			event = auditEvent(db, entity, old, row)
+		} else {
+			event = auditEvent(db, entity, old, auditRow{id: id, inventoryID: old.inventoryID})
+			event.Action = AuditPurge
+		}
+		if event.Changes != "" {
+			events = append(events, event)
+		}
+	}
+	writeAuditEvents(db, events)
+}
+
+// auditCreate records the created rows of a statement.
+func auditCreate(db *gorm.DB) {
+	entity, ok := auditedEntity(db)
+	if !ok {
+		return
+	}
+	var events []AuditEvent
+	add := func(rv reflect.Value) {
+		row, err := newAuditRow(db, reflect.Indirect(rv))
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		events = append(events, auditEvent(db, entity, auditRow{}, row))
+	}
+	switch rv := db.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			add(rv.Index(i))
+		}
+	case reflect.Struct:
+		add(rv)
+	}
+	writeAuditEvents(db, events)
+}
+
+// auditEvent returns the event of the change from old to new. Changes is
+// empty if nothing has changed.
+func auditEvent(db *gorm.DB, entity string, old, new auditRow) AuditEvent {
+	actorID, actorName := actorOf(db.Statement.Context)
+	event := AuditEvent{
+		ActorID:     actorID,
+		Actor:       actorName,
+		Action:      AuditUpdate,
+		EntityType:  entity,
+		EntityID:    new.id,
+		InventoryID: new.inventoryID,
+	}
+	switch {
+	case old.values == nil:
+		event.Action = AuditCreate
+	case isNull(old.values["deleted_at"]) && !isNull(new.values["deleted_at"]):
+		event.Action = AuditDelete
+	case !isNull(old.values["deleted_at"]) && new.values != nil && isNull(new.values["deleted_at"]):
+		event.Action = AuditRestore
+	}
+
+	changes := map[string]FieldChange{}
+	for field, value := range new.values {
+		if old.values == nil {
+			if !isNull(value) {
+				changes[field] = FieldChange{New: value}
+			}
+		} else if string(old.values[field]) != string(value) {
+			changes[field] = FieldChange{Old: old.values[field], New: value}
+		}
+	}
+	if change, ok := db.Get(auditTagsKey); ok && new.values != nil {
+		changes["tags"] = change.(FieldChange)
+	}
+	if new.values == nil {
+		for field, value := range old.values {
+			if !isNull(value) {
+				changes[field] = FieldChange{Old: value}
+			}
+		}
+	}
+	if len(changes) > 0 {
+		b, err := json.Marshal(changes)
+		if err != nil {
+			db.AddError(err)
+			return event
+		}
+		event.Changes = string(b)
+	}
+	return event
+}
+
+// withTagsChange returns tx set up to record the change of the tags of an
+// item from old to new as a tags field in the event of the item, since the
+// tags are kept in their own table. old is nil for a created item. tx is
+// returned as is if the tags have not changed.
+func withTagsChange(tx *gorm.DB, old, new []string) (*gorm.DB, error) {
+	sort.Strings(old)
+	sort.Strings(new)
+	if old != nil && strings.Join(old, ",") == strings.Join(new, ",") ||
+		old == nil && len(new) == 0 {
+		return tx, nil
+	}
+	var change FieldChange
+	var err error
+	if old != nil {
+		if change.Old, err = json.Marshal(old); err != nil {
+			return tx, err
+		}
+	}
+	if change.New, err = json.Marshal(new); err != nil {
+		return tx, err
+	}
+	return tx.Set(auditTagsKey, change), nil
+}
+
+func writeAuditEvents(db *gorm.DB, events []AuditEvent) {
+	if len(events) == 0 || db.Error != nil {
+		return
+	}
+	if err := db.Session(&gorm.Session{NewDB: true}).Create(&events).Error; err != nil {
+		db.AddError(err)
+	}
+}
+
+func isNull(value json.RawMessage) bool {
+	return value == nil || string(value) == "null"
+}
+
+func toInterfaces(ids []uint) []interface{} {
+	res := make([]interface{}, len(ids))
+	for i, id := range ids {
+		res[i] = id
+	}
+	return res
+}
+
+// AuditQuery filters audit events. Zero values mean no filtering.
+type AuditQuery struct {
+	EntityType string
+	EntityID   uint
+	Action     AuditAction
+	// Actor is matched against the name of the actor.
+	Actor string
+	From  *time.Time
+	To    *time.Time
+
+	// Page starts from 1.
+	Page     int
+	PageSize int
+}
+
+// Offset returns the number of events to skip for the page of the query.
+func (q AuditQuery) Offset() int {
+	if q.Page <= 1 {
+		return 0
+	}
+	return (q.Page - 1) * q.Limit()
+}
+
+// Limit returns the effective page size of the query.
+func (q AuditQuery) Limit() int {
+	switch {
+	case q.PageSize <= 0:
+		return DefaultPageSize
+	case q.PageSize > MaxPageSize:
+		return MaxPageSize
+	default:
+		return q.PageSize
+	}
+}
+
+// AuditRepository reads the audit log. There is no way to change it, events
+// are only written by the callbacks of the audited tables.
+type AuditRepository struct {
+	DB *gorm.DB
+}
+
+// WithContext returns a repository that runs its queries with ctx.
+func (rep *AuditRepository) WithContext(ctx context.Context) *AuditRepository {
+	return &AuditRepository{DB: rep.DB.WithContext(ctx)}
+}
+
+// Find returns a page of the events matching the query, most recent first,
+// and the number of all matching events.
+func (rep *AuditRepository) Find(q AuditQuery, opts ...QueryOption) ([]AuditEvent, int64, error) {
+	tx := applyOptions(rep.DB.Model(&AuditEvent{}), opts)
+	if q.EntityType != "" {
+		tx = tx.Where("entity_type = ?", q.EntityType)
+	}
+	if q.EntityID != 0 {
+		tx = tx.Where("entity_id = ?", q.EntityID)
+	}
+	if q.Action != "" {
+		tx = tx.Where("action = ?", q.Action)
+	}
+	if q.Actor != "" {
+		tx = tx.Where("actor = ?", q.Actor)
+	}
+	if q.From != nil {
+		tx = tx.Where("created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		tx = tx.Where("created_at < ?", *q.To)
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []AuditEvent
+	err := tx.Order("created_at DESC, id DESC").Offset(q.Offset()).Limit(q.Limit()).Find(&events).Error
+	return events, total, err
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// itemEvents returns the audit events of the given item, oldest first.
+func itemEvents(t *testing.T, db *gorm.DB, id uint) []AuditEvent {
+	var events []AuditEvent
+	require.Nil(t, db.Where("entity_type = ? AND entity_id = ?", EntityItem, id).
+		Order("id").Find(&events).Error)
+	return events
+}
+
+func changesOf(t *testing.T, event AuditEvent) map[string]FieldChange {
+	changes, err := event.FieldChanges()
+	require.Nil(t, err)
+	res := map[string]FieldChange{}
+	for _, change := range changes {
+		res[change.Field] = change
+	}
+	return res
+}
+
+func TestAudit_ItemLifecycle(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		school, err := invRepo.Create(Inventory{Name: "School"})
+		require.Nil(t, err)
+
+		user, err := (&UserRepository{DB: db}).Create("alice", "correct horse", false)
+		require.Nil(t, err)
+		itemRepo := (&ItemRepository{DB: db}).WithContext(WithActor(context.Background(), user))
+
+		item, err := itemRepo.Create(Item{Name: "Pencil", SKU: "PENCIL", InventoryID: school.ID, Quantity: 8})
+		require.Nil(t, err)
+		item.Name = "Pen"
+		item, err = itemRepo.Update(item)
+		require.Nil(t, err)
+		require.Nil(t, itemRepo.DeleteByID(item.ID))
+		require.Nil(t, itemRepo.Restore(item.ID))
+		require.Nil(t, itemRepo.DeleteByID(item.ID))
+		require.Nil(t, (&ItemRepository{DB: db}).PurgeByID(item.ID))
+
+		events := itemEvents(t, db, item.ID)
+		var actions []AuditAction
+		for _, event := range events {
+			actions = append(actions, event.Action)
+		}
+		assert.Equal(t, []AuditAction{AuditCreate, AuditUpdate, AuditUpdate, AuditDelete, AuditRestore,
+			AuditDelete, AuditPurge}, actions)
+
+		for _, event := range events[:6] {
+			assert.Equal(t, "alice", event.Actor)
+			require.NotNil(t, event.ActorID)
+			assert.Equal(t, user.ID, *event.ActorID)
+			assert.Equal(t, school.ID, event.InventoryID)
+		}
+		assert.Equal(t, SystemActor, events[6].Actor)
+		assert.Nil(t, events[6].ActorID)
+
+		created := changesOf(t, events[0])
+		assert.JSONEq(t, `"Pencil"`, string(created["name"].New))
+		assert.Nil(t, created["name"].Old)
+		assert.NotContains(t, created, "deleted_at")
+
+		received := changesOf(t, events[1])
+		assert.Equal(t, []string{"quantity"}, keys(received))
+		assert.JSONEq(t, `0`, string(received["quantity"].Old))
+		assert.JSONEq(t, `8`, string(received["quantity"].New))
+
+		renamed := changesOf(t, events[2])
+		assert.Equal(t, []string{"name"}, keys(renamed))
+		assert.JSONEq(t, `"Pencil"`, string(renamed["name"].Old))
+		assert.JSONEq(t, `"Pen"`, string(renamed["name"].New))
+
+		assert.Equal(t, []string{"deleted_at"}, keys(changesOf(t, events[3])))
+		assert.JSONEq(t, `"Pen"`, string(changesOf(t, events[6])["name"].Old))
+	})
+}
+
+func keys(changes map[string]FieldChange) []string {
+	var res []string
+	for field := range changes {
+		res = append(res, field)
+	}
+	return res
+}
+
+func TestAudit_BulkChanges(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		school, err := invRepo.Create(Inventory{Name: "School"})
+		require.Nil(t, err)
+		office, err := invRepo.Create(Inventory{Name: "Office"})
+		require.Nil(t, err)
+		itemRepo := &ItemRepository{DB: db}
+		pencil, err := itemRepo.Create(Item{Name: "Pencil", SKU: "PENCIL", InventoryID: school.ID})
+		require.Nil(t, err)
+		backpack, err := itemRepo.Create(Item{Name: "Backpack", SKU: "BACKPACK", InventoryID: school.ID})
+		require.Nil(t, err)
+
+		require.Nil(t, invRepo.MoveItemsAndDelete(school.ID, office.ID))
+		for _, item := range []Item{pencil, backpack} {
+			events := itemEvents(t, db, item.ID)
+			require.Equal(t, 2, len(events))
+			assert.Equal(t, AuditUpdate, events[1].Action)
+			assert.Equal(t, office.ID, events[1].InventoryID)
+		}
+
+		var events []AuditEvent
+		require.Nil(t, db.Where("entity_type = ? AND entity_id = ?", EntityInventory, school.ID).
+			Order("id").Find(&events).Error)
+		require.Equal(t, 2, len(events))
+		assert.Equal(t, AuditDelete, events[1].Action)
+
+		require.Nil(t, itemRepo.DeleteByID(pencil.ID))
+		require.Nil(t, itemRepo.DeleteByID(backpack.ID))
+		n, err := itemRepo.PurgeDeletedBefore(time.Now().Add(time.Hour))
+		require.Nil(t, err)
+		assert.Equal(t, int64(2), n)
+		for _, item := range []Item{pencil, backpack} {
+			events := itemEvents(t, db, item.ID)
+			assert.Equal(t, AuditPurge, events[len(events)-1].Action)
+		}
+	})
+}
+
+func TestAudit_Tags(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		inv, err := (&InventoryRepository{DB: db}).Create(Inventory{Name: "Shop"})
+		require.Nil(t, err)
+		itemRepo := &ItemRepository{DB: db}
+
+		tags, err := ParseTags("sale")
+		require.Nil(t, err)
+		vase, err := itemRepo.Create(Item{Name: "Vase", SKU: "VASE", InventoryID: inv.ID, Tags: tags})
+		require.Nil(t, err)
+
+		vase.Tags, err = ParseTags("fragile, sale")
+		require.Nil(t, err)
+		vase, err = itemRepo.Update(vase)
+		require.Nil(t, err)
+		vase.Tags, err = ParseTags("sale, fragile")
+		require.Nil(t, err)
+		_, err = itemRepo.Update(vase)
+		require.Nil(t, err)
+
+		events := itemEvents(t, db, vase.ID)
+		require.Equal(t, 2, len(events))
+		created := changesOf(t, events[0])
+		assert.JSONEq(t, `["sale"]`, string(created["tags"].New))
+		assert.Nil(t, created["tags"].Old)
+
+		assert.Equal(t, AuditUpdate, events[1].Action)
+		tagged := changesOf(t, events[1])
+		assert.Equal(t, []string{"tags"}, keys(tagged))
+		assert.JSONEq(t, `["sale"]`, string(tagged["tags"].Old))
+		assert.JSONEq(t, `["fragile","sale"]`, string(tagged["tags"].New))
+	})
+}
+
+func TestAudit_RolledBack(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		inv, err := (&InventoryRepository{DB: db}).Create(Inventory{Name: "School"})
+		require.Nil(t, err)
+
+		errAbort := errors.New("abort")
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&Item{Name: "Pencil", SKU: "PENCIL", InventoryID: inv.ID}).Error; err != nil {
+				return err
+			}
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+
+		var count int64
+		require.Nil(t, db.Model(&AuditEvent{}).Where("entity_type = ?", EntityItem).Count(&count).Error)
+		assert.Equal(t, int64(0), count)
+	})
+}
+
+func TestAuditRepository_Find(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		school, err := invRepo.Create(Inventory{Name: "School"})
+		require.Nil(t, err)
+		phones, err := invRepo.Create(Inventory{Name: "Phones"})
+		require.Nil(t, err)
+		itemRepo := &ItemRepository{DB: db}
+		pencil, err := itemRepo.Create(Item{Name: "Pencil", SKU: "PENCIL", InventoryID: school.ID, Quantity: 8})
+		require.Nil(t, err)
+		_, err = itemRepo.Create(Item{Name: "iPhone 13", SKU: "IPHONE-13", InventoryID: phones.ID})
+		require.Nil(t, err)
+
+		auditRepo := &AuditRepository{DB: db}
+		events, total, err := auditRepo.Find(AuditQuery{})
+		require.Nil(t, err)
+		assert.Equal(t, int64(5), total)
+		assert.Equal(t, 5, len(events))
+
+		events, total, err = auditRepo.Find(AuditQuery{EntityType: EntityItem, EntityID: pencil.ID})
+		require.Nil(t, err)
+		assert.Equal(t, int64(2), total)
+		assert.Equal(t, AuditUpdate, events[0].Action, "most recent first")
+
+		_, total, err = auditRepo.Find(AuditQuery{Action: AuditCreate, Actor: SystemActor})
+		require.Nil(t, err)
+		assert.Equal(t, int64(4), total)
+
+		access := Access{Roles: map[uint]Role{phones.ID: RoleViewer}}
+		_, total, err = auditRepo.Find(AuditQuery{}, access.AuditEvents(RoleViewer))
+		require.Nil(t, err)
+		assert.Equal(t, int64(2), total)
+
+		future := time.Now().Add(time.Hour)
+		_, total, err = auditRepo.Find(AuditQuery{From: &future})
+		require.Nil(t, err)
+		assert.Equal(t, int64(0), total)
+	})
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidBarcode is returned for barcodes that are not valid EAN-13 or
+	// UPC-A codes.
+	ErrInvalidBarcode = errors.New("barcode must be a valid EAN-13 or UPC-A code")
+	// ErrMissingSKU is returned for items without a SKU.
+	ErrMissingSKU = errors.New("SKU cannot be empty")
+	// ErrDuplicateSKU is returned when another item already has the SKU.
+	ErrDuplicateSKU = errors.New("SKU is already used by another item")
+	// ErrDuplicateBarcode is returned when another item already has the
+	// barcode.
+	ErrDuplicateBarcode = errors.New("barcode is already used by another item")
+)
+
+// ParseBarcode validates an EAN-13 or UPC-A barcode including its check
+// digit. UPC-A codes are returned as EAN-13 codes with a leading zero, which
+// is how EAN-13 scanners read them, so that both forms find the same item.
+func ParseBarcode(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 12 {
+		s = "0" + s
+	}
+	if len(s) != 13 {
+		return "", ErrInvalidBarcode
+	}
+	sum := 0
+	for i, c := range s {
+		if c < '0' || c > '9' {
+			return "", ErrInvalidBarcode
+		}
+		if i == 12 {
+			break
+		}
+		// Digits are weighted 1 and 3 alternately from the left.
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(c-'0') * weight
+	}
+	if check := (10 - sum%10) % 10; int(s[12]-'0') != check {
+		return "", ErrInvalidBarcode
+	}
+	return s, nil
+}
+
+// optionalString returns nil for blank strings and a pointer to the trimmed
+// string otherwise.
+func optionalString(s string) *string {
+	if s = strings.TrimSpace(s); s == "" {
+		return nil
+	}
+	return &s
+}
+
+// checkCodes normalizes the SKU and the barcode of an item, makes sure that
+// the item has a SKU and that no other item uses them. Deleted items keep
+// their codes until they are purged, so that restoring them cannot fail.
+func checkCodes(tx *gorm.DB, item *Item) error {
+	item.SKU = strings.TrimSpace(item.SKU)
+	if item.SKU == "" {
+		return ErrMissingSKU
+	}
+	if item.Barcode != nil {
+		if code := optionalString(*item.Barcode); code == nil {
+			item.Barcode = nil
+		} else {
+			barcode, err := ParseBarcode(*code)
+			if err != nil {
+				return err
+			}
+			item.Barcode = &barcode
+		}
+	}
+
+	for _, c := range []struct {
+		column string
+		value  *string
+		err    error
+	}{
+		{"sku", &item.SKU, ErrDuplicateSKU},
+		{"barcode", item.Barcode, ErrDuplicateBarcode},
+	} {
+		if c.value == nil {
+			continue
+		}
+		var count int64
+		err := tx.Unscoped().Model(&Item{}).Where(c.column+" = ? AND id <> ?", *c.value, item.ID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return c.err
+		}
+	}
+	return nil
+}
+
+// FindByCode returns the item with the given SKU or barcode. SKUs are matched
+// exactly and barcodes in either of their forms, see ParseBarcode.
+func (rep *ItemRepository) FindByCode(code string, opts ...QueryOption) (Item, error) {
+	var item Item
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return item, gorm.ErrRecordNotFound
+	}
+	cond := rep.DB.Where("items.sku = ?", code)
+	if barcode, err := ParseBarcode(code); err == nil {
+		cond = cond.Or("items.barcode = ?", barcode)
+	}
+	err := applyOptions(rep.DB, opts).Where(cond).First(&item).Error
+	return item, err
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestParseBarcode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+		ok   bool
+	}{
+		{"4006381333931", "4006381333931", true},
+		{" 036000291452 ", "0036000291452", true},
+		{"0036000291452", "0036000291452", true},
+		{"4006381333932", "", false},
+		{"036000291453", "", false},
+		{"40063813339", "", false},
+		{"40063813339a1", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		got, err := ParseBarcode(test.code)
+		if test.ok {
+			assert.Nil(t, err, test.code)
+			assert.Equal(t, test.want, got, test.code)
+		} else {
+			assert.ErrorIs(t, err, ErrInvalidBarcode, test.code)
+		}
+	}
+}
+
+func TestItemRepository_Codes(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		inv, err := (&InventoryRepository{DB: db}).Create(Inventory{Name: "Shop"})
+		assert.Nil(t, err)
+		itemRepo := &ItemRepository{DB: db}
+
+		upc := "036000291452"
+		mug, err := itemRepo.Create(Item{Name: "Mug", SKU: " MUG-1 ", InventoryID: inv.ID, Barcode: &upc})
+		assert.Nil(t, err)
+		assert.Equal(t, "MUG-1", mug.SKU)
+		assert.Equal(t, "0036000291452", *mug.Barcode)
+
+		empty := ""
+		_, err = itemRepo.Create(Item{Name: "Cup", SKU: " ", InventoryID: inv.ID})
+		assert.ErrorIs(t, err, ErrMissingSKU)
+		cup, err := itemRepo.Create(Item{Name: "Cup", SKU: "CUP", InventoryID: inv.ID, Barcode: &empty})
+		assert.Nil(t, err)
+		assert.Nil(t, cup.Barcode)
+
+		cup.SKU = mug.SKU
+		_, err = itemRepo.Update(cup)
+		assert.ErrorIs(t, err, ErrDuplicateSKU)
+		cup.SKU = "CUP"
+		ean := "0036000291452"
+		cup.Barcode = &ean
+		_, err = itemRepo.Update(cup)
+		assert.ErrorIs(t, err, ErrDuplicateBarcode)
+
+		// Deleted items keep their codes.
+		assert.Nil(t, itemRepo.DeleteByID(mug.ID))
+		_, err = itemRepo.Create(Item{Name: "Mug 2", SKU: mug.SKU, InventoryID: inv.ID})
+		assert.ErrorIs(t, err, ErrDuplicateSKU)
+		assert.Nil(t, itemRepo.Restore(mug.ID))
+
+		for _, code := range []string{"MUG-1", "036000291452", "0036000291452"} {
+			found, err := itemRepo.FindByCode(code)
+			assert.Nil(t, err, code)
+			assert.Equal(t, mug.ID, found.ID, code)
+		}
+		_, err = itemRepo.FindByCode("mug-1")
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		_, err = itemRepo.FindByCode("MUG-1", Access{Roles: map[uint]Role{}}.Items(RoleViewer))
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		items, total, err := itemRepo.Find(ItemQuery{Search: "mug-"})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, mug.ID, items[0].ID)
+	})
+}
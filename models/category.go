@@ -0,0 +1,289 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrDuplicateCategory is returned when creating a category with the name
+	// of one of its siblings.
+	ErrDuplicateCategory = errors.New("category already exists")
+	// ErrCategoryNotEmpty is returned when deleting a category that still has
+	// subcategories or items.
+	ErrCategoryNotEmpty = errors.New("category still has subcategories or items")
+	// ErrUnknownCategory is returned when an item refers to a category that
+	// does not exist.
+	ErrUnknownCategory = errors.New("unknown category")
+)
+
+// Category groups items across inventories. Categories form a tree, items of
+// a category also belong to all of its ancestors.
+type Category struct {
+	gorm.Model
+	Name     string `gorm:"not null"`
+	ParentID *uint  `gorm:"index"`
+}
+
+// CategoryNode is a category in the tree of all categories together with the
+// number of items and units in it. The own counts cover the items of the
+// category itself and the totals also those of its descendants.
+type CategoryNode struct {
+	Category
+	// Depth is 0 for top level categories.
+	Depth int
+	// Path is the names of the ancestors and the category joined by " / ".
+	Path string
+	// Children is the number of direct subcategories.
+	Children      int
+	ItemCount     int64
+	Quantity      int64
+	TotalItems    int64
+	TotalQuantity int64
+}
+
+// CategoryTree holds all categories in depth-first order, siblings sorted by
+// name.
+type CategoryTree struct {
+	Nodes []CategoryNode
+	index map[uint]int
+}
+
+// NewCategoryTree arranges the given categories in a tree. Categories whose
+// parent is missing are treated as top level categories.
+func NewCategoryTree(categories []Category) *CategoryTree {
+	children := make(map[uint][]Category)
+	exists := make(map[uint]bool, len(categories))
+	for _, c := range categories {
+		exists[c.ID] = true
+	}
+	for _, c := range categories {
+		parent := uint(0)
+		if c.ParentID != nil && exists[*c.ParentID] {
+			parent = *c.ParentID
+		}
+		children[parent] = append(children[parent], c)
+	}
+
+	tree := &CategoryTree{index: make(map[uint]int, len(categories))}
+	var walk func(parent uint, depth int, path string)
+	walk = func(parent uint, depth int, path string) {
+		siblings := children[parent]
+		sort.Slice(siblings, func(i, j int) bool { return siblings[i].Name < siblings[j].Name })
+		for _, c := range siblings {
+			node := CategoryNode{Category: c, Depth: depth, Path: c.Name, Children: len(children[c.ID])}
+			if path != "" {
+				node.Path = path + " / " + c.Name
+			}
+			tree.index[c.ID] = len(tree.Nodes)
+			tree.Nodes = append(tree.Nodes, node)
+			walk(c.ID, depth+1, node.Path)
+		}
+	}
+	walk(0, 0, "")
+	return tree
+}
+
+// Find returns the node of the given category.
+func (t *CategoryTree) Find(id uint) (CategoryNode, bool) {
+	i, ok := t.index[id]
+	if !ok {
+		return CategoryNode{}, false
+	}
+	return t.Nodes[i], true
+}
+
+// Path returns the path of the given category, or an empty string.
+func (t *CategoryTree) Path(id *uint) string {
+	if t == nil || id == nil {
+		return ""
+	}
+	node, _ := t.Find(*id)
+	return node.Path
+}
+
+// Subtree returns the IDs of the given category and all of its descendants.
+func (t *CategoryTree) Subtree(id uint) []uint {
+	i, ok := t.index[id]
+	if !ok {
+		return nil
+	}
+	ids := []uint{id}
+	// Descendants directly follow a node in depth-first order.
+	for _, node := range t.Nodes[i+1:] {
+		if node.Depth <= t.Nodes[i].Depth {
+			break
+		}
+		ids = append(ids, node.ID)
+	}
+	return ids
+}
+
+// categoryCount is the number of items and units of one category.
+type categoryCount struct {
+	CategoryID *uint
+	Items      int64
+	Quantity   int64
+}
+
+// rollUp sets the own counts of the categories and adds them up to their
+// ancestors. It returns the counts of the items without a category.
+func (t *CategoryTree) rollUp(counts []categoryCount) (uncategorized categoryCount) {
+	for i := range t.Nodes {
+		t.Nodes[i].ItemCount, t.Nodes[i].Quantity = 0, 0
+		t.Nodes[i].TotalItems, t.Nodes[i].TotalQuantity = 0, 0
+	}
+	for _, c := range counts {
+		i, ok := -1, false
+		if c.CategoryID != nil {
+			i, ok = t.index[*c.CategoryID]
+		}
+		if !ok {
+			uncategorized.Items += c.Items
+			uncategorized.Quantity += c.Quantity
+			continue
+		}
+		t.Nodes[i].ItemCount += c.Items
+		t.Nodes[i].Quantity += c.Quantity
+	}
+	// Children come after their parents, so walking backwards adds every
+	// subtree up before its root is added to its own parent.
+	for i := len(t.Nodes) - 1; i >= 0; i-- {
+		node := &t.Nodes[i]
+		node.TotalItems += node.ItemCount
+		node.TotalQuantity += node.Quantity
+		if node.ParentID == nil {
+			continue
+		}
+		if p, ok := t.index[*node.ParentID]; ok {
+			t.Nodes[p].TotalItems += node.TotalItems
+			t.Nodes[p].TotalQuantity += node.TotalQuantity
+		}
+	}
+	return uncategorized
+}
+
+// checkCategory makes sure that the category of an item exists.
+func checkCategory(tx *gorm.DB, item *Item) error {
+	if item.CategoryID == nil {
+		return nil
+	}
+	err := tx.First(&Category{}, *item.CategoryID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUnknownCategory
+	}
+	return err
+}
+
+type CategoryRepository struct {
+	DB *gorm.DB
+}
+
+// WithContext returns a repository that runs its queries with ctx.
+func (rep *CategoryRepository) WithContext(ctx context.Context) *CategoryRepository {
+	return &CategoryRepository{DB: rep.DB.WithContext(ctx)}
+}
+
+// Create creates a category under its parent, or at the top level without
+// one. Siblings must have different names.
+func (rep *CategoryRepository) Create(category Category) (Category, error) {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return category, errors.New("category name cannot be empty")
+	}
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		siblings := tx.Model(&Category{}).Where("name = ?", category.Name)
+		if category.ParentID != nil {
+			if err := tx.First(&Category{}, *category.ParentID).Error; err != nil {
+				return err
+			}
+			siblings = siblings.Where("parent_id = ?", *category.ParentID)
+		} else {
+			siblings = siblings.Where("parent_id IS NULL")
+		}
+		var count int64
+		if err := siblings.Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDuplicateCategory
+		}
+		return tx.Create(&category).Error
+	})
+	return category, err
+}
+
+func (rep *CategoryRepository) FindAll() ([]Category, error) {
+	var categories []Category
+	err := rep.DB.Order("name").Find(&categories).Error
+	return categories, err
+}
+
+// Tree returns the tree of all categories without counts.
+func (rep *CategoryRepository) Tree() (*CategoryTree, error) {
+	categories, err := rep.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	return NewCategoryTree(categories), nil
+}
+
+// CategoryReport is the number of items and units of every category, rolled
+// up through the tree.
+type CategoryReport struct {
+	Nodes                 []CategoryNode
+	UncategorizedItems    int64
+	UncategorizedQuantity int64
+}
+
+// Report counts the items and units of every category in a single query. The
+// options restrict the counted items.
+func (rep *CategoryRepository) Report(opts ...QueryOption) (CategoryReport, error) {
+	tree, err := rep.Tree()
+	if err != nil {
+		return CategoryReport{}, err
+	}
+	var counts []categoryCount
+	err = applyOptions(rep.DB.Model(&Item{}), opts).
+		Select("items.category_id, COUNT(*) AS items, SUM(items.quantity) AS quantity").
+		Group("items.category_id").Scan(&counts).Error
+	if err != nil {
+		return CategoryReport{}, err
+	}
+	uncategorized := tree.rollUp(counts)
+	return CategoryReport{
+		Nodes:                 tree.Nodes,
+		UncategorizedItems:    uncategorized.Items,
+		UncategorizedQuantity: uncategorized.Quantity,
+	}, nil
+}
+
+// DeleteByID deletes a category without subcategories and items, including
+// deleted items that may still be restored.
+func (rep *CategoryRepository) DeleteByID(id uint) error {
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		var children, items int64
+		if err := tx.Model(&Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		err := tx.Unscoped().Model(&Item{}).Where("category_id = ?", id).Count(&items).Error
+		if err != nil {
+			return err
+		}
+		if children > 0 || items > 0 {
+			return ErrCategoryNotEmpty
+		}
+		res := tx.Delete(&Category{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
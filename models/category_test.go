@@ -0,0 +1,135 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags(" Sale, fragile ,sale,,")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"fragile", "sale"}, TagNames(tags))
+
+	empty, err := ParseTags("")
+	assert.Nil(t, err)
+	assert.NotNil(t, empty)
+	assert.Empty(t, empty)
+}
+
+func TestCategories(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		inv, err := (&InventoryRepository{DB: db}).Create(Inventory{Name: "Shop"})
+		require.Nil(t, err)
+
+		categoryRepo := &CategoryRepository{DB: db}
+		clothes, err := categoryRepo.Create(Category{Name: " Clothes "})
+		require.Nil(t, err)
+		assert.Equal(t, "Clothes", clothes.Name)
+		shirts, err := categoryRepo.Create(Category{Name: "Shirts", ParentID: &clothes.ID})
+		require.Nil(t, err)
+		hats, err := categoryRepo.Create(Category{Name: "Hats", ParentID: &clothes.ID})
+		require.Nil(t, err)
+		_, err = categoryRepo.Create(Category{Name: "Shirts", ParentID: &clothes.ID})
+		assert.ErrorIs(t, err, ErrDuplicateCategory)
+		missing := uint(1000)
+		_, err = categoryRepo.Create(Category{Name: "Shoes", ParentID: &missing})
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		tree, err := categoryRepo.Tree()
+		require.Nil(t, err)
+		require.Equal(t, 3, len(tree.Nodes))
+		assert.Equal(t, "Clothes / Hats", tree.Nodes[1].Path)
+		assert.Equal(t, 1, tree.Nodes[1].Depth)
+		assert.Equal(t, 2, tree.Nodes[0].Children)
+		assert.Equal(t, "Clothes / Shirts", tree.Path(&shirts.ID))
+		assert.ElementsMatch(t, []uint{clothes.ID, shirts.ID, hats.ID}, tree.Subtree(clothes.ID))
+		assert.Equal(t, []uint{shirts.ID}, tree.Subtree(shirts.ID))
+
+		itemRepo := &ItemRepository{DB: db}
+		_, err = itemRepo.Create(Item{Name: "Tee", SKU: "TEE", InventoryID: inv.ID, Quantity: 3, CategoryID: &shirts.ID})
+		require.Nil(t, err)
+		_, err = itemRepo.Create(Item{Name: "Cap", SKU: "CAP", InventoryID: inv.ID, Quantity: 2, CategoryID: &hats.ID})
+		require.Nil(t, err)
+		_, err = itemRepo.Create(Item{Name: "Mug", SKU: "MUG", InventoryID: inv.ID, Quantity: 5})
+		require.Nil(t, err)
+		_, err = itemRepo.Create(Item{Name: "Sock", SKU: "SOCK", InventoryID: inv.ID, CategoryID: &missing})
+		assert.ErrorIs(t, err, ErrUnknownCategory)
+
+		report, err := categoryRepo.Report()
+		require.Nil(t, err)
+		assert.Equal(t, int64(0), report.Nodes[0].ItemCount)
+		assert.Equal(t, int64(2), report.Nodes[0].TotalItems)
+		assert.Equal(t, int64(5), report.Nodes[0].TotalQuantity)
+		assert.Equal(t, int64(1), report.Nodes[2].ItemCount)
+		assert.Equal(t, int64(3), report.Nodes[2].Quantity)
+		assert.Equal(t, int64(1), report.UncategorizedItems)
+		assert.Equal(t, int64(5), report.UncategorizedQuantity)
+
+		items, _, err := itemRepo.Find(ItemQuery{CategoryID: clothes.ID})
+		require.Nil(t, err)
+		assert.Equal(t, 2, len(items))
+
+		assert.ErrorIs(t, categoryRepo.DeleteByID(clothes.ID), ErrCategoryNotEmpty)
+		assert.ErrorIs(t, categoryRepo.DeleteByID(shirts.ID), ErrCategoryNotEmpty)
+		shoes, err := categoryRepo.Create(Category{Name: "Shoes", ParentID: &clothes.ID})
+		require.Nil(t, err)
+		assert.Nil(t, categoryRepo.DeleteByID(shoes.ID))
+		assert.ErrorIs(t, categoryRepo.DeleteByID(shoes.ID), gorm.ErrRecordNotFound)
+	})
+}
+
+func TestItemTags(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		inv, err := (&InventoryRepository{DB: db}).Create(Inventory{Name: "Shop"})
+		require.Nil(t, err)
+		itemRepo := &ItemRepository{DB: db}
+
+		saleTags, err := ParseTags("sale, fragile")
+		require.Nil(t, err)
+		vase, err := itemRepo.Create(Item{Name: "Vase", SKU: "VASE", InventoryID: inv.ID, Quantity: 1, Tags: saleTags})
+		require.Nil(t, err)
+		_, err = itemRepo.Create(Item{Name: "Plate", SKU: "PLATE", InventoryID: inv.ID, Quantity: 4, Tags: []Tag{{Name: "fragile"}}})
+		require.Nil(t, err)
+		_, err = itemRepo.Create(Item{Name: "Pen", SKU: "PEN", InventoryID: inv.ID, Quantity: 9})
+		require.Nil(t, err)
+
+		items, _, err := itemRepo.Find(ItemQuery{Tag: "fragile"}, WithTags())
+		require.Nil(t, err)
+		require.Equal(t, 2, len(items))
+
+		facets, err := itemRepo.Facets(ItemQuery{})
+		require.Nil(t, err)
+		assert.Equal(t, []TagFacet{{Name: "fragile", Count: 2}, {Name: "sale", Count: 1}}, facets.Tags)
+
+		// Nil tags leave the tags unchanged.
+		vase, err = itemRepo.FindByID(vase.ID)
+		require.Nil(t, err)
+		vase.Name = "Blue Vase"
+		vase, err = itemRepo.Update(vase)
+		require.Nil(t, err)
+		vase, err = itemRepo.FindByID(vase.ID, WithTags())
+		require.Nil(t, err)
+		assert.Equal(t, []string{"fragile", "sale"}, TagNames(vase.Tags))
+
+		// Any other slice replaces them.
+		vase.Tags = []Tag{}
+		_, err = itemRepo.Update(vase)
+		require.Nil(t, err)
+		vase, err = itemRepo.FindByID(vase.ID, WithTags())
+		require.Nil(t, err)
+		assert.Empty(t, vase.Tags)
+
+		// Recording a movement does not touch the tags.
+		plates, _, err := itemRepo.Find(ItemQuery{Tag: "fragile"}, WithTags())
+		require.Nil(t, err)
+		require.Equal(t, 1, len(plates))
+		_, err = (&StockMovementRepository{DB: db}).Record(plates[0].ID, ReasonReceive, 1, "")
+		require.Nil(t, err)
+		facets, err = itemRepo.Facets(ItemQuery{})
+		require.Nil(t, err)
+		assert.Equal(t, []TagFacet{{Name: "fragile", Count: 1}}, facets.Tags)
+	})
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FlashKind is the kind of a flash message, which is also its color on the
+// page.
+type FlashKind string
+
+const (
+	FlashSuccess FlashKind = "success"
+	FlashInfo    FlashKind = "info"
+	FlashWarning FlashKind = "warning"
+	FlashDanger  FlashKind = "danger"
+)
+
+// Flash is a message for a browser session that is shown once, on the next
+// page the session loads. It tells the outcome of a form that redirects, such
+// as a deleted item.
+type Flash struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	SessionID string    `gorm:"not null;index;size:64"`
+	Kind      FlashKind `gorm:"not null;size:16"`
+	Message   string    `gorm:"not null"`
+}
+
+type FlashRepository struct {
+	DB *gorm.DB
+}
+
+// WithContext returns a repository that runs its queries with ctx.
+func (rep *FlashRepository) WithContext(ctx context.Context) *FlashRepository {
+	return &FlashRepository{DB: rep.DB.WithContext(ctx)}
+}
+
+// Add adds a flash message to the session with the given ID.
+func (rep *FlashRepository) Add(sessionID string, kind FlashKind, message string) error {
+	return rep.DB.Create(&Flash{SessionID: sessionID, Kind: kind, Message: message}).Error
+}
+
+// Pop returns the flash messages of the session with the given ID in the
+// order they were added and deletes them, so that they are shown only once.
+func (rep *FlashRepository) Pop(sessionID string) ([]Flash, error) {
+	var flashes []Flash
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", sessionID).Order("id").Find(&flashes).Error; err != nil {
+			return err
+		}
+		if len(flashes) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(flashes))
+		for i, flash := range flashes {
+			ids[i] = flash.ID
+		}
+		return tx.Delete(&Flash{}, ids).Error
+	})
+	return flashes, err
+}
@@ -0,0 +1,316 @@
+package models
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Actions reported for every row of an import.
+const (
+	ImportCreated  = "created"
+	ImportUpdated  = "updated"
+	ImportRejected = "rejected"
+)
+
+// ImportRowResult is the outcome of importing a single CSV row.
+type ImportRowResult struct {
+	// Line is the line number of the row in the CSV file, starting from 1
+	// for the header.
+	Line   int
+	ItemID uint
+	Name   string
+	Action string
+	Error  string
+}
+
+// ImportReport summarizes an import. Changes are only committed when the
+// import is not a dry run and no row has been rejected.
+type ImportReport struct {
+	Rows      []ImportRowResult
+	Created   int
+	Updated   int
+	Rejected  int
+	DryRun    bool
+	Committed bool
+}
+
+// errRollback aborts an import transaction without reporting an error.
+var errRollback = errors.New("rollback")
+
+// importRowSavePoint is the savepoint that a rejected row is rolled back to.
+const importRowSavePoint = "import_row"
+
+// OptionColumnPrefix starts the names of the CSV columns that hold the values
+// of an option of variants, such as option:Size.
+const OptionColumnPrefix = "option:"
+
+// importColumns holds the index of every known column in a CSV header and the
+// option columns in header order.
+type importColumns struct {
+	index   map[string]int
+	options []optionColumn
+}
+
+type optionColumn struct {
+	name  string
+	index int
+}
+
+func (c importColumns) get(record []string, name string) string {
+	idx, ok := c.index[name]
+	if !ok {
+		return ""
+	}
+	return field(record, idx)
+}
+
+func (c importColumns) has(name string) bool {
+	_, ok := c.index[name]
+	return ok
+}
+
+func field(record []string, idx int) string {
+	if idx >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[idx])
+}
+
+func parseImportHeader(header []string) (importColumns, error) {
+	cols := importColumns{index: make(map[string]int)}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if len(name) > len(OptionColumnPrefix) &&
+			strings.EqualFold(name[:len(OptionColumnPrefix)], OptionColumnPrefix) {
+			cols.options = append(cols.options, optionColumn{name: name[len(OptionColumnPrefix):], index: i})
+			continue
+		}
+		cols.index[strings.ToLower(name)] = i
+	}
+	for _, required := range []string{"name", "inventory", "qty"} {
+		if !cols.has(required) {
+			return cols, fmt.Errorf("missing %q column", required)
+		}
+	}
+	return cols, nil
+}
+
+// ImportCSV reads items in the column layout of the CSV export. Rows with an
+// id update the existing item, other rows create a new item. Inventories are
+// resolved by name. The product column and the option columns make a row a
+// variant, and products that do not exist are created with the options of the
+// row in column order. All writes happen in one transaction, so a file with a
+// rejected row changes nothing. Every row runs in its own savepoint, so that a
+// rejected row does not abort the transaction for the rows after it. Rows are rejected unless the access includes
+// the manager role in the inventories they touch.
+func (rep *ItemRepository) ImportCSV(r io.Reader, dryRun bool, access Access) (ImportReport, error) {
+	report := ImportReport{DryRun: dryRun}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return report, errors.New("empty csv file")
+		}
+		return report, err
+	}
+	cols, err := parseImportHeader(header)
+	if err != nil {
+		return report, err
+	}
+
+	err = rep.DB.Transaction(func(tx *gorm.DB) error {
+		inventories := make(map[string]uint)
+		products := make(map[string]Product)
+		for line := 2; ; line++ {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			var res ImportRowResult
+			if err != nil {
+				res = ImportRowResult{Line: line, Action: ImportRejected, Error: err.Error()}
+			} else {
+				if err := tx.SavePoint(importRowSavePoint).Error; err != nil {
+					return err
+				}
+				res = importRow(tx, cols, record, inventories, products, access)
+				res.Line = line
+				if res.Action == ImportRejected {
+					if err := tx.RollbackTo(importRowSavePoint).Error; err != nil {
+						return err
+					}
+					// The row may have created products that are gone now.
+					products = make(map[string]Product)
+				}
+			}
+
+			switch res.Action {
+			case ImportCreated:
+				report.Created++
+			case ImportUpdated:
+				report.Updated++
+			case ImportRejected:
+				report.Rejected++
+			}
+			report.Rows = append(report.Rows, res)
+		}
+
+		if dryRun || report.Rejected > 0 {
+			return errRollback
+		}
+		return nil
+	})
+	if errors.Is(err, errRollback) {
+		return report, nil
+	}
+	if err != nil {
+		return report, err
+	}
+	report.Committed = true
+	return report, nil
+}
+
+func importRow(tx *gorm.DB, cols importColumns, record []string, inventories map[string]uint,
+	products map[string]Product, access Access) ImportRowResult {
+	res := ImportRowResult{Name: cols.get(record, "name")}
+	reject := func(format string, a ...interface{}) ImportRowResult {
+		res.Action = ImportRejected
+		res.Error = fmt.Sprintf(format, a...)
+		return res
+	}
+
+	if res.Name == "" {
+		return reject("item name cannot be empty")
+	}
+	qty, err := strconv.Atoi(cols.get(record, "qty"))
+	if err != nil || qty < 0 {
+		return reject("invalid quantity")
+	}
+	invName := cols.get(record, "inventory")
+	invID, ok := inventories[invName]
+	if !ok {
+		var inv Inventory
+		err := tx.Where("name = ?", invName).First(&inv).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return reject("unknown inventory %q", invName)
+		} else if err != nil {
+			return reject("%v", err)
+		}
+		invID = inv.ID
+		inventories[invName] = invID
+	}
+	if !access.Can(invID, RoleManager) {
+		return reject("%v in inventory %q", ErrPermissionDenied, invName)
+	}
+
+	item := Item{
+		Name:        res.Name,
+		Description: cols.get(record, "description"),
+		Quantity:    qty,
+		InventoryID: invID,
+		SKU:         cols.get(record, "sku"),
+		Barcode:     optionalString(cols.get(record, "barcode")),
+	}
+	item.ProductID, item.Options, err = importVariant(tx, cols, record, products)
+	if err != nil {
+		return reject("%v", err)
+	}
+	if cols.has("tags") {
+		if item.Tags, err = ParseTags(cols.get(record, "tags")); err != nil {
+			return reject("%v", err)
+		}
+	}
+	if strID := cols.get(record, "id"); strID != "" {
+		id, err := strconv.Atoi(strID)
+		if err != nil || id <= 0 {
+			return reject("invalid item id")
+		}
+		var existing Item
+		err = applyOptions(tx, []QueryOption{access.Items(RoleViewer)}).First(&existing, id).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return reject("item %d not found", id)
+			}
+			return reject("%v", err)
+		}
+		if !access.Can(existing.InventoryID, RoleManager) {
+			return reject("%v for item %d", ErrPermissionDenied, id)
+		}
+		existing.Name = item.Name
+		existing.Description = item.Description
+		existing.Quantity = item.Quantity
+		existing.InventoryID = item.InventoryID
+		// Files without the sku, barcode, tags or product column leave
+		// those fields as they are.
+		if cols.has("sku") {
+			existing.SKU = item.SKU
+		}
+		if cols.has("barcode") {
+			existing.Barcode = item.Barcode
+		}
+		existing.Tags = item.Tags
+		if cols.has("product") {
+			existing.ProductID = item.ProductID
+			existing.Options = item.Options
+		}
+		if err := updateItem(tx, &existing, ReasonCount, "csv import"); err != nil {
+			return reject("%v", err)
+		}
+		res.ItemID = existing.ID
+		res.Action = ImportUpdated
+		return res
+	}
+
+	if err := createItem(tx, &item); err != nil {
+		return reject("%v", err)
+	}
+	res.ItemID = item.ID
+	res.Action = ImportCreated
+	return res
+}
+
+// importVariant returns the product and the option values of a row. Products
+// are resolved by name.
+func importVariant(tx *gorm.DB, cols importColumns, record []string,
+	products map[string]Product) (*uint, OptionValues, error) {
+	values := OptionValues{}
+	var names OptionNames
+	for _, col := range cols.options {
+		if value := field(record, col.index); value != "" {
+			values[col.name] = value
+			names = append(names, col.name)
+		}
+	}
+
+	name := cols.get(record, "product")
+	if name == "" {
+		if len(values) > 0 {
+			return nil, nil, fmt.Errorf("%w: options need a product", ErrInvalidOptions)
+		}
+		return nil, nil, nil
+	}
+	product, ok := products[name]
+	if !ok {
+		err := tx.Where("name = ?", name).First(&product).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := names.validate(); err != nil {
+				return nil, nil, err
+			}
+			product = Product{Name: name, Options: names}
+			err = tx.Create(&product).Error
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		products[name] = product
+	}
+	return &product.ID, values, nil
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestItemRepository_ImportCSV(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		inv, err := invRepo.Create(Inventory{Name: "School"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		item, err := itemRepo.Create(Item{Name: "Pencil", SKU: "PENCIL", InventoryID: inv.ID, Quantity: 8})
+		assert.Nil(t, err)
+
+		header := "id,name,inventory,qty,created_at,updated_at,description,sku\n"
+		valid := header +
+			strconv.Itoa(int(item.ID)) + ",Pencil,School,12,,,Sharp,PENCIL\n" +
+			",Eraser,School,3,,,White eraser,ERASER\n"
+
+		report, err := itemRepo.ImportCSV(strings.NewReader(valid), true, FullAccess)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, report.Created)
+		assert.Equal(t, 1, report.Updated)
+		assert.False(t, report.Committed)
+		items, err := itemRepo.FindAll()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(items))
+		assert.Equal(t, 8, items[0].Quantity)
+
+		invalid := valid + ",Ruler,Garden,1,,,,RULER\n,,School,1,,,,NONAME\n,Ruler,School,1,,,,\n"
+		report, err = itemRepo.ImportCSV(strings.NewReader(invalid), false, FullAccess)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, report.Rejected)
+		assert.Contains(t, report.Rows[4].Error, ErrMissingSKU.Error())
+		assert.Equal(t, 4, report.Rows[2].Line)
+		assert.Equal(t, ImportRejected, report.Rows[2].Action)
+		assert.False(t, report.Committed)
+		items, err = itemRepo.FindAll()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(items))
+
+		report, err = itemRepo.ImportCSV(strings.NewReader(valid), false, FullAccess)
+		assert.Nil(t, err)
+		assert.True(t, report.Committed)
+		items, err = itemRepo.FindAll()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(items))
+		assert.Equal(t, 12, items[0].Quantity)
+		assert.Equal(t, "Sharp", items[0].Description)
+
+		_, err = itemRepo.ImportCSV(strings.NewReader("foo,bar\n"), false, FullAccess)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestItemRepository_ImportCSV_Variants(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		_, err := (&InventoryRepository{DB: db}).Create(Inventory{Name: "Shop"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		csv := "name,sku,inventory,qty,product,option:Size,option:Color\n" +
+			"T-shirt S Red,TS-S-RED,Shop,3,T-shirt,S,Red\n" +
+			"T-shirt M Red,TS-M-RED,Shop,5,T-shirt,M,Red\n" +
+			"Mug,MUG,Shop,2,,,\n"
+		report, err := itemRepo.ImportCSV(strings.NewReader(csv), false, FullAccess)
+		assert.Nil(t, err)
+		assert.True(t, report.Committed)
+		assert.Equal(t, 3, report.Created)
+
+		products, err := (&ProductRepository{DB: db}).FindAll()
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(products)) {
+			assert.Equal(t, OptionNames{"Size", "Color"}, products[0].Options)
+		}
+		items, err := itemRepo.FindAll()
+		assert.Nil(t, err)
+		assert.Equal(t, OptionValues{"Size": "M", "Color": "Red"}, items[1].Options)
+		assert.Nil(t, items[2].ProductID)
+
+		invalid := "name,sku,inventory,qty,product,option:Size,option:Color\n" +
+			"T-shirt L,TS-L,Shop,1,T-shirt,L,\n" +
+			"T-shirt M Red again,TS-M-RED-2,Shop,1,T-shirt,M,Red\n" +
+			"Cap,CAP,Shop,1,,L,\n"
+		report, err = itemRepo.ImportCSV(strings.NewReader(invalid), false, FullAccess)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, report.Rejected)
+		assert.Contains(t, report.Rows[1].Error, ErrDuplicateVariant.Error())
+	})
+}
+
+func TestItemRepository_ImportCSV_FailedStatement(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		_, err := (&InventoryRepository{DB: db}).Create(Inventory{Name: "Shop"})
+		require.Nil(t, err)
+
+		// Creating the item named Broken runs a statement that fails in the
+		// database, which aborts the whole transaction on Postgres unless the
+		// row is rolled back to its savepoint.
+		err = db.Callback().Create().Before("gorm:create").Register("test:broken", func(tx *gorm.DB) {
+			if item, ok := tx.Statement.Dest.(*Item); ok && item.Name == "Broken" {
+				tx.AddError(tx.Session(&gorm.Session{NewDB: true}).Exec("SELECT missing FROM items").Error)
+			}
+		})
+		require.Nil(t, err)
+
+		csv := "name,sku,inventory,qty\n" +
+			"Broken,BROKEN,Shop,1\n" +
+			"Mug,MUG,Shop,2\n"
+		itemRepo := &ItemRepository{DB: db}
+		report, err := itemRepo.ImportCSV(strings.NewReader(csv), true, FullAccess)
+		require.Nil(t, err)
+		assert.Equal(t, 1, report.Rejected)
+		assert.Equal(t, 1, report.Created)
+		require.Equal(t, 2, len(report.Rows))
+		assert.Equal(t, ImportCreated, report.Rows[1].Action, report.Rows[1].Error)
+	})
+}
@@ -1,19 +1,52 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
 
-// Inventory denotes an inventory.
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInventoryNotEmpty is returned when deleting an inventory that still
+	// holds items.
+	ErrInventoryNotEmpty = errors.New("inventory still holds items")
+	// ErrDuplicateInventory is returned when creating or renaming an inventory
+	// with the name of another one.
+	ErrDuplicateInventory = errors.New("inventory name already used")
+)
+
+// Inventory denotes an inventory. Deleted inventories are renamed, so that
+// their names can be used again.
 type Inventory struct {
 	gorm.Model
 	Name string `gorm:"not null;unique"`
+	// ReorderPoint and ReorderQuantity are the defaults of the items of the
+	// inventory. See Item for their meaning.
+	ReorderPoint    *int
+	ReorderQuantity *int
 }
 
 type InventoryRepository struct {
 	DB *gorm.DB
 }
 
+// WithContext returns a repository that runs its queries with the given
+// context, which attributes its changes to the actor of the context and its
+// log entries to the request of the context.
+func (rep *InventoryRepository) WithContext(ctx context.Context) *InventoryRepository {
+	return &InventoryRepository{DB: rep.DB.WithContext(ctx)}
+}
+
 func (rep *InventoryRepository) Create(inventory Inventory) (Inventory, error) {
-	err := rep.DB.Create(&inventory).Error
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkInventoryName(tx, inventory); err != nil {
+			return err
+		}
+		return tx.Create(&inventory).Error
+	})
 	return inventory, err
 }
 
@@ -23,18 +56,154 @@ func (rep *InventoryRepository) FirstOrCreate(inventory Inventory) (Inventory, e
 	return res, err
 }
 
-func (rep *InventoryRepository) FindByID(id uint) (Inventory, error) {
+func (rep *InventoryRepository) FindByID(id uint, opts ...QueryOption) (Inventory, error) {
 	var inventory Inventory
-	err := rep.DB.First(&inventory, id).Error
+	err := applyOptions(rep.DB, opts).First(&inventory, id).Error
 	return inventory, err
 }
 
-func (rep *InventoryRepository) FindAll() ([]Inventory, error) {
+func (rep *InventoryRepository) FindAll(opts ...QueryOption) ([]Inventory, error) {
 	var inventories []Inventory
-	err := rep.DB.Find(&inventories).Error
+	err := applyOptions(rep.DB, opts).Find(&inventories).Error
 	return inventories, err
 }
 
+func (rep *InventoryRepository) Update(inventory Inventory) (Inventory, error) {
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkInventoryName(tx, inventory); err != nil {
+			return err
+		}
+		return tx.Save(&inventory).Error
+	})
+	return inventory, err
+}
+
+// checkInventoryName makes sure that no other inventory has the name of the
+// given one.
+func checkInventoryName(tx *gorm.DB, inventory Inventory) error {
+	var count int64
+	err := tx.Model(&Inventory{}).Where("name = ? AND id <> ?", inventory.Name, inventory.ID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateInventory
+	}
+	return nil
+}
+
+// CountItems returns the number of items held by the given inventory,
+// including deleted items that can still be restored.
+func (rep *InventoryRepository) CountItems(id uint) (int64, error) {
+	return countInventoryItems(rep.DB, id)
+}
+
+func countInventoryItems(tx *gorm.DB, id uint) (int64, error) {
+	var count int64
+	err := tx.Unscoped().Model(&Item{}).Where("inventory_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// InventoryStock sums up the items of an inventory.
+type InventoryStock struct {
+	InventoryID uint
+	Name        string
+	Items       int64
+	Units       int64
+	// OutOfStock is the number of items at zero stock.
+	OutOfStock int64
+}
+
+// Stock sums up the items of every inventory in a single query, including
+// inventories without items.
+func (rep *InventoryRepository) Stock() ([]InventoryStock, error) {
+	var stock []InventoryStock
+	err := rep.DB.Model(&Inventory{}).
+		Select("inventories.id AS inventory_id, inventories.name AS name, COUNT(items.id) AS items, " +
+			"COALESCE(SUM(items.quantity), 0) AS units, " +
+			"COALESCE(SUM(CASE WHEN items.quantity = 0 THEN 1 ELSE 0 END), 0) AS out_of_stock").
+		Joins("LEFT JOIN items ON items.inventory_id = inventories.id AND items.deleted_at IS NULL").
+		Group("inventories.id, inventories.name").Order("inventories.id").Scan(&stock).Error
+	return stock, err
+}
+
+// CountAllItems returns the number of items of every inventory in a single
+// query. Inventories without items are left out.
+func (rep *InventoryRepository) CountAllItems() (map[uint]int64, error) {
+	var rows []struct {
+		InventoryID uint
+		Count       int64
+	}
+	err := rep.DB.Model(&Item{}).Select("inventory_id, COUNT(*) AS count").
+		Group("inventory_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.InventoryID] = row.Count
+	}
+	return counts, nil
+}
+
+// DeleteByID deletes the given inventory. It refuses to delete an inventory
+// that still holds items, deleted ones included, and returns
+// ErrInventoryNotEmpty.
+func (rep *InventoryRepository) DeleteByID(id uint) error {
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteInventory(tx, id)
+	})
+}
+
+// MoveItemsAndDelete moves all items of the given inventory to the target
+// inventory and then deletes it, all in one transaction. Deleted items are
+// moved too, so that they can still be restored.
+func (rep *InventoryRepository) MoveItemsAndDelete(id, targetID uint) error {
+	if id == targetID {
+		return errors.New("cannot move items to the deleted inventory")
+	}
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&Inventory{}, targetID).Error; err != nil {
+			return err
+		}
+		err := tx.Unscoped().Model(&Item{}).Where("inventory_id = ?", id).
+			Updates(map[string]interface{}{"inventory_id": targetID, "version": gorm.Expr("version + 1")}).Error
+		if err != nil {
+			return err
+		}
+		return deleteInventory(tx, id)
+	})
+}
+
+func deleteInventory(tx *gorm.DB, id uint) error {
+	count, err := countInventoryItems(tx, id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrInventoryNotEmpty
+	}
+	var inventory Inventory
+	if err := tx.First(&inventory, id).Error; err != nil {
+		return err
+	}
+	err = tx.Model(&inventory).Updates(map[string]interface{}{
+		"name":       deletedInventoryName(inventory.Name, inventory.ID),
+		"deleted_at": tx.NowFunc(),
+	}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("inventory_id = ?", id).Delete(&InventoryRole{}).Error
+}
+
+// deletedInventoryName is the name that a deleted inventory is renamed to. It
+// includes the ID, so it is unique too.
+func deletedInventoryName(name string, id uint) string {
+	return fmt.Sprintf("%s (deleted #%d)", name, id)
+}
+
 // Item is an inventory item.
 type Item struct {
 	gorm.Model
@@ -43,40 +212,276 @@ type Item struct {
 	Quantity    int    `gorm:"default:0"`
 	InventoryID uint   `gorm:"not null"`
 	Inventory   Inventory
+	// ReorderPoint is the quantity at or below which the item is low on stock
+	// and ReorderQuantity is the suggested quantity to order then. When nil,
+	// the defaults of the inventory apply.
+	ReorderPoint    *int
+	ReorderQuantity *int
+	// ProductID is the product the item is a variant of, if any. Options
+	// then holds a value for every option of the product.
+	ProductID *uint `gorm:"index"`
+	Product   *Product
+	Options   OptionValues `gorm:"type:text"`
+	// CategoryID is the category of the item, if any.
+	CategoryID *uint `gorm:"index"`
+	// Tags are only loaded with WithTags. When creating or updating an item,
+	// nil tags leave its tags as they are and any other slice replaces them.
+	Tags []Tag `gorm:"many2many:item_tags"`
+	// SKU is the stock keeping unit of the item and Barcode its optional
+	// EAN-13 barcode, see ParseBarcode. Every item has a SKU. Both are unique
+	// among all items, including deleted ones.
+	SKU     string  `gorm:"size:64;not null;uniqueIndex"`
+	Barcode *string `gorm:"size:13;uniqueIndex"`
+	// Version is incremented on every change of the item. Updates carry the
+	// version they are based on and fail with ErrVersionConflict if the item
+	// has changed since.
+	Version uint `gorm:"not null;default:1"`
 }
 
+// ErrVersionConflict is returned when updating an item that has been changed
+// since it was read.
+var ErrVersionConflict = errors.New("item has been changed by someone else")
+
 type ItemRepository struct {
 	DB *gorm.DB
 }
 
+// WithContext returns a repository that runs its queries with the given
+// context, which attributes its changes to the actor of the context and its
+// log entries to the request of the context.
+func (rep *ItemRepository) WithContext(ctx context.Context) *ItemRepository {
+	return &ItemRepository{DB: rep.DB.WithContext(ctx)}
+}
+
 func (rep *ItemRepository) Create(item Item) (Item, error) {
-	err := rep.DB.Create(&item).Error
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		return createItem(tx, &item)
+	})
 	return item, err
 }
 
 func (rep *ItemRepository) FirstOrCreate(item Item) (Item, error) {
 	var res Item
-	err := rep.DB.FirstOrCreate(&res, item).Error
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where(item).First(&res).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			res = item
+			return createItem(tx, &res)
+		}
+		return err
+	})
 	return res, err
 }
 
+// Update saves the given item. A change of quantity is recorded as an adjust
+// movement in the stock ledger. The version of the item must match the stored
+// one, otherwise ErrVersionConflict is returned.
 func (rep *ItemRepository) Update(item Item) (Item, error) {
-	err := rep.DB.Save(&item).Error
+	return rep.UpdateWithMovement(item, ReasonAdjust, "")
+}
+
+// UpdateWithMovement saves the given item and records a change of quantity
+// as a movement with the given reason and note.
+func (rep *ItemRepository) UpdateWithMovement(item Item, reason MovementReason, note string) (Item, error) {
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		return updateItem(tx, &item, reason, note)
+	})
 	return item, err
 }
 
+// createItem creates an item with zero quantity and records its initial
+// quantity as a receive movement, so the ledger covers the whole stock.
+func createItem(tx *gorm.DB, item *Item) error {
+	if err := checkVariant(tx, item); err != nil {
+		return err
+	}
+	if err := checkCodes(tx, item); err != nil {
+		return err
+	}
+	if err := checkCategory(tx, item); err != nil {
+		return err
+	}
+	qty := item.Quantity
+	item.Quantity = 0
+	create, err := withTagsChange(tx, nil, TagNames(item.Tags))
+	if err != nil {
+		return err
+	}
+	if err := create.Omit("Tags").Create(item).Error; err != nil {
+		return err
+	}
+	if item.Tags != nil {
+		if err := setItemTags(tx, item.ID, item.Tags); err != nil {
+			return err
+		}
+	}
+	if qty == 0 {
+		return nil
+	}
+	return applyMovement(tx, item, &StockMovement{
+		Delta:  qty,
+		Reason: ReasonReceive,
+		Note:   "initial stock",
+	})
+}
+
+// updateItem saves the editable fields of the item if its version is still
+// the stored one and brings the quantity to the given value through a stock
+// movement. On success item holds the stored item.
+func updateItem(tx *gorm.DB, item *Item, reason MovementReason, note string) error {
+	var current Item
+	if err := tx.First(&current, item.ID).Error; err != nil {
+		return err
+	}
+	if current.Version != item.Version {
+		return ErrVersionConflict
+	}
+	if err := checkVariant(tx, item); err != nil {
+		return err
+	}
+	if err := checkCodes(tx, item); err != nil {
+		return err
+	}
+	if err := checkCategory(tx, item); err != nil {
+		return err
+	}
+	update := tx
+	if item.Tags != nil {
+		var tags []Tag
+		if err := tx.Model(&current).Association("Tags").Find(&tags); err != nil {
+			return err
+		}
+		var err error
+		if update, err = withTagsChange(tx, TagNames(tags), TagNames(item.Tags)); err != nil {
+			return err
+		}
+	}
+	res := update.Model(&Item{}).Where("id = ? AND version = ?", item.ID, item.Version).
+		Updates(map[string]interface{}{
+			"name":             item.Name,
+			"description":      item.Description,
+			"inventory_id":     item.InventoryID,
+			"reorder_point":    item.ReorderPoint,
+			"reorder_quantity": item.ReorderQuantity,
+			"product_id":       item.ProductID,
+			"options":          item.Options,
+			"sku":              item.SKU,
+			"barcode":          item.Barcode,
+			"category_id":      item.CategoryID,
+			"version":          gorm.Expr("version + 1"),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	if item.Tags != nil {
+		if err := setItemTags(tx, item.ID, item.Tags); err != nil {
+			return err
+		}
+	}
+	qty := item.Quantity
+	if err := tx.First(item, item.ID).Error; err != nil {
+		return err
+	}
+
+	delta := qty - item.Quantity
+	if delta == 0 {
+		return nil
+	}
+	if !ValidMovementReason(reason) || (reason == ReasonReceive && delta < 0) ||
+		(reason == ReasonShip && delta > 0) {
+		return ErrInvalidMovement
+	}
+	return applyMovement(tx, item, &StockMovement{Delta: delta, Reason: reason, Note: note})
+}
+
 func (rep *ItemRepository) DeleteByID(id uint) error {
 	return rep.DB.Delete(&Item{}, id).Error
 }
 
-func (rep *ItemRepository) FindByID(id uint) (Item, error) {
+func (rep *ItemRepository) FindByID(id uint, opts ...QueryOption) (Item, error) {
 	var item Item
-	err := rep.DB.First(&item, id).Error
+	err := applyOptions(rep.DB, opts).First(&item, id).Error
 	return item, err
 }
 
-func (rep *ItemRepository) FindAll() ([]Item, error) {
+func (rep *ItemRepository) FindAll(opts ...QueryOption) ([]Item, error) {
+	var items []Item
+	err := applyOptions(rep.DB, opts).Find(&items).Error
+	return items, err
+}
+
+// ErrInventoryDeleted is returned when restoring an item whose inventory has
+// been deleted.
+var ErrInventoryDeleted = errors.New("inventory of the item has been deleted")
+
+// FindDeleted returns soft-deleted items, most recently deleted first. The
+// inventory of every item is loaded even if it has been deleted too.
+func (rep *ItemRepository) FindDeleted(opts ...QueryOption) ([]Item, error) {
 	var items []Item
-	err := rep.DB.Find(&items).Error
+	err := applyOptions(rep.DB, opts).Unscoped().
+		Preload("Inventory", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&items).Error
 	return items, err
 }
+
+// FindDeletedByID returns a soft-deleted item.
+func (rep *ItemRepository) FindDeletedByID(id uint, opts ...QueryOption) (Item, error) {
+	var item Item
+	err := applyOptions(rep.DB, opts).Unscoped().Where("deleted_at IS NOT NULL").First(&item, id).Error
+	return item, err
+}
+
+// Restore brings back a soft-deleted item.
+func (rep *ItemRepository) Restore(id uint) error {
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		var item Item
+		err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&item, id).Error
+		if err != nil {
+			return err
+		}
+		err = tx.First(&Inventory{}, item.InventoryID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInventoryDeleted
+		} else if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&item).Update("deleted_at", nil).Error
+	})
+}
+
+// PurgeByID permanently deletes a soft-deleted item. Its stock movements stay
+// in the ledger.
+func (rep *ItemRepository) PurgeByID(id uint) error {
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		var item Item
+		err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&item, id).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("item_id = ?", id).Delete(&ItemTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&item).Error
+	})
+}
+
+// PurgeDeletedBefore permanently deletes items that have been soft-deleted
+// before the given time and returns the number of purged items. Their stock
+// movements stay in the ledger.
+func (rep *ItemRepository) PurgeDeletedBefore(t time.Time) (int64, error) {
+	var n int64
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&Item{}).Select("id").
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", t)
+		if err := tx.Where("item_id IN (?)", expired).Delete(&ItemTag{}).Error; err != nil {
+			return err
+		}
+		res := tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", t).Delete(&Item{})
+		n = res.RowsAffected
+		return res.Error
+	})
+	return n, err
+}
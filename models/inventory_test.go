@@ -1,21 +1,37 @@
 package models
 
 import (
-	"log"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
+	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 )
 
-func setupDB() (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+// testDSNs returns the databases the repository tests run against. It is an
+// in-memory SQLite database unless TEST_DSNS lists others, separated by
+// spaces.
+func testDSNs() []string {
+	if dsns := strings.Fields(os.Getenv("TEST_DSNS")); len(dsns) > 0 {
+		return dsns
+	}
+	return []string{"sqlite://:memory:"}
+}
+
+func setupDB(dsn string) (*gorm.DB, error) {
+	db, err := Open(dsn, &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
 
+	// Start from an empty schema on servers that outlive the tests.
+	if _, err := NewMigrator(db).Down(-1); err != nil {
+		return nil, err
+	}
 	err = Migrate(db)
 	if err != nil {
 		return nil, err
@@ -23,64 +39,250 @@ func setupDB() (*gorm.DB, error) {
 	return db, err
 }
 
-func tearDownDB() error {
-	return os.Remove("test.db")
+// tearDownDB reverts every migration, which also tests the down migrations.
+func tearDownDB(db *gorm.DB) error {
+	if _, err := NewMigrator(db).Down(-1); err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
 
-func TestInventoryRepository(t *testing.T) {
-	db, err := setupDB()
-	if err != nil {
-		log.Fatal(err)
+// forEachDB runs the given test against an empty database of every test
+// backend.
+func forEachDB(t *testing.T, test func(t *testing.T, db *gorm.DB)) {
+	for _, dsn := range testDSNs() {
+		t.Run(strings.SplitN(dsn, "://", 2)[0], func(t *testing.T) {
+			db, err := setupDB(dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if err := tearDownDB(db); err != nil {
+					t.Fatal(err)
+				}
+			}()
+			test(t, db)
+		})
 	}
-	defer func() {
-		if err := tearDownDB(); err != nil {
-			log.Fatal(err)
-		}
-	}()
-
-	inv := Inventory{Name: "test"}
-	invRepo := &InventoryRepository{DB: db}
-	createdInv, err := invRepo.Create(inv)
-	assert.Nil(t, err)
-	assert.NotEqual(t, createdInv.ID, 0)
-	assert.Equal(t, createdInv.Name, inv.Name)
-
-	foundInv, err := invRepo.FindByID(createdInv.ID)
-	assert.Nil(t, err)
-	assert.Equal(t, foundInv.ID, createdInv.ID)
-	assert.Equal(t, foundInv.Name, createdInv.Name)
+}
+
+func TestInventoryRepository(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		inv := Inventory{Name: "test"}
+		invRepo := &InventoryRepository{DB: db}
+		createdInv, err := invRepo.Create(inv)
+		assert.Nil(t, err)
+		assert.NotEqual(t, createdInv.ID, 0)
+		assert.Equal(t, createdInv.Name, inv.Name)
+
+		foundInv, err := invRepo.FindByID(createdInv.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, foundInv.ID, createdInv.ID)
+		assert.Equal(t, foundInv.Name, createdInv.Name)
+	})
 }
 
 func TestItemRepository(t *testing.T) {
-	db, err := setupDB()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer func() {
-		if err := tearDownDB(); err != nil {
-			log.Fatal(err)
-		}
-	}()
-
-	invRepo := &InventoryRepository{DB: db}
-	inv, err := invRepo.Create(Inventory{Name: "test"})
-	assert.Nil(t, err)
-
-	itemRepo := &ItemRepository{DB: db}
-	item := Item{Name: "t1", InventoryID: inv.ID, Quantity: 8,
-		Description: "d1"}
-
-	createdItem, err := itemRepo.Create(item)
-	assert.Nil(t, err)
-	assert.NotEqual(t, createdItem.ID, 0)
-	assert.Equal(t, createdItem.Name, item.Name)
-
-	foundItem, err := itemRepo.FindByID(createdItem.ID)
-	assert.Nil(t, err)
-	assert.Equal(t, foundItem.ID, createdItem.ID)
-	assert.Equal(t, foundItem.Name, createdItem.Name)
-
-	item.Quantity += 1
-	updatedItem, err := itemRepo.Update(item)
-	assert.Equal(t, updatedItem.Quantity, item.Quantity)
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		inv, err := invRepo.Create(Inventory{Name: "test"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		item := Item{Name: "t1", SKU: "T1", InventoryID: inv.ID, Quantity: 8,
+			Description: "d1"}
+
+		createdItem, err := itemRepo.Create(item)
+		assert.Nil(t, err)
+		assert.NotEqual(t, createdItem.ID, 0)
+		assert.Equal(t, createdItem.Name, item.Name)
+
+		foundItem, err := itemRepo.FindByID(createdItem.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, foundItem.ID, createdItem.ID)
+		assert.Equal(t, foundItem.Name, createdItem.Name)
+
+		foundItem.Quantity += 1
+		updatedItem, err := itemRepo.Update(foundItem)
+		assert.Nil(t, err)
+		assert.Equal(t, foundItem.Quantity, updatedItem.Quantity)
+
+		_, err = itemRepo.Update(item)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "the item has no ID")
+	})
+}
+
+func TestItemRepository_VersionConflict(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		inv, err := invRepo.Create(Inventory{Name: "test"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		item, err := itemRepo.Create(Item{Name: "t1", SKU: "T1", InventoryID: inv.ID, Quantity: 8})
+		assert.Nil(t, err)
+		assert.Equal(t, uint(2), item.Version)
+
+		first, second := item, item
+		first.Name = "first"
+		first, err = itemRepo.Update(first)
+		assert.Nil(t, err)
+		assert.Equal(t, uint(3), first.Version)
+		assert.Equal(t, item.CreatedAt.Unix(), first.CreatedAt.Unix())
+
+		second.Name = "second"
+		_, err = itemRepo.Update(second)
+		assert.ErrorIs(t, err, ErrVersionConflict)
+
+		found, err := itemRepo.FindByID(item.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "first", found.Name)
+		assert.Equal(t, first.Version, found.Version)
+	})
+}
+
+func TestInventoryRepository_Delete(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		inv1, err := invRepo.Create(Inventory{Name: "test1"})
+		assert.Nil(t, err)
+		inv2, err := invRepo.Create(Inventory{Name: "test2"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		_, err = itemRepo.Create(Item{Name: "t1", SKU: "T1", InventoryID: inv1.ID, Quantity: 8})
+		assert.Nil(t, err)
+		deleted, err := itemRepo.Create(Item{Name: "t2", SKU: "T2", InventoryID: inv1.ID})
+		assert.Nil(t, err)
+		assert.Nil(t, itemRepo.DeleteByID(deleted.ID))
+
+		err = invRepo.DeleteByID(inv1.ID)
+		assert.ErrorIs(t, err, ErrInventoryNotEmpty)
+
+		// Deleted items keep the inventory from being deleted too.
+		empty, err := invRepo.Create(Inventory{Name: "test3"})
+		assert.Nil(t, err)
+		binned, err := itemRepo.Create(Item{Name: "t3", SKU: "T3", InventoryID: empty.ID})
+		assert.Nil(t, err)
+		assert.Nil(t, itemRepo.DeleteByID(binned.ID))
+		count, err := invRepo.CountItems(empty.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), count)
+		assert.ErrorIs(t, invRepo.DeleteByID(empty.ID), ErrInventoryNotEmpty)
+
+		err = invRepo.MoveItemsAndDelete(inv1.ID, inv2.ID)
+		assert.Nil(t, err)
+		count, err = invRepo.CountItems(inv2.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), count)
+		assert.Nil(t, itemRepo.Restore(deleted.ID))
+
+		_, err = invRepo.FindByID(inv1.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		err = invRepo.DeleteByID(inv1.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+}
+
+func TestInventoryRepository_DuplicateName(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		school, err := invRepo.Create(Inventory{Name: "School"})
+		require.Nil(t, err)
+		office, err := invRepo.Create(Inventory{Name: "Office"})
+		require.Nil(t, err)
+
+		_, err = invRepo.Create(Inventory{Name: "School"})
+		assert.ErrorIs(t, err, ErrDuplicateInventory)
+		office.Name = "School"
+		_, err = invRepo.Update(office)
+		assert.ErrorIs(t, err, ErrDuplicateInventory)
+		_, err = invRepo.Update(school)
+		assert.Nil(t, err, "an inventory keeps its own name")
+
+		require.Nil(t, invRepo.DeleteByID(school.ID))
+		_, err = invRepo.Create(Inventory{Name: "School"})
+		assert.Nil(t, err, "names of deleted inventories can be used again")
+
+		var deleted Inventory
+		require.Nil(t, db.Unscoped().First(&deleted, school.ID).Error)
+		assert.Equal(t, fmt.Sprintf("School (deleted #%d)", school.ID), deleted.Name)
+	})
+}
+
+func TestInventoryRepository_Stock(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		shop, err := invRepo.Create(Inventory{Name: "Shop"})
+		assert.Nil(t, err)
+		empty, err := invRepo.Create(Inventory{Name: "Empty"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		_, err = itemRepo.Create(Item{Name: "Pen", SKU: "PEN", InventoryID: shop.ID, Quantity: 8})
+		assert.Nil(t, err)
+		_, err = itemRepo.Create(Item{Name: "Ink", SKU: "INK", InventoryID: shop.ID})
+		assert.Nil(t, err)
+		deleted, err := itemRepo.Create(Item{Name: "Pad", SKU: "PAD", InventoryID: shop.ID, Quantity: 3})
+		assert.Nil(t, err)
+		assert.Nil(t, itemRepo.DeleteByID(deleted.ID))
+
+		stock, err := invRepo.Stock()
+		assert.Nil(t, err)
+		assert.Equal(t, []InventoryStock{
+			{InventoryID: shop.ID, Name: "Shop", Items: 2, Units: 8, OutOfStock: 1},
+			{InventoryID: empty.ID, Name: "Empty"},
+		}, stock)
+	})
+}
+
+func TestItemRepository_RecycleBin(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		inv, err := invRepo.Create(Inventory{Name: "test"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		item1, err := itemRepo.Create(Item{Name: "t1", SKU: "T1", InventoryID: inv.ID})
+		assert.Nil(t, err)
+		item2, err := itemRepo.Create(Item{Name: "t2", SKU: "T2", InventoryID: inv.ID, Quantity: 3})
+		assert.Nil(t, err)
+
+		assert.Nil(t, itemRepo.DeleteByID(item1.ID))
+		assert.Nil(t, itemRepo.DeleteByID(item2.ID))
+		deleted, err := itemRepo.FindDeleted()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(deleted))
+		assert.Equal(t, inv.Name, deleted[0].Inventory.Name)
+
+		assert.Nil(t, itemRepo.Restore(item1.ID))
+		_, err = itemRepo.FindByID(item1.ID)
+		assert.Nil(t, err)
+		assert.ErrorIs(t, itemRepo.Restore(item1.ID), gorm.ErrRecordNotFound)
+
+		n, err := itemRepo.PurgeDeletedBefore(time.Now().Add(-time.Hour))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), n)
+		n, err = itemRepo.PurgeDeletedBefore(time.Now().Add(time.Hour))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+		_, err = itemRepo.FindDeletedByID(item2.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		// The ledger keeps the movements of purged items.
+		movementRepo := &StockMovementRepository{DB: db}
+		movements, err := movementRepo.FindByItemID(item2.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(movements))
+		qty, err := movementRepo.QuantityAt(item2.ID, time.Now())
+		assert.Nil(t, err)
+		assert.Equal(t, 3, qty)
+
+		assert.ErrorIs(t, itemRepo.PurgeByID(item1.ID), gorm.ErrRecordNotFound)
+	})
 }
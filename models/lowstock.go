@@ -0,0 +1,57 @@
+package models
+
+// EffectiveReorderPoint returns the reorder point of the item, falling back to
+// the default of its inventory. The inventory has to be loaded. The second
+// value is false if neither is set.
+func (item Item) EffectiveReorderPoint() (int, bool) {
+	if item.ReorderPoint != nil {
+		return *item.ReorderPoint, true
+	}
+	if item.Inventory.ReorderPoint != nil {
+		return *item.Inventory.ReorderPoint, true
+	}
+	return 0, false
+}
+
+// EffectiveReorderQuantity returns the reorder quantity of the item, falling
+// back to the default of its inventory. The inventory has to be loaded.
+func (item Item) EffectiveReorderQuantity() (int, bool) {
+	if item.ReorderQuantity != nil {
+		return *item.ReorderQuantity, true
+	}
+	if item.Inventory.ReorderQuantity != nil {
+		return *item.Inventory.ReorderQuantity, true
+	}
+	return 0, false
+}
+
+// LowStock reports whether the quantity of the item has reached its reorder
+// point. The inventory has to be loaded.
+func (item Item) LowStock() bool {
+	point, ok := item.EffectiveReorderPoint()
+	return ok && item.Quantity <= point
+}
+
+// SuggestedOrder returns the quantity to order for a low stock item. Without
+// a reorder quantity it suggests refilling up to the reorder point.
+func (item Item) SuggestedOrder() int {
+	if qty, ok := item.EffectiveReorderQuantity(); ok {
+		return qty
+	}
+	point, _ := item.EffectiveReorderPoint()
+	if point > item.Quantity {
+		return point - item.Quantity
+	}
+	return 0
+}
+
+// FindLowStock returns the items whose quantity has reached their reorder
+// point, with their inventories loaded, the lowest quantities first.
+func (rep *ItemRepository) FindLowStock(opts ...QueryOption) ([]Item, error) {
+	var items []Item
+	err := applyOptions(rep.DB, opts).Preload("Inventory").
+		Joins("JOIN inventories ON inventories.id = items.inventory_id").
+		Where("items.quantity <= COALESCE(items.reorder_point, inventories.reorder_point)").
+		Order("items.quantity, items.id").Find(&items).Error
+	return items, err
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestItemRepository_FindLowStock(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		five, two, ten := 5, 2, 10
+		invRepo := &InventoryRepository{DB: db}
+		school, err := invRepo.Create(Inventory{Name: "School", ReorderPoint: &five, ReorderQuantity: &ten})
+		assert.Nil(t, err)
+		phones, err := invRepo.Create(Inventory{Name: "Phones"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		for _, item := range []Item{
+			{Name: "Pencil", SKU: "PENCIL", InventoryID: school.ID, Quantity: 4},
+			{Name: "Backpack", SKU: "BACKPACK", InventoryID: school.ID, Quantity: 4, ReorderPoint: &two},
+			{Name: "Eraser", SKU: "ERASER", InventoryID: school.ID, Quantity: 5},
+			{Name: "iPhone 13", SKU: "IPHONE-13", InventoryID: phones.ID, Quantity: 0},
+			{Name: "Pixel", SKU: "PIXEL", InventoryID: phones.ID, Quantity: 2, ReorderPoint: &two},
+		} {
+			_, err := itemRepo.Create(item)
+			assert.Nil(t, err)
+		}
+
+		items, err := itemRepo.FindLowStock()
+		assert.Nil(t, err)
+		var names []string
+		for _, item := range items {
+			names = append(names, item.Name)
+			assert.True(t, item.LowStock())
+		}
+		assert.Equal(t, []string{"Pixel", "Pencil", "Eraser"}, names)
+		assert.Equal(t, 10, items[1].SuggestedOrder())
+		assert.Equal(t, 0, items[0].SuggestedOrder())
+	})
+}
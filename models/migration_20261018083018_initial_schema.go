@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+// The models as of the initial schema. Migrations keep their own copies of the
+// models, so that they do not change along with the models.
+
+type initialInventory struct {
+	gorm.Model
+	Name            string `gorm:"not null;unique"`
+	ReorderPoint    *int
+	ReorderQuantity *int
+}
+
+func (initialInventory) TableName() string { return "inventories" }
+
+type initialItem struct {
+	gorm.Model
+	Name            string `gorm:"not null"`
+	Description     string `sql:"type:text"`
+	Quantity        int    `gorm:"default:0"`
+	InventoryID     uint   `gorm:"not null"`
+	Inventory       initialInventory
+	ReorderPoint    *int
+	ReorderQuantity *int
+	Version         uint `gorm:"not null;default:1"`
+}
+
+func (initialItem) TableName() string { return "items" }
+
+type initialStockMovement struct {
+	ID            uint      `gorm:"primarykey"`
+	CreatedAt     time.Time `gorm:"index"`
+	ItemID        uint      `gorm:"not null;index"`
+	Item          initialItem
+	Delta         int    `gorm:"not null"`
+	QuantityAfter int    `gorm:"not null"`
+	Reason        string `gorm:"not null"`
+	Note          string
+}
+
+func (initialStockMovement) TableName() string { return "stock_movements" }
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018083018,
+		Name:    "initial_schema",
+		// Databases created before migrations were introduced already have
+		// the tables, which AutoMigrate brings up to date.
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&initialInventory{}, &initialItem{}, &initialStockMovement{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&initialStockMovement{}, &initialItem{}, &initialInventory{})
+		},
+	})
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+type usersUser struct {
+	gorm.Model
+	Username     string `gorm:"not null;unique"`
+	PasswordHash string `gorm:"not null"`
+	Admin        bool   `gorm:"not null;default:false"`
+}
+
+func (usersUser) TableName() string { return "users" }
+
+type usersSession struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UserID    uint      `gorm:"not null;index"`
+	User      usersUser
+}
+
+func (usersSession) TableName() string { return "sessions" }
+
+type usersAccessToken struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint `gorm:"not null;index"`
+	User       usersUser
+	Name       string `gorm:"not null"`
+	TokenHash  string `gorm:"not null;uniqueIndex;size:64"`
+	LastUsedAt *time.Time
+}
+
+func (usersAccessToken) TableName() string { return "access_tokens" }
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018083249,
+		Name:    "users",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&usersUser{}, &usersSession{}, &usersAccessToken{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&usersAccessToken{}, &usersSession{}, &usersUser{})
+		},
+	})
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+type rolesInventoryRole struct {
+	UserID      uint `gorm:"primaryKey;autoIncrement:false"`
+	User        usersUser
+	InventoryID uint `gorm:"primaryKey;autoIncrement:false;index"`
+	Inventory   initialInventory
+	Role        string `gorm:"not null;size:16"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (rolesInventoryRole) TableName() string { return "inventory_roles" }
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018090512,
+		Name:    "inventory_roles",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&rolesInventoryRole{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&rolesInventoryRole{})
+		},
+	})
+}
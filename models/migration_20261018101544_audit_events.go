@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+type auditAuditEvent struct {
+	ID          uint      `gorm:"primarykey"`
+	CreatedAt   time.Time `gorm:"index"`
+	ActorID     *uint     `gorm:"index"`
+	Actor       string    `gorm:"not null"`
+	Action      string    `gorm:"not null;size:16"`
+	EntityType  string    `gorm:"not null;size:32;index:idx_audit_events_entity"`
+	EntityID    uint      `gorm:"not null;index:idx_audit_events_entity"`
+	InventoryID uint      `gorm:"index"`
+	Changes     string    `gorm:"type:text"`
+}
+
+func (auditAuditEvent) TableName() string { return "audit_events" }
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018101544,
+		Name:    "audit_events",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&auditAuditEvent{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&auditAuditEvent{})
+		},
+	})
+}
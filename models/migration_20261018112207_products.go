@@ -0,0 +1,52 @@
+package models
+
+import (
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+type productsProduct struct {
+	gorm.Model
+	Name        string `gorm:"not null;unique"`
+	Description string `gorm:"type:text"`
+	Options     string `gorm:"type:text;not null"`
+}
+
+func (productsProduct) TableName() string { return "products" }
+
+// productsItem holds the columns that the migration adds to items.
+type productsItem struct {
+	ProductID *uint   `gorm:"index"`
+	Options   *string `gorm:"type:text"`
+}
+
+func (productsItem) TableName() string { return "items" }
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018112207,
+		Name:    "products",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.CreateTable(&productsProduct{}); err != nil {
+				return err
+			}
+			for _, field := range []string{"ProductID", "Options"} {
+				if err := m.AddColumn(&productsItem{}, field); err != nil {
+					return err
+				}
+			}
+			return m.CreateIndex(&productsItem{}, "ProductID")
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropIndex(&productsItem{}, "ProductID"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &productsItem{}, "Options", "ProductID"); err != nil {
+				return err
+			}
+			return m.DropTable(&productsProduct{})
+		},
+	})
+}
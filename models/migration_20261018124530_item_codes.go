@@ -0,0 +1,42 @@
+package models
+
+import (
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+// itemCodesItem holds the columns that the migration adds to items.
+type itemCodesItem struct {
+	SKU     *string `gorm:"size:64;uniqueIndex"`
+	Barcode *string `gorm:"size:13;uniqueIndex"`
+}
+
+func (itemCodesItem) TableName() string { return "items" }
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018124530,
+		Name:    "item_codes",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, field := range []string{"SKU", "Barcode"} {
+				if err := m.AddColumn(&itemCodesItem{}, field); err != nil {
+					return err
+				}
+				if err := m.CreateIndex(&itemCodesItem{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, field := range []string{"Barcode", "SKU"} {
+				if err := m.DropIndex(&itemCodesItem{}, field); err != nil {
+					return err
+				}
+			}
+			return dropColumns(tx, &itemCodesItem{}, "Barcode", "SKU")
+		},
+	})
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+type categoriesCategory struct {
+	gorm.Model
+	Name     string `gorm:"not null"`
+	ParentID *uint  `gorm:"index"`
+}
+
+func (categoriesCategory) TableName() string { return "categories" }
+
+type categoriesTag struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"size:64;not null;unique"`
+}
+
+func (categoriesTag) TableName() string { return "tags" }
+
+type categoriesItemTag struct {
+	ItemID uint `gorm:"primaryKey"`
+	TagID  uint `gorm:"primaryKey;index"`
+}
+
+func (categoriesItemTag) TableName() string { return "item_tags" }
+
+// categoriesItem holds the column that the migration adds to items.
+type categoriesItem struct {
+	CategoryID *uint `gorm:"index"`
+}
+
+func (categoriesItem) TableName() string { return "items" }
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018133012,
+		Name:    "categories_and_tags",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.CreateTable(&categoriesCategory{}, &categoriesTag{}, &categoriesItemTag{}); err != nil {
+				return err
+			}
+			if err := m.AddColumn(&categoriesItem{}, "CategoryID"); err != nil {
+				return err
+			}
+			return m.CreateIndex(&categoriesItem{}, "CategoryID")
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropIndex(&categoriesItem{}, "CategoryID"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &categoriesItem{}, "CategoryID"); err != nil {
+				return err
+			}
+			return m.DropTable(&categoriesItemTag{}, &categoriesTag{}, &categoriesCategory{})
+		},
+	})
+}
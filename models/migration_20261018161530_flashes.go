@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+type flashesFlash struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	SessionID string `gorm:"not null;index;size:64"`
+	Kind      string `gorm:"not null;size:16"`
+	Message   string `gorm:"not null"`
+}
+
+func (flashesFlash) TableName() string { return "flashes" }
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018161530,
+		Name:    "flashes",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&flashesFlash{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&flashesFlash{})
+		},
+	})
+}
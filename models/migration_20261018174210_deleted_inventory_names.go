@@ -0,0 +1,39 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018174210,
+		Name:    "deleted_inventory_names",
+		// Up renames the inventories deleted so far, so that their names can
+		// be used again. Down keeps the new names, which are still unique.
+		Up: func(tx *gorm.DB) error {
+			var rows []struct {
+				ID   uint
+				Name string
+			}
+			err := tx.Table("inventories").Select("id, name").Where("deleted_at IS NOT NULL").
+				Scan(&rows).Error
+			if err != nil {
+				return err
+			}
+			for _, row := range rows {
+				err := tx.Table("inventories").Where("id = ?", row.ID).
+					UpdateColumn("name", fmt.Sprintf("%s (deleted #%d)", row.Name, row.ID)).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	})
+}
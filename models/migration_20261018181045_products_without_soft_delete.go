@@ -0,0 +1,31 @@
+package models
+
+import (
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+// productsSoftDeleteProduct holds the column that the migration drops from
+// products. Products have never been deleted, so no rows are lost.
+type productsSoftDeleteProduct struct {
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (productsSoftDeleteProduct) TableName() string { return "products" }
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018181045,
+		Name:    "products_without_soft_delete",
+		Up: func(tx *gorm.DB) error {
+			return dropColumns(tx, &productsSoftDeleteProduct{}, "DeletedAt")
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.AddColumn(&productsSoftDeleteProduct{}, "DeletedAt"); err != nil {
+				return err
+			}
+			return m.CreateIndex(&productsSoftDeleteProduct{}, "DeletedAt")
+		},
+	})
+}
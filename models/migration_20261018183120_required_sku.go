@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+// requiredSKUItem is the SKU column of items after the migration.
+type requiredSKUItem struct {
+	SKU string `gorm:"size:64;not null"`
+}
+
+func (requiredSKUItem) TableName() string { return "items" }
+
+// optionalSKUItem is the SKU column of items before the migration.
+type optionalSKUItem struct {
+	SKU *string `gorm:"size:64"`
+}
+
+func (optionalSKUItem) TableName() string { return "items" }
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018183120,
+		Name:    "required_sku",
+		// Up gives the items without a SKU one made of their ID, such as
+		// ITEM-12, and makes the column NOT NULL.
+		Up: func(tx *gorm.DB) error {
+			var ids []uint
+			if err := tx.Table("items").Where("sku IS NULL").Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			for _, id := range ids {
+				sku := fmt.Sprintf("ITEM-%d", id)
+				for n := 2; ; n++ {
+					var count int64
+					if err := tx.Table("items").Where("sku = ?", sku).Count(&count).Error; err != nil {
+						return err
+					}
+					if count == 0 {
+						break
+					}
+					sku = fmt.Sprintf("ITEM-%d-%d", id, n)
+				}
+				if err := tx.Table("items").Where("id = ?", id).UpdateColumn("sku", sku).Error; err != nil {
+					return err
+				}
+			}
+			return alterColumn(tx, &requiredSKUItem{}, "SKU")
+		},
+		Down: func(tx *gorm.DB) error {
+			return alterColumn(tx, &optionalSKUItem{}, "SKU")
+		},
+	})
+}
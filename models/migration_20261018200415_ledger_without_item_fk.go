@@ -0,0 +1,48 @@
+package models
+
+import (
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+)
+
+// ledgerItemFK is the foreign key of stock movements to their item, which
+// the migration drops so that purging an item keeps its movements.
+const ledgerItemFK = "fk_stock_movements_item"
+
+type ledgerItem struct {
+	ID uint `gorm:"primarykey"`
+}
+
+func (ledgerItem) TableName() string { return "items" }
+
+type ledgerMovement struct {
+	ID     uint `gorm:"primarykey"`
+	ItemID uint `gorm:"not null;index"`
+	Item   ledgerItem
+}
+
+func (ledgerMovement) TableName() string { return "stock_movements" }
+
+func init() {
+	registerMigration(migrate.Migration{
+		Version: 20261018200415,
+		Name:    "ledger_without_item_fk",
+		Up: func(tx *gorm.DB) error {
+			return keepIndexes(tx, &ledgerMovement{}, nil, func() error {
+				return tx.Migrator().DropConstraint(&ledgerMovement{}, ledgerItemFK)
+			})
+		},
+		// Down deletes the movements of purged items, which the foreign key
+		// does not allow.
+		Down: func(tx *gorm.DB) error {
+			err := tx.Where("item_id NOT IN (?)", tx.Table("items").Select("id")).
+				Delete(&ledgerMovement{}).Error
+			if err != nil {
+				return err
+			}
+			return keepIndexes(tx, &ledgerMovement{}, nil, func() error {
+				return tx.Migrator().CreateConstraint(&ledgerMovement{}, "Item")
+			})
+		},
+	})
+}
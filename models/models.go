@@ -1,17 +1,131 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/shayanh/shopify-challenge-2022/migrate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
 
 // Package models contains definition of entities, their logic and data store
 // interaction. We have implemented repository objects to communicate with the
 // data store using an ORM.
 
-var instances = []interface{}{
-	&Inventory{},
-	&Item{},
+// migrations are the schema migrations of the models. Every migration lives in
+// a migration_<version>_<name>.go file and adds itself in init.
+var migrations []migrate.Migration
+
+func registerMigration(m migrate.Migration) {
+	migrations = append(migrations, m)
+}
+
+// NewMigrator returns a Migrator of the schema migrations of the models.
+func NewMigrator(db *gorm.DB) *migrate.Migrator {
+	return migrate.New(db, migrations)
 }
 
-// Migrate automatically migrates model schemas.
+// Migrate applies the pending schema migrations. It fails without changes if
+// the schema is newer than the migrations.
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(instances...)
+	_, err := NewMigrator(db).Up()
+	return err
+}
+
+// Ready checks that the database is reachable and that exactly the known
+// migrations have been applied.
+func Ready(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return err
+	}
+	return NewMigrator(db.WithContext(ctx)).Current()
+}
+
+// dropColumns drops the given fields of a model, see keepIndexes.
+func dropColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	return keepIndexes(tx, model, fields, func() error {
+		for _, field := range fields {
+			if err := tx.Migrator().DropColumn(model, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// alterColumn changes the column of the given field to its definition in the
+// model, including whether it is NOT NULL.
+func alterColumn(tx *gorm.DB, model interface{}, field string) error {
+	m := tx.Migrator()
+	switch tx.Dialector.Name() {
+	case "sqlite":
+		return keepIndexes(tx, model, nil, func() error {
+			return m.AlterColumn(model, field)
+		})
+	case "postgres":
+		// AlterColumn only changes the type of the column there.
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		f := stmt.Schema.LookUpField(field)
+		if f == nil {
+			return fmt.Errorf("unknown field %s", field)
+		}
+		if err := m.AlterColumn(model, field); err != nil {
+			return err
+		}
+		sql := "ALTER TABLE ? ALTER COLUMN ? DROP NOT NULL"
+		if f.NotNull {
+			sql = "ALTER TABLE ? ALTER COLUMN ? SET NOT NULL"
+		}
+		return tx.Exec(sql, clause.Table{Name: stmt.Table}, clause.Column{Name: f.DBName}).Error
+	default:
+		return m.AlterColumn(model, field)
+	}
+}
+
+// keepIndexes runs the given change of the table of a model. SQLite changes
+// columns by copying the table, which loses its indexes, so the indexes that
+// do not cover one of the dropped fields are recreated afterwards.
+func keepIndexes(tx *gorm.DB, model interface{}, dropped []string, change func() error) error {
+	var indexes []string
+	if tx.Dialector.Name() == "sqlite" {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		err := tx.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL",
+			stmt.Table).Scan(&indexes).Error
+		if err != nil {
+			return err
+		}
+		for _, field := range dropped {
+			if f := stmt.Schema.LookUpField(field); f != nil {
+				kept := indexes[:0]
+				for _, index := range indexes {
+					if !strings.Contains(index, "`"+f.DBName+"`") {
+						kept = append(kept, index)
+					}
+				}
+				indexes = kept
+			}
+		}
+	}
+
+	if err := change(); err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if err := tx.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
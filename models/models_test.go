@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// TestMigrate_DownUp reverts the migrations down to the products migration
+// and applies them again, which must leave every index of the items.
+func TestMigrate_DownUp(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		migrator := NewMigrator(db)
+		statuses, err := migrator.Status()
+		require.Nil(t, err)
+		steps := 0
+		for _, status := range statuses {
+			if status.Version >= 20261018112207 {
+				steps++
+			}
+		}
+		_, err = migrator.Down(steps)
+		require.Nil(t, err)
+		require.Nil(t, Migrate(db))
+
+		stmt := &gorm.Statement{DB: db}
+		require.Nil(t, stmt.Parse(&Item{}))
+		for name := range stmt.Schema.ParseIndexes() {
+			assert.True(t, db.Migrator().HasIndex(&Item{}, name), "index %s", name)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MovementReason tells why the stock of an item has changed.
+type MovementReason string
+
+const (
+	// ReasonReceive adds received units to the stock.
+	ReasonReceive MovementReason = "receive"
+	// ReasonShip removes shipped units from the stock.
+	ReasonShip MovementReason = "ship"
+	// ReasonAdjust corrects the stock by a signed delta.
+	ReasonAdjust MovementReason = "adjust"
+	// ReasonCount sets the stock to the result of a physical count.
+	ReasonCount MovementReason = "count"
+	// ReasonTransfer moves units between inventories. Transfer movements are
+	// only recorded by ItemRepository.Transfer, always in pairs.
+	ReasonTransfer MovementReason = "transfer"
+)
+
+// MovementReasons lists the reasons of movements that can be recorded by hand.
+var MovementReasons = []MovementReason{ReasonReceive, ReasonShip, ReasonAdjust, ReasonCount}
+
+var (
+	// ErrNegativeStock is returned when a movement would make the quantity of
+	// an item negative.
+	ErrNegativeStock = errors.New("stock cannot go negative")
+	// ErrInvalidMovement is returned for a movement with an unknown reason or
+	// an amount that does not fit its reason.
+	ErrInvalidMovement = errors.New("invalid stock movement")
+)
+
+// StockMovement is an entry of the stock ledger. Every change of an item's
+// quantity is recorded as a movement, so the quantity of an item at any point
+// in time is the sum of the deltas of its movements up to that time.
+// Movements are never deleted, and they stay in the ledger when their item is
+// purged, which is why ItemID is not a foreign key.
+type StockMovement struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	ItemID    uint      `gorm:"not null;index"`
+	Item      Item      `gorm:"constraint:-"`
+	Delta     int       `gorm:"not null"`
+	// QuantityAfter is the quantity of the item after applying the movement.
+	QuantityAfter int            `gorm:"not null"`
+	Reason        MovementReason `gorm:"not null"`
+	Note          string
+}
+
+// applyMovement records the given movement of the item and adds its delta to
+// the item's quantity. The quantity is changed in the database rather than
+// from the loaded one, so that concurrent movements of the same item cannot
+// overwrite each other. On success item holds the stored quantity and
+// version. It has to be called inside a transaction.
+func applyMovement(tx *gorm.DB, item *Item, m *StockMovement) error {
+	res := tx.Model(&Item{}).Where("id = ? AND quantity + ? >= 0", item.ID, m.Delta).
+		Updates(map[string]interface{}{
+			"quantity": gorm.Expr("quantity + ?", m.Delta),
+			"version":  gorm.Expr("version + 1"),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNegativeStock
+	}
+	var stored Item
+	if err := tx.Select("quantity", "version").First(&stored, item.ID).Error; err != nil {
+		return err
+	}
+	item.Quantity = stored.Quantity
+	item.Version = stored.Version
+
+	m.ItemID = item.ID
+	m.QuantityAfter = item.Quantity
+	return tx.Create(m).Error
+}
+
+// movementDelta computes the delta of a movement with the given reason and
+// amount based on the current quantity. Receive and ship amounts are positive
+// unit counts, adjust amounts are signed deltas and count amounts are the
+// counted quantity.
+func movementDelta(reason MovementReason, amount, current int) (int, error) {
+	switch reason {
+	case ReasonReceive:
+		if amount > 0 {
+			return amount, nil
+		}
+	case ReasonShip:
+		if amount > 0 {
+			return -amount, nil
+		}
+	case ReasonAdjust:
+		if amount != 0 {
+			return amount, nil
+		}
+	case ReasonCount:
+		if amount >= 0 {
+			return amount - current, nil
+		}
+	}
+	return 0, ErrInvalidMovement
+}
+
+// ValidMovementReason reports whether a movement with the given reason can be
+// recorded by hand.
+func ValidMovementReason(reason MovementReason) bool {
+	for _, r := range MovementReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+type StockMovementRepository struct {
+	DB *gorm.DB
+}
+
+// WithContext returns a repository that runs its queries with the given
+// context, which attributes its changes to the actor of the context and its
+// log entries to the request of the context.
+func (rep *StockMovementRepository) WithContext(ctx context.Context) *StockMovementRepository {
+	return &StockMovementRepository{DB: rep.DB.WithContext(ctx)}
+}
+
+// Record applies a movement with the given reason and amount to an item. See
+// movementDelta for the meaning of amount.
+func (rep *StockMovementRepository) Record(itemID uint, reason MovementReason, amount int,
+	note string) (StockMovement, error) {
+	m := StockMovement{Reason: reason, Note: note}
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		// The item is locked, so that the delta of a count is computed from
+		// the quantity it is applied to.
+		var item Item
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, itemID).Error; err != nil {
+			return err
+		}
+		delta, err := movementDelta(reason, amount, item.Quantity)
+		if err != nil {
+			return err
+		}
+		m.Delta = delta
+		return applyMovement(tx, &item, &m)
+	})
+	return m, err
+}
+
+// FindByItemID returns the movements of an item, oldest first.
+func (rep *StockMovementRepository) FindByItemID(itemID uint, opts ...QueryOption) ([]StockMovement, error) {
+	var movements []StockMovement
+	err := applyOptions(rep.DB, opts).Where("item_id = ?", itemID).Order("created_at, id").Find(&movements).Error
+	return movements, err
+}
+
+// FindAll returns the whole ledger, oldest first.
+func (rep *StockMovementRepository) FindAll(opts ...QueryOption) ([]StockMovement, error) {
+	var movements []StockMovement
+	err := applyOptions(rep.DB, opts).Order("created_at, id").Find(&movements).Error
+	return movements, err
+}
+
+// QuantityAt rebuilds the quantity of an item at the given time from the
+// ledger.
+func (rep *StockMovementRepository) QuantityAt(itemID uint, t time.Time) (int, error) {
+	var qty int
+	err := rep.DB.Model(&StockMovement{}).Select("COALESCE(SUM(delta), 0)").
+		Where("item_id = ? AND created_at <= ?", itemID, t).Scan(&qty).Error
+	return qty, err
+}
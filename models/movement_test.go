@@ -0,0 +1,136 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestStockMovementRepository(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		inv, err := invRepo.Create(Inventory{Name: "test"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		item, err := itemRepo.Create(Item{Name: "t1", SKU: "T1", InventoryID: inv.ID, Quantity: 8})
+		assert.Nil(t, err)
+		assert.Equal(t, 8, item.Quantity)
+
+		movementRepo := &StockMovementRepository{DB: db}
+		m, err := movementRepo.Record(item.ID, ReasonShip, 3, "order 1")
+		assert.Nil(t, err)
+		assert.Equal(t, -3, m.Delta)
+		assert.Equal(t, 5, m.QuantityAfter)
+
+		_, err = movementRepo.Record(item.ID, ReasonShip, 6, "order 2")
+		assert.ErrorIs(t, err, ErrNegativeStock)
+		_, err = movementRepo.Record(item.ID, ReasonReceive, -1, "")
+		assert.ErrorIs(t, err, ErrInvalidMovement)
+
+		m, err = movementRepo.Record(item.ID, ReasonCount, 4, "")
+		assert.Nil(t, err)
+		assert.Equal(t, -1, m.Delta)
+
+		// The movements changed the item, so the stale copy is rejected.
+		item.Quantity = 10
+		_, err = itemRepo.Update(item)
+		assert.ErrorIs(t, err, ErrVersionConflict)
+		item, err = itemRepo.FindByID(item.ID)
+		assert.Nil(t, err)
+		item.Quantity = 10
+		_, err = itemRepo.Update(item)
+		assert.Nil(t, err)
+
+		movements, err := movementRepo.FindByItemID(item.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, len(movements))
+		sum := 0
+		for _, m := range movements {
+			sum += m.Delta
+		}
+		assert.Equal(t, 10, sum)
+		assert.Equal(t, ReasonAdjust, movements[3].Reason)
+
+		qty, err := movementRepo.QuantityAt(item.ID, time.Now())
+		assert.Nil(t, err)
+		assert.Equal(t, 10, qty)
+		qty, err = movementRepo.QuantityAt(item.ID, movements[0].CreatedAt.Add(-time.Second))
+		assert.Nil(t, err)
+		assert.Equal(t, 0, qty)
+
+		foundItem, err := itemRepo.FindByID(item.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, 10, foundItem.Quantity)
+	})
+}
+
+func TestStockMovementRepository_Concurrent(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		school, err := invRepo.Create(Inventory{Name: "School"})
+		require.Nil(t, err)
+		office, err := invRepo.Create(Inventory{Name: "Office"})
+		require.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		item, err := itemRepo.Create(Item{Name: "Pencil", SKU: "PENCIL", InventoryID: school.ID, Quantity: 20})
+		require.Nil(t, err)
+		_, target, err := itemRepo.Transfer(item.ID, office.ID, 1, "")
+		require.Nil(t, err)
+
+		if db.Dialector.Name() == "sqlite" {
+			// Writers to the shared in-memory database fail with "database
+			// table is locked" instead of waiting for each other.
+			sqlDB, err := db.DB()
+			require.Nil(t, err)
+			sqlDB.SetMaxOpenConns(1)
+		}
+
+		// 10 ships of 2 and 10 transfers of 1 ask for more than the 19 units
+		// left, so some of them fail but none is lost.
+		movementRepo := &StockMovementRepository{DB: db}
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		shipped, transferred := 0, 0
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				_, err := movementRepo.Record(item.ID, ReasonShip, 2, "")
+				mu.Lock()
+				defer mu.Unlock()
+				if assert.True(t, err == nil || errors.Is(err, ErrNegativeStock), err) && err == nil {
+					shipped += 2
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				_, _, err := itemRepo.Transfer(item.ID, office.ID, 1, "")
+				mu.Lock()
+				defer mu.Unlock()
+				if assert.True(t, err == nil || errors.Is(err, ErrNegativeStock), err) && err == nil {
+					transferred++
+				}
+			}()
+		}
+		wg.Wait()
+
+		item, err = itemRepo.FindByID(item.ID)
+		require.Nil(t, err)
+		assert.Equal(t, 19-shipped-transferred, item.Quantity)
+		assert.GreaterOrEqual(t, item.Quantity, 0)
+		qty, err := movementRepo.QuantityAt(item.ID, time.Now())
+		assert.Nil(t, err)
+		assert.Equal(t, item.Quantity, qty)
+
+		target, err = itemRepo.FindByID(target.ID)
+		require.Nil(t, err)
+		assert.Equal(t, 1+transferred, target.Quantity)
+	})
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestOpen_UnknownScheme(t *testing.T) {
+	_, err := Open("oracle://localhost/inventory", &gorm.Config{})
+	assert.NotNil(t, err)
+}
+
+func TestOpen_SQLiteMemoryIsolated(t *testing.T) {
+	db1, err := setupDB("sqlite://:memory:")
+	assert.Nil(t, err)
+	defer tearDownDB(db1)
+	db2, err := setupDB("sqlite://:memory:")
+	assert.Nil(t, err)
+	defer tearDownDB(db2)
+
+	_, err = (&InventoryRepository{DB: db1}).Create(Inventory{Name: "School"})
+	assert.Nil(t, err)
+	inventories, err := (&InventoryRepository{DB: db2}).FindAll()
+	assert.Nil(t, err)
+	assert.Empty(t, inventories)
+}
+
+func TestOpen_SQLiteConcurrentWriters(t *testing.T) {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(dsn, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, Migrate(db))
+
+	var journalMode string
+	assert.Nil(t, db.Raw("PRAGMA journal_mode").Scan(&journalMode).Error)
+	assert.Equal(t, "wal", journalMode)
+
+	inv, err := (&InventoryRepository{DB: db}).Create(Inventory{Name: "School"})
+	assert.Nil(t, err)
+
+	const writers, itemsPerWriter = 8, 10
+	itemRepo := &ItemRepository{DB: db}
+	errs := make(chan error, writers*itemsPerWriter)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < itemsPerWriter; i++ {
+				item := Item{Name: fmt.Sprintf("item %d-%d", w, i), SKU: fmt.Sprintf("ITEM-%d-%d", w, i), InventoryID: inv.ID, Quantity: 1}
+				if _, err := itemRepo.Create(item); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	items, err := itemRepo.FindAll()
+	assert.Nil(t, err)
+	assert.Equal(t, writers*itemsPerWriter, len(items))
+}
@@ -0,0 +1,29 @@
+package models
+
+import "gorm.io/gorm"
+
+// QueryOption customizes the query of a repository finder, for example to
+// eager load associations.
+type QueryOption func(db *gorm.DB) *gorm.DB
+
+// WithInventory eager loads the inventory of items with a single extra query,
+// no matter how many items are found.
+func WithInventory() QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Inventory")
+	}
+}
+
+// WithItem eager loads the item of stock movements, including deleted items.
+func WithItem() QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Item", func(db *gorm.DB) *gorm.DB { return db.Unscoped() })
+	}
+}
+
+func applyOptions(db *gorm.DB, opts []QueryOption) *gorm.DB {
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	return db
+}
@@ -0,0 +1,271 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidOptions is returned when the options of a variant do not
+	// match the options of its product.
+	ErrInvalidOptions = errors.New("invalid variant options")
+	// ErrDuplicateVariant is returned when an inventory already holds a
+	// variant of the product with the same options.
+	ErrDuplicateVariant = errors.New("inventory already holds a variant with these options")
+	// ErrDuplicateProduct is returned when creating a product with the name of
+	// another one.
+	ErrDuplicateProduct = errors.New("product name already used")
+)
+
+// Product is the parent of the items that are variants of one product, such as
+// a T-shirt in several sizes and colors. Every variant is an item of its own
+// with its own quantity in its inventory, told apart from the other variants
+// by a value for every option of the product. Products are never deleted, so
+// their names stay unique.
+type Product struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Name        string `gorm:"not null;unique"`
+	Description string `gorm:"type:text"`
+	// Options are the names of the option axes, such as Size and Color, in
+	// display order.
+	Options OptionNames `gorm:"type:text;not null"`
+}
+
+// OptionNames are the option axes of a product. They are stored as a JSON
+// array.
+type OptionNames []string
+
+// ParseOptionNames parses a comma separated list of option names, such as
+// "Size, Color".
+func ParseOptionNames(s string) (OptionNames, error) {
+	var names OptionNames
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, names.validate()
+}
+
+func (names OptionNames) validate() error {
+	if len(names) == 0 {
+		return fmt.Errorf("%w: a product needs at least one option", ErrInvalidOptions)
+	}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, ",=") {
+			return fmt.Errorf("%w: invalid option name %q", ErrInvalidOptions, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: duplicate option %q", ErrInvalidOptions, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// Check returns ErrInvalidOptions unless the given values hold a value for
+// every option and nothing else.
+func (names OptionNames) Check(values OptionValues) error {
+	if len(values) != len(names) {
+		return fmt.Errorf("%w: expected values for %s", ErrInvalidOptions, strings.Join(names, ", "))
+	}
+	for _, name := range names {
+		if values[name] == "" {
+			return fmt.Errorf("%w: missing value for %s", ErrInvalidOptions, name)
+		}
+	}
+	return nil
+}
+
+func (names OptionNames) String() string {
+	return strings.Join(names, ", ")
+}
+
+func (names OptionNames) Value() (driver.Value, error) {
+	b, err := json.Marshal([]string(names))
+	return string(b), err
+}
+
+func (names *OptionNames) Scan(src interface{}) error {
+	return scanJSON(src, names)
+}
+
+// OptionValues maps the options of a variant to its values, such as Size to
+// M. They are stored as a JSON object, or NULL for items that are not
+// variants.
+type OptionValues map[string]string
+
+// ParseOptionValues parses a comma separated list of option values, such as
+// "Size=M, Color=Red".
+func ParseOptionValues(s string) (OptionValues, error) {
+	values := OptionValues{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("%w: expected name=value, got %q", ErrInvalidOptions, strings.TrimSpace(pair))
+		}
+		values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values, nil
+}
+
+// String formats the values in the format of ParseOptionValues, sorted by
+// option name.
+func (values OptionValues) String() string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + values[name]
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func (values OptionValues) Value() (driver.Value, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	// Maps are encoded with sorted keys, so equal values are stored as equal
+	// strings.
+	b, err := json.Marshal(map[string]string(values))
+	return string(b), err
+}
+
+func (values *OptionValues) Scan(src interface{}) error {
+	return scanJSON(src, values)
+}
+
+func scanJSON(src interface{}, dst interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), dst)
+	case []byte:
+		return json.Unmarshal(src, dst)
+	default:
+		return fmt.Errorf("cannot scan %T as JSON", src)
+	}
+}
+
+// checkVariant validates the product and the options of an item. A variant
+// needs a value for every option of its product, and no other variant of the
+// product in the same inventory may have the same values.
+func checkVariant(tx *gorm.DB, item *Item) error {
+	if item.ProductID == nil {
+		if len(item.Options) > 0 {
+			return fmt.Errorf("%w: options need a product", ErrInvalidOptions)
+		}
+		return nil
+	}
+	var product Product
+	err := tx.First(&product, *item.ProductID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: unknown product", ErrInvalidOptions)
+	} else if err != nil {
+		return err
+	}
+	if err := product.Options.Check(item.Options); err != nil {
+		return err
+	}
+	var count int64
+	err = tx.Model(&Item{}).
+		Where("product_id = ? AND inventory_id = ? AND options = ? AND id <> ?",
+			*item.ProductID, item.InventoryID, item.Options, item.ID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateVariant
+	}
+	return nil
+}
+
+// WithProduct eager loads the product of items with a single extra query.
+func WithProduct() QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Product")
+	}
+}
+
+type ProductRepository struct {
+	DB *gorm.DB
+}
+
+// WithContext returns a repository that runs its queries with ctx.
+func (rep *ProductRepository) WithContext(ctx context.Context) *ProductRepository {
+	return &ProductRepository{DB: rep.DB.WithContext(ctx)}
+}
+
+// Create creates a product after validating its options.
+func (rep *ProductRepository) Create(product Product) (Product, error) {
+	if product.Name == "" {
+		return product, errors.New("product name cannot be empty")
+	}
+	if err := product.Options.validate(); err != nil {
+		return product, err
+	}
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Product{}).Where("name = ?", product.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDuplicateProduct
+		}
+		return tx.Create(&product).Error
+	})
+	return product, err
+}
+
+func (rep *ProductRepository) FindByID(id uint, opts ...QueryOption) (Product, error) {
+	var product Product
+	err := applyOptions(rep.DB, opts).First(&product, id).Error
+	return product, err
+}
+
+func (rep *ProductRepository) FindAll(opts ...QueryOption) ([]Product, error) {
+	var products []Product
+	err := applyOptions(rep.DB, opts).Order("name").Find(&products).Error
+	return products, err
+}
+
+// CountVariants returns the number of variants of every product in a single
+// query. Products without variants are left out.
+func (rep *ProductRepository) CountVariants(opts ...QueryOption) (map[uint]int64, error) {
+	var rows []struct {
+		ProductID uint
+		Count     int64
+	}
+	err := applyOptions(rep.DB.Model(&Item{}), opts).Select("product_id, COUNT(*) AS count").
+		Where("product_id IS NOT NULL").Group("product_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ProductID] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestParseOptions(t *testing.T) {
+	names, err := ParseOptionNames(" Size, Color ,")
+	assert.Nil(t, err)
+	assert.Equal(t, OptionNames{"Size", "Color"}, names)
+	_, err = ParseOptionNames("Size, Size")
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+	_, err = ParseOptionNames("")
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+
+	values, err := ParseOptionValues("Size=M, Color = Red")
+	assert.Nil(t, err)
+	assert.Equal(t, OptionValues{"Size": "M", "Color": "Red"}, values)
+	assert.Equal(t, "Color=Red, Size=M", values.String())
+	empty, err := ParseOptionValues(" ")
+	assert.Nil(t, err)
+	assert.Nil(t, empty)
+	_, err = ParseOptionValues("Size")
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+
+	assert.Nil(t, names.Check(values))
+	assert.ErrorIs(t, names.Check(OptionValues{"Size": "M"}), ErrInvalidOptions)
+	assert.ErrorIs(t, names.Check(OptionValues{"Size": "M", "Fit": "Slim"}), ErrInvalidOptions)
+}
+
+func TestProductVariants(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		shop, err := invRepo.Create(Inventory{Name: "Shop"})
+		assert.Nil(t, err)
+		storage, err := invRepo.Create(Inventory{Name: "Storage"})
+		assert.Nil(t, err)
+
+		productRepo := &ProductRepository{DB: db}
+		_, err = productRepo.Create(Product{Name: "Mug"})
+		assert.ErrorIs(t, err, ErrInvalidOptions)
+		shirt, err := productRepo.Create(Product{Name: "T-shirt", Options: OptionNames{"Size", "Color"}})
+		assert.Nil(t, err)
+		_, err = productRepo.Create(Product{Name: "T-shirt", Options: OptionNames{"Size"}})
+		assert.ErrorIs(t, err, ErrDuplicateProduct)
+
+		itemRepo := &ItemRepository{DB: db}
+		small := Item{Name: "T-shirt S", SKU: "T-SHIRT-S", InventoryID: shop.ID, Quantity: 4, ProductID: &shirt.ID,
+			Options: OptionValues{"Size": "S", "Color": "Red"}}
+		small, err = itemRepo.Create(small)
+		assert.Nil(t, err)
+
+		duplicate := small
+		duplicate.ID = 0
+		duplicate.Name = "Small T-shirt"
+		_, err = itemRepo.Create(duplicate)
+		assert.ErrorIs(t, err, ErrDuplicateVariant)
+		_, err = itemRepo.Create(Item{Name: "T-shirt", SKU: "T-SHIRT", InventoryID: shop.ID, ProductID: &shirt.ID,
+			Options: OptionValues{"Size": "S"}})
+		assert.ErrorIs(t, err, ErrInvalidOptions)
+		_, err = itemRepo.Create(Item{Name: "Mug", SKU: "MUG", InventoryID: shop.ID, Options: OptionValues{"Size": "S"}})
+		assert.ErrorIs(t, err, ErrInvalidOptions)
+
+		// Another inventory holds its own quantity of the same variant.
+		_, target, err := itemRepo.Transfer(small.ID, storage.ID, 1, "")
+		assert.Nil(t, err)
+		assert.Equal(t, storage.ID, target.InventoryID)
+		assert.Equal(t, &shirt.ID, target.ProductID)
+		assert.Equal(t, small.Options, target.Options)
+
+		medium, err := itemRepo.Create(Item{Name: "T-shirt M", SKU: "T-SHIRT-M", InventoryID: shop.ID, ProductID: &shirt.ID,
+			Options: OptionValues{"Size": "M", "Color": "Red"}})
+		assert.Nil(t, err)
+		medium.Options = OptionValues{"Size": "S", "Color": "Red"}
+		_, err = itemRepo.Update(medium)
+		assert.ErrorIs(t, err, ErrDuplicateVariant)
+
+		counts, err := productRepo.CountVariants()
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), counts[shirt.ID])
+
+		found, err := itemRepo.FindByID(small.ID, WithProduct())
+		assert.Nil(t, err)
+		if assert.NotNil(t, found.Product) {
+			assert.Equal(t, shirt.Options, found.Product.Options)
+		}
+	})
+}
@@ -0,0 +1,210 @@
+package models
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPageSize is the page size of an ItemQuery without one.
+	DefaultPageSize = 50
+	// MaxPageSize is the largest accepted page size of an ItemQuery.
+	MaxPageSize = 500
+)
+
+// ItemSortColumns maps the sort keys of an ItemQuery to their columns.
+var ItemSortColumns = map[string]string{
+	"id":         "items.id",
+	"name":       "items.name",
+	"inventory":  "inventories.name",
+	"qty":        "items.quantity",
+	"created_at": "items.created_at",
+	"updated_at": "items.updated_at",
+}
+
+// ItemQuery describes a search over items. Zero values mean no filtering.
+type ItemQuery struct {
+	// Search is matched case-insensitively against name, description, SKU
+	// and barcode.
+	Search      string
+	InventoryID uint
+	MinQuantity *int
+	MaxQuantity *int
+	// CategoryID matches the items of the category and its descendants.
+	CategoryID uint
+	// Tag matches the items with the tag.
+	Tag string
+
+	// SortBy is a key of ItemSortColumns, by default items are sorted by id.
+	SortBy   string
+	SortDesc bool
+
+	// Page starts from 1. A zero page returns every matching item, which is
+	// what exports need.
+	Page     int
+	PageSize int
+
+	// categoryIDs is the subtree of CategoryID, see resolve.
+	categoryIDs []uint
+}
+
+// resolve looks up the categories below the category of the query, so that
+// filter can match them without a recursive query.
+func (q ItemQuery) resolve(db *gorm.DB) (ItemQuery, error) {
+	if q.CategoryID == 0 {
+		return q, nil
+	}
+	tree, err := (&CategoryRepository{DB: db}).Tree()
+	if err != nil {
+		return q, err
+	}
+	q.categoryIDs = tree.Subtree(q.CategoryID)
+	return q, nil
+}
+
+// Offset returns the number of items to skip for the page of the query.
+func (q ItemQuery) Offset() int {
+	if q.Page <= 1 {
+		return 0
+	}
+	return (q.Page - 1) * q.Limit()
+}
+
+// Limit returns the effective page size of the query.
+func (q ItemQuery) Limit() int {
+	switch {
+	case q.PageSize <= 0:
+		return DefaultPageSize
+	case q.PageSize > MaxPageSize:
+		return MaxPageSize
+	default:
+		return q.PageSize
+	}
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns. It uses ! as the escape
+// character since backslashes are special in MySQL string literals.
+var likeEscaper = strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`)
+
+// filter applies the filters of the query without sorting and pagination.
+func (q ItemQuery) filter(db *gorm.DB) *gorm.DB {
+	if q.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(q.Search)) + "%"
+		db = db.Where("(LOWER(items.name) LIKE ? ESCAPE '!' OR LOWER(items.description) LIKE ? ESCAPE '!' "+
+			"OR LOWER(items.sku) LIKE ? ESCAPE '!' OR items.barcode LIKE ? ESCAPE '!')",
+			pattern, pattern, pattern, pattern)
+	}
+	if q.InventoryID != 0 {
+		db = db.Where("items.inventory_id = ?", q.InventoryID)
+	}
+	if q.MinQuantity != nil {
+		db = db.Where("items.quantity >= ?", *q.MinQuantity)
+	}
+	if q.MaxQuantity != nil {
+		db = db.Where("items.quantity <= ?", *q.MaxQuantity)
+	}
+	if q.CategoryID != 0 {
+		db = db.Where("items.category_id IN ?", q.categoryIDs)
+	}
+	if q.Tag != "" {
+		db = db.Where("items.id IN (SELECT item_tags.item_id FROM item_tags "+
+			"JOIN tags ON tags.id = item_tags.tag_id WHERE tags.name = ?)", strings.ToLower(q.Tag))
+	}
+	return db
+}
+
+func (q ItemQuery) order(db *gorm.DB) *gorm.DB {
+	column, ok := ItemSortColumns[q.SortBy]
+	if !ok {
+		column = ItemSortColumns["id"]
+	}
+	if column == ItemSortColumns["inventory"] {
+		db = db.Joins("LEFT JOIN inventories ON inventories.id = items.inventory_id")
+	}
+	dir := " ASC"
+	if q.SortDesc {
+		dir = " DESC"
+	}
+	db = db.Order(column + dir)
+	if column != ItemSortColumns["id"] {
+		db = db.Order("items.id" + dir)
+	}
+	return db
+}
+
+// Find returns the items matching the query and the total number of matching
+// items regardless of pagination. The options apply to the total as well, so
+// that it agrees with the items an Access option lets through.
+func (rep *ItemRepository) Find(q ItemQuery, opts ...QueryOption) ([]Item, int64, error) {
+	q, err := q.resolve(rep.DB)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	err = q.filter(applyOptions(rep.DB, opts).Model(&Item{})).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	db := q.order(q.filter(applyOptions(rep.DB, opts).Model(&Item{})))
+	if q.Page > 0 {
+		db = db.Offset(q.Offset()).Limit(q.Limit())
+	}
+	var items []Item
+	err = db.Find(&items).Error
+	return items, total, err
+}
+
+// TagFacet is the number of matching items with a tag.
+type TagFacet struct {
+	Name  string
+	Count int64
+}
+
+// ItemFacets are the number of items matching a query per category and per
+// tag.
+type ItemFacets struct {
+	// Categories are the categories with matching items in tree order. Their
+	// TotalItems count the matching items of the category and its
+	// descendants.
+	Categories []CategoryNode
+	// Tags are sorted by count, the most used first.
+	Tags []TagFacet
+}
+
+// Facets counts the items matching the query, regardless of pagination, per
+// category and per tag.
+func (rep *ItemRepository) Facets(q ItemQuery, opts ...QueryOption) (ItemFacets, error) {
+	var facets ItemFacets
+	q, err := q.resolve(rep.DB)
+	if err != nil {
+		return facets, err
+	}
+	tree, err := (&CategoryRepository{DB: rep.DB}).Tree()
+	if err != nil {
+		return facets, err
+	}
+
+	var counts []categoryCount
+	err = q.filter(applyOptions(rep.DB, opts).Model(&Item{})).
+		Select("items.category_id, COUNT(*) AS items").
+		Group("items.category_id").Scan(&counts).Error
+	if err != nil {
+		return facets, err
+	}
+	tree.rollUp(counts)
+	for _, node := range tree.Nodes {
+		if node.TotalItems > 0 {
+			facets.Categories = append(facets.Categories, node)
+		}
+	}
+
+	matching := q.filter(applyOptions(rep.DB, opts).Model(&Item{})).Select("items.id")
+	err = rep.DB.Table("item_tags").
+		Select("tags.name AS name, COUNT(*) AS count").
+		Joins("JOIN tags ON tags.id = item_tags.tag_id").
+		Where("item_tags.item_id IN (?)", matching).
+		Group("tags.name").Order("count DESC, tags.name").Scan(&facets.Tags).Error
+	return facets, err
+}
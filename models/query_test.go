@@ -0,0 +1,64 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestItemRepository_Find(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		school, err := invRepo.Create(Inventory{Name: "School"})
+		assert.Nil(t, err)
+		phones, err := invRepo.Create(Inventory{Name: "Phones"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		for _, item := range []Item{
+			{Name: "Pencil", SKU: "PENCIL", InventoryID: school.ID, Quantity: 8, Description: "Black pencil"},
+			{Name: "Backpack", SKU: "BACKPACK", InventoryID: school.ID, Quantity: 11, Description: "100% cotton"},
+			{Name: "iPhone 13", SKU: "IPHONE-13", InventoryID: phones.ID, Quantity: 9, Description: "Smartphone"},
+			{Name: "Pixel", SKU: "PIXEL", InventoryID: phones.ID, Quantity: 0, Description: "Black smartphone"},
+		} {
+			_, err := itemRepo.Create(item)
+			assert.Nil(t, err)
+		}
+
+		names := func(items []Item) []string {
+			var res []string
+			for _, item := range items {
+				res = append(res, item.Name)
+			}
+			return res
+		}
+
+		items, total, err := itemRepo.Find(ItemQuery{Search: "BLACK"})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), total)
+		assert.Equal(t, []string{"Pencil", "Pixel"}, names(items))
+
+		items, _, err = itemRepo.Find(ItemQuery{Search: "%"})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Backpack"}, names(items))
+
+		min, max := 1, 10
+		items, _, err = itemRepo.Find(ItemQuery{MinQuantity: &min, MaxQuantity: &max})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Pencil", "iPhone 13"}, names(items))
+
+		items, _, err = itemRepo.Find(ItemQuery{InventoryID: phones.ID, SortBy: "qty"})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Pixel", "iPhone 13"}, names(items))
+
+		items, _, err = itemRepo.Find(ItemQuery{SortBy: "inventory", SortDesc: true})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Backpack", "Pencil", "Pixel", "iPhone 13"}, names(items))
+
+		items, total, err = itemRepo.Find(ItemQuery{SortBy: "name", Page: 2, PageSize: 3})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(4), total)
+		assert.Equal(t, []string{"iPhone 13"}, names(items))
+	})
+}
@@ -0,0 +1,210 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Role is the role of a user in an inventory. Every role includes the
+// permissions of the roles before it:
+//
+//	viewer   sees the items and their history
+//	clerk    records stock movements and transfers
+//	manager  creates, edits and deletes items and edits the inventory
+//	admin    deletes the inventory and grants roles in it
+type Role string
+
+const (
+	RoleViewer  Role = "viewer"
+	RoleClerk   Role = "clerk"
+	RoleManager Role = "manager"
+	RoleAdmin   Role = "admin"
+)
+
+// Roles are the valid roles from the least to the most privileged.
+var Roles = []Role{RoleViewer, RoleClerk, RoleManager, RoleAdmin}
+
+var (
+	// ErrInvalidRole is returned when granting an unknown role.
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrPermissionDenied is returned when a role does not allow a change.
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if role == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Includes reports whether the role has the permissions of the other role.
+func (r Role) Includes(other Role) bool {
+	return r.rank() >= 0 && r.rank() >= other.rank() && other.rank() >= 0
+}
+
+// InventoryRole grants a role in an inventory to a user.
+type InventoryRole struct {
+	UserID      uint `gorm:"primaryKey;autoIncrement:false"`
+	User        User
+	InventoryID uint `gorm:"primaryKey;autoIncrement:false;index"`
+	Inventory   Inventory
+	Role        Role `gorm:"not null;size:16"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Access is what a user may do in which inventories. Admin users hold the
+// admin role in every inventory.
+type Access struct {
+	Admin bool
+	Roles map[uint]Role
+}
+
+// FullAccess grants every role in every inventory. It is meant for trusted
+// callers such as the command line.
+var FullAccess = Access{Admin: true}
+
+// Role returns the role in the given inventory, or an empty role if there is
+// none.
+func (a Access) Role(inventoryID uint) Role {
+	if a.Admin {
+		return RoleAdmin
+	}
+	return a.Roles[inventoryID]
+}
+
+// Can reports whether the access includes the given role in the inventory.
+func (a Access) Can(inventoryID uint, role Role) bool {
+	return a.Role(inventoryID).Includes(role)
+}
+
+// CanAny reports whether the access includes the given role in some
+// inventory.
+func (a Access) CanAny(role Role) bool {
+	return a.Admin || len(a.inventoryIDs(role)) > 0
+}
+
+// inventoryIDs returns the inventories in which the access includes the given
+// role. The result is never nil, so that it restricts queries even if empty.
+func (a Access) inventoryIDs(role Role) []uint {
+	ids := []uint{}
+	for id, r := range a.Roles {
+		if r.Includes(role) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Items restricts a query of items to the inventories in which the access
+// includes the given role.
+func (a Access) Items(role Role) QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		if a.Admin {
+			return db
+		}
+		return db.Where("items.inventory_id IN ?", a.inventoryIDs(role))
+	}
+}
+
+// Inventories restricts a query of inventories to the ones in which the
+// access includes the given role.
+func (a Access) Inventories(role Role) QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		if a.Admin {
+			return db
+		}
+		return db.Where("inventories.id IN ?", a.inventoryIDs(role))
+	}
+}
+
+// Movements restricts a query of stock movements to the items of the
+// inventories in which the access includes the given role, deleted items
+// included.
+func (a Access) Movements(role Role) QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		if a.Admin {
+			return db
+		}
+		return db.Where("stock_movements.item_id IN (SELECT id FROM items WHERE inventory_id IN ?)",
+			a.inventoryIDs(role))
+	}
+}
+
+// AuditEvents restricts a query of audit events to the inventories in which
+// the access includes the given role.
+func (a Access) AuditEvents(role Role) QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		if a.Admin {
+			return db
+		}
+		return db.Where("audit_events.inventory_id IN ?", a.inventoryIDs(role))
+	}
+}
+
+type RoleRepository struct {
+	DB *gorm.DB
+}
+
+// WithContext returns a repository that runs its queries with ctx.
+func (rep *RoleRepository) WithContext(ctx context.Context) *RoleRepository {
+	return &RoleRepository{DB: rep.DB.WithContext(ctx)}
+}
+
+// Grant gives the user the role in the inventory, replacing the role the user
+// had there.
+func (rep *RoleRepository) Grant(inventoryID, userID uint, role Role) (InventoryRole, error) {
+	ir := InventoryRole{UserID: userID, InventoryID: inventoryID, Role: role}
+	if role.rank() < 0 {
+		return ir, ErrInvalidRole
+	}
+	err := rep.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "inventory_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+	}).Create(&ir).Error
+	return ir, err
+}
+
+// Revoke takes the role in the inventory away from the user.
+func (rep *RoleRepository) Revoke(inventoryID, userID uint) error {
+	res := rep.DB.Where("inventory_id = ? AND user_id = ?", inventoryID, userID).Delete(&InventoryRole{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// FindByInventoryID returns the roles granted in the inventory with their
+// users loaded.
+func (rep *RoleRepository) FindByInventoryID(inventoryID uint) ([]InventoryRole, error) {
+	var roles []InventoryRole
+	err := rep.DB.Preload("User").Where("inventory_id = ?", inventoryID).
+		Order("user_id").Find(&roles).Error
+	return roles, err
+}
+
+// AccessOf returns the access of the given user.
+func (rep *RoleRepository) AccessOf(user User) (Access, error) {
+	access := Access{Admin: user.Admin, Roles: make(map[uint]Role)}
+	if user.Admin {
+		return access, nil
+	}
+	var roles []InventoryRole
+	if err := rep.DB.Where("user_id = ?", user.ID).Find(&roles).Error; err != nil {
+		return access, err
+	}
+	for _, ir := range roles {
+		access.Roles[ir.InventoryID] = ir.Role
+	}
+	return access, nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestRole_Includes(t *testing.T) {
+	assert.True(t, RoleAdmin.Includes(RoleViewer))
+	assert.True(t, RoleClerk.Includes(RoleClerk))
+	assert.False(t, RoleClerk.Includes(RoleManager))
+	assert.False(t, Role("").Includes(RoleViewer))
+	assert.False(t, RoleAdmin.Includes(Role("owner")))
+}
+
+func TestRoleRepository(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		school, err := invRepo.Create(Inventory{Name: "School"})
+		assert.Nil(t, err)
+		phones, err := invRepo.Create(Inventory{Name: "Phones"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		pencil, err := itemRepo.Create(Item{Name: "Pencil", SKU: "PENCIL", InventoryID: school.ID, Quantity: 8})
+		assert.Nil(t, err)
+		_, err = itemRepo.Create(Item{Name: "iPhone 13", SKU: "IPHONE-13", InventoryID: phones.ID, Quantity: 9})
+		assert.Nil(t, err)
+
+		user, err := (&UserRepository{DB: db}).Create("alice", "correct horse", false)
+		assert.Nil(t, err)
+
+		roleRepo := &RoleRepository{DB: db}
+		_, err = roleRepo.Grant(school.ID, user.ID, Role("owner"))
+		assert.ErrorIs(t, err, ErrInvalidRole)
+		_, err = roleRepo.Grant(school.ID, user.ID, RoleViewer)
+		assert.Nil(t, err)
+		_, err = roleRepo.Grant(school.ID, user.ID, RoleClerk)
+		assert.Nil(t, err, "granting again replaces the role")
+
+		roles, err := roleRepo.FindByInventoryID(school.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(roles))
+		assert.Equal(t, RoleClerk, roles[0].Role)
+		assert.Equal(t, "alice", roles[0].User.Username)
+
+		access, err := roleRepo.AccessOf(user)
+		assert.Nil(t, err)
+		assert.True(t, access.Can(school.ID, RoleClerk))
+		assert.False(t, access.Can(school.ID, RoleManager))
+		assert.False(t, access.Can(phones.ID, RoleViewer))
+
+		items, total, err := itemRepo.Find(ItemQuery{}, access.Items(RoleViewer))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, 1, len(items))
+		assert.Equal(t, pencil.ID, items[0].ID)
+		items, total, err = itemRepo.Find(ItemQuery{}, access.Items(RoleManager))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), total)
+		assert.Equal(t, 0, len(items))
+
+		invs, err := invRepo.FindAll(access.Inventories(RoleViewer))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(invs))
+
+		movements, err := (&StockMovementRepository{DB: db}).FindAll(access.Movements(RoleViewer))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(movements))
+		assert.Equal(t, pencil.ID, movements[0].ItemID)
+
+		csv := "id,name,inventory,qty\n,Eraser,School,3\n"
+		report, err := itemRepo.ImportCSV(strings.NewReader(csv), true, access)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, report.Rejected, "clerks cannot create items")
+
+		err = roleRepo.Revoke(school.ID, user.ID)
+		assert.Nil(t, err)
+		err = roleRepo.Revoke(school.ID, user.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		access, err = roleRepo.AccessOf(user)
+		assert.Nil(t, err)
+		items, _, err = itemRepo.Find(ItemQuery{}, access.Items(RoleViewer))
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(items), "users without roles see nothing")
+	})
+}
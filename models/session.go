@@ -0,0 +1,100 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// newSecret returns a random token and its hash. Only the hash is stored, so
+// that the tokens of the database cannot be used to sign in.
+func newSecret(prefix string) (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = prefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashSecret(token), nil
+}
+
+func hashSecret(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Session is a signed in browser session. The ID is the hash of the token
+// that is kept in the session cookie.
+type Session struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UserID    uint      `gorm:"not null;index"`
+	User      User
+}
+
+type SessionRepository struct {
+	DB *gorm.DB
+}
+
+// WithContext returns a repository that runs its queries with ctx.
+func (rep *SessionRepository) WithContext(ctx context.Context) *SessionRepository {
+	return &SessionRepository{DB: rep.DB.WithContext(ctx)}
+}
+
+// Create starts a session of the given user that expires after ttl and
+// returns its token.
+func (rep *SessionRepository) Create(userID uint, ttl time.Duration) (string, Session, error) {
+	token, hash, err := newSecret("")
+	if err != nil {
+		return "", Session{}, err
+	}
+	session := Session{ID: hash, UserID: userID, ExpiresAt: time.Now().Add(ttl)}
+	err = rep.DB.Create(&session).Error
+	return token, session, err
+}
+
+// Find returns the unexpired session of the given token together with its
+// user. Sessions of deleted users are not found.
+func (rep *SessionRepository) Find(token string) (Session, error) {
+	var session Session
+	err := rep.DB.Preload("User").Where("expires_at > ?", time.Now()).
+		First(&session, "id = ?", hashSecret(token)).Error
+	if err == nil && session.User.ID == 0 {
+		err = gorm.ErrRecordNotFound
+	}
+	return session, err
+}
+
+// Delete ends the session of the given token, together with its flash
+// messages.
+func (rep *SessionRepository) Delete(token string) error {
+	id := hashSecret(token)
+	return rep.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&Flash{}, "session_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Session{}, "id = ?", id).Error
+	})
+}
+
+// DeleteExpired deletes the expired sessions, together with their flash
+// messages, and returns their number.
+func (rep *SessionRepository) DeleteExpired() (int64, error) {
+	var deleted int64
+	err := rep.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		expired := tx.Model(&Session{}).Select("id").Where("expires_at <= ?", now)
+		if err := tx.Where("session_id IN (?)", expired).Delete(&Flash{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("expires_at <= ?", now).Delete(&Session{})
+		deleted = res.RowsAffected
+		return res.Error
+	})
+	return deleted, err
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tag is a free-form label of items. Tag names are lower case.
+type Tag struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"size:64;not null;unique"`
+}
+
+// ItemTag is a row of the join table of items and tags.
+type ItemTag struct {
+	ItemID uint `gorm:"primaryKey"`
+	TagID  uint `gorm:"primaryKey;index"`
+}
+
+// ParseTags parses a comma separated list of tags. Tags are lower cased,
+// sorted and deduplicated, and an empty list gives an empty, non-nil slice.
+func ParseTags(s string) ([]Tag, error) {
+	return NewTags(strings.Split(s, ","))
+}
+
+// NewTags returns the tags of the given names in the form of ParseTags.
+func NewTags(names []string) ([]Tag, error) {
+	tags := []Tag{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if len(name) > 64 {
+			return nil, errors.New("tags cannot be longer than 64 characters")
+		}
+		seen[name] = true
+		tags = append(tags, Tag{Name: name})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// TagNames returns the names of the given tags.
+func TagNames(tags []Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+// setItemTags replaces the tags of an item with the given tags, which are
+// matched by name and created as needed.
+func setItemTags(tx *gorm.DB, itemID uint, tags []Tag) error {
+	if err := tx.Where("item_id = ?", itemID).Delete(&ItemTag{}).Error; err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	names := TagNames(tags)
+	newTags := make([]Tag, len(names))
+	for i, name := range names {
+		newTags[i] = Tag{Name: name}
+	}
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&newTags).Error
+	if err != nil {
+		return err
+	}
+	// Tags that already existed are not returned by the insert.
+	var stored []Tag
+	if err := tx.Where("name IN ?", names).Find(&stored).Error; err != nil {
+		return err
+	}
+	rows := make([]ItemTag, len(stored))
+	for i, tag := range stored {
+		rows[i] = ItemTag{ItemID: itemID, TagID: tag.ID}
+	}
+	return tx.Create(&rows).Error
+}
+
+// WithTags eager loads the tags of items with a single extra query.
+func WithTags() QueryOption {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Tags", func(db *gorm.DB) *gorm.DB {
+			return db.Order("tags.name")
+		})
+	}
+}
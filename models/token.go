@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccessTokenPrefix starts every personal access token, which makes leaked
+// tokens easy to recognize.
+const AccessTokenPrefix = "pat_"
+
+// AccessToken is a personal access token, which authenticates API clients as
+// its user. Only the hash of the token is stored.
+type AccessToken struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint `gorm:"not null;index"`
+	User       User
+	Name       string `gorm:"not null"`
+	TokenHash  string `gorm:"not null;uniqueIndex;size:64"`
+	LastUsedAt *time.Time
+}
+
+type AccessTokenRepository struct {
+	DB *gorm.DB
+}
+
+// WithContext returns a repository that runs its queries with ctx.
+func (rep *AccessTokenRepository) WithContext(ctx context.Context) *AccessTokenRepository {
+	return &AccessTokenRepository{DB: rep.DB.WithContext(ctx)}
+}
+
+// Create creates a token of the given user and returns it. The token cannot
+// be retrieved later.
+func (rep *AccessTokenRepository) Create(userID uint, name string) (string, AccessToken, error) {
+	accessToken := AccessToken{UserID: userID, Name: strings.TrimSpace(name)}
+	if accessToken.Name == "" {
+		return "", accessToken, errors.New("token name cannot be empty")
+	}
+	token, hash, err := newSecret(AccessTokenPrefix)
+	if err != nil {
+		return "", accessToken, err
+	}
+	accessToken.TokenHash = hash
+	err = rep.DB.Create(&accessToken).Error
+	return token, accessToken, err
+}
+
+// FindByUserID returns the tokens of the given user, newest first.
+func (rep *AccessTokenRepository) FindByUserID(userID uint) ([]AccessToken, error) {
+	var tokens []AccessToken
+	err := rep.DB.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// Authenticate returns the user of the given token and records its use. Tokens
+// of deleted users are not found.
+func (rep *AccessTokenRepository) Authenticate(token string) (User, error) {
+	if !strings.HasPrefix(token, AccessTokenPrefix) {
+		return User{}, gorm.ErrRecordNotFound
+	}
+	var accessToken AccessToken
+	err := rep.DB.Preload("User").First(&accessToken, "token_hash = ?", hashSecret(token)).Error
+	if err != nil {
+		return User{}, err
+	}
+	if accessToken.User.ID == 0 {
+		return User{}, gorm.ErrRecordNotFound
+	}
+	err = rep.DB.Model(&accessToken).Update("last_used_at", time.Now()).Error
+	return accessToken.User, err
+}
+
+// DeleteByID revokes a token of the given user.
+func (rep *AccessTokenRepository) DeleteByID(userID, id uint) error {
+	res := rep.DB.Where("user_id = ?", userID).Delete(&AccessToken{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
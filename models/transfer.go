@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrSameInventory is returned when transferring stock to the inventory that
+// already holds the item.
+var ErrSameInventory = errors.New("cannot transfer to the same inventory")
+
+// Transfer moves the given quantity of an item to another inventory in one
+// transaction. The stock is added to the item with the same name in the target
+// inventory, or for a variant to the variant of its product with the same
+// options, which is created with the category and the tags of the item if it
+// does not exist. Both sides are recorded as transfer movements. It returns
+// the updated source and target items.
+func (rep *ItemRepository) Transfer(itemID, targetInventoryID uint, quantity int,
+	note string) (source Item, target Item, err error) {
+	if quantity <= 0 {
+		return source, target, ErrInvalidMovement
+	}
+
+	err = rep.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Inventory").First(&source, itemID).Error; err != nil {
+			return err
+		}
+		if source.InventoryID == targetInventoryID {
+			return ErrSameInventory
+		}
+		var targetInv Inventory
+		if err := tx.First(&targetInv, targetInventoryID).Error; err != nil {
+			return err
+		}
+
+		q := tx.Where("inventory_id = ?", targetInventoryID)
+		if source.ProductID != nil {
+			q = q.Where("product_id = ? AND options = ?", *source.ProductID, source.Options)
+		} else {
+			q = q.Where("name = ? AND product_id IS NULL", source.Name)
+		}
+		err := q.First(&target).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			target = Item{
+				Name:        source.Name,
+				SKU:         transferSKU(source.SKU, targetInventoryID),
+				Description: source.Description,
+				InventoryID: targetInventoryID,
+				ProductID:   source.ProductID,
+				Options:     source.Options,
+				CategoryID:  source.CategoryID,
+				Tags:        []Tag{},
+			}
+			err = tx.Model(&source).Association("Tags").Find(&target.Tags)
+			if err == nil {
+				err = createItem(tx, &target)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		err = applyMovement(tx, &source, &StockMovement{
+			Delta:  -quantity,
+			Reason: ReasonTransfer,
+			Note:   transferNote(fmt.Sprintf("to %s", targetInv.Name), note),
+		})
+		if err != nil {
+			return err
+		}
+		return applyMovement(tx, &target, &StockMovement{
+			Delta:  quantity,
+			Reason: ReasonTransfer,
+			Note:   transferNote(fmt.Sprintf("from %s", source.Inventory.Name), note),
+		})
+	})
+	return source, target, err
+}
+
+// transferSKU is the SKU of the item that a transfer creates in the target
+// inventory, since SKUs are unique among all items.
+func transferSKU(sku string, targetInventoryID uint) string {
+	return fmt.Sprintf("%s-%d", sku, targetInventoryID)
+}
+
+func transferNote(direction, note string) string {
+	if note == "" {
+		return direction
+	}
+	return direction + ": " + note
+}
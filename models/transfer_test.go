@@ -0,0 +1,53 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestItemRepository_Transfer(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		invRepo := &InventoryRepository{DB: db}
+		school, err := invRepo.Create(Inventory{Name: "School"})
+		assert.Nil(t, err)
+		store, err := invRepo.Create(Inventory{Name: "Store"})
+		assert.Nil(t, err)
+
+		itemRepo := &ItemRepository{DB: db}
+		item, err := itemRepo.Create(Item{Name: "Backpack", SKU: "BACKPACK", InventoryID: school.ID, Quantity: 11})
+		assert.Nil(t, err)
+
+		source, target, err := itemRepo.Transfer(item.ID, store.ID, 5, "")
+		assert.Nil(t, err)
+		assert.Equal(t, 6, source.Quantity)
+		assert.Equal(t, 5, target.Quantity)
+		assert.Equal(t, store.ID, target.InventoryID)
+		assert.Equal(t, item.Name, target.Name)
+		assert.Equal(t, fmt.Sprintf("BACKPACK-%d", store.ID), target.SKU)
+
+		source, target2, err := itemRepo.Transfer(item.ID, store.ID, 6, "")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, source.Quantity)
+		assert.Equal(t, target.ID, target2.ID)
+		assert.Equal(t, 11, target2.Quantity)
+
+		_, _, err = itemRepo.Transfer(item.ID, store.ID, 1, "")
+		assert.ErrorIs(t, err, ErrNegativeStock)
+		_, _, err = itemRepo.Transfer(item.ID, school.ID, 1, "")
+		assert.ErrorIs(t, err, ErrSameInventory)
+		_, _, err = itemRepo.Transfer(item.ID, 100, 1, "")
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		_, _, err = itemRepo.Transfer(target.ID, school.ID, 0, "")
+		assert.ErrorIs(t, err, ErrInvalidMovement)
+
+		movementRepo := &StockMovementRepository{DB: db}
+		movements, err := movementRepo.FindByItemID(target.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(movements))
+		assert.Equal(t, ReasonTransfer, movements[0].Reason)
+		assert.Equal(t, "from School", movements[0].Note)
+	})
+}
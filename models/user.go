@@ -0,0 +1,99 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// MinPasswordLength is the minimum length of user passwords.
+const MinPasswordLength = 8
+
+var (
+	// ErrInvalidCredentials is returned when a username and password do not
+	// match a user.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrWeakPassword is returned when a password is shorter than
+	// MinPasswordLength.
+	ErrWeakPassword = errors.New("password must be at least 8 characters")
+)
+
+// User is an account that can sign in.
+type User struct {
+	gorm.Model
+	Username     string `gorm:"not null;unique"`
+	PasswordHash string `gorm:"not null"`
+	Admin        bool   `gorm:"not null;default:false"`
+}
+
+// SetPassword hashes the given password into the user.
+func (u *User) SetPassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+type UserRepository struct {
+	DB *gorm.DB
+}
+
+// WithContext returns a repository that runs its queries with ctx.
+func (rep *UserRepository) WithContext(ctx context.Context) *UserRepository {
+	return &UserRepository{DB: rep.DB.WithContext(ctx)}
+}
+
+// Create creates a user with the given password.
+func (rep *UserRepository) Create(username, password string, admin bool) (User, error) {
+	user := User{Username: strings.TrimSpace(username), Admin: admin}
+	if user.Username == "" {
+		return user, errors.New("username cannot be empty")
+	}
+	if err := user.SetPassword(password); err != nil {
+		return user, err
+	}
+	err := rep.DB.Create(&user).Error
+	return user, err
+}
+
+func (rep *UserRepository) FindByID(id uint) (User, error) {
+	var user User
+	err := rep.DB.First(&user, id).Error
+	return user, err
+}
+
+func (rep *UserRepository) FindAll() ([]User, error) {
+	var users []User
+	err := rep.DB.Order("username").Find(&users).Error
+	return users, err
+}
+
+// dummyHash is compared against when a username does not exist, so that
+// looking up unknown users takes as long as checking a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// Authenticate returns the user with the given username and password, or
+// ErrInvalidCredentials.
+func (rep *UserRepository) Authenticate(username, password string) (User, error) {
+	var user User
+	res := rep.DB.Where("username = ?", strings.TrimSpace(username)).Limit(1).Find(&user)
+	if res.Error != nil {
+		return user, res.Error
+	}
+	hash := []byte(user.PasswordHash)
+	if res.RowsAffected == 0 {
+		hash = dummyHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || res.RowsAffected == 0 {
+		return User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestUserRepository(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		userRepo := &UserRepository{DB: db}
+		_, err := userRepo.Create("alice", "short", true)
+		assert.ErrorIs(t, err, ErrWeakPassword)
+
+		user, err := userRepo.Create("alice", "correct horse", true)
+		assert.Nil(t, err)
+		assert.NotEqual(t, "correct horse", user.PasswordHash)
+
+		_, err = userRepo.Create("alice", "another password", false)
+		assert.NotNil(t, err, "usernames must be unique")
+
+		found, err := userRepo.Authenticate("alice", "correct horse")
+		assert.Nil(t, err)
+		assert.Equal(t, user.ID, found.ID)
+		assert.True(t, found.Admin)
+
+		_, err = userRepo.Authenticate("alice", "wrong password")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+		_, err = userRepo.Authenticate("bob", "correct horse")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+}
+
+func TestSessionRepository(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		user, err := (&UserRepository{DB: db}).Create("alice", "correct horse", false)
+		assert.Nil(t, err)
+
+		sessionRepo := &SessionRepository{DB: db}
+		token, session, err := sessionRepo.Create(user.ID, time.Hour)
+		assert.Nil(t, err)
+		assert.NotEqual(t, token, session.ID, "only the hash of the token is stored")
+
+		found, err := sessionRepo.Find(token)
+		assert.Nil(t, err)
+		assert.Equal(t, "alice", found.User.Username)
+
+		expired, expiredSession, err := sessionRepo.Create(user.ID, -time.Minute)
+		assert.Nil(t, err)
+		_, err = sessionRepo.Find(expired)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		flashRepo := &FlashRepository{DB: db}
+		assert.Nil(t, flashRepo.Add(session.ID, FlashInfo, "kept"))
+		assert.Nil(t, flashRepo.Add(expiredSession.ID, FlashInfo, "expired"))
+		n, err := sessionRepo.DeleteExpired()
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+		var flashes int64
+		assert.Nil(t, db.Model(&Flash{}).Count(&flashes).Error)
+		assert.Equal(t, int64(1), flashes, "flashes of expired sessions are deleted")
+
+		assert.Nil(t, sessionRepo.Delete(token))
+		_, err = sessionRepo.Find(token)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		assert.Nil(t, db.Model(&Flash{}).Count(&flashes).Error)
+		assert.Equal(t, int64(0), flashes, "flashes of ended sessions are deleted")
+	})
+}
+
+func TestFlashRepository(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		flashRepo := &FlashRepository{DB: db}
+		assert.Nil(t, flashRepo.Add("a", FlashSuccess, "Item 'Pencil' deleted"))
+		assert.Nil(t, flashRepo.Add("b", FlashInfo, "other session"))
+		assert.Nil(t, flashRepo.Add("a", FlashWarning, "second"))
+
+		flashes, err := flashRepo.Pop("a")
+		assert.Nil(t, err)
+		if assert.Equal(t, 2, len(flashes)) {
+			assert.Equal(t, FlashSuccess, flashes[0].Kind)
+			assert.Equal(t, "Item 'Pencil' deleted", flashes[0].Message)
+			assert.Equal(t, "second", flashes[1].Message)
+		}
+
+		flashes, err = flashRepo.Pop("a")
+		assert.Nil(t, err)
+		assert.Empty(t, flashes, "flashes are shown once")
+		flashes, err = flashRepo.Pop("b")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(flashes))
+	})
+}
+
+func TestAccessTokenRepository(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *gorm.DB) {
+		userRepo := &UserRepository{DB: db}
+		alice, err := userRepo.Create("alice", "correct horse", false)
+		assert.Nil(t, err)
+		bob, err := userRepo.Create("bob", "battery staple", false)
+		assert.Nil(t, err)
+
+		tokenRepo := &AccessTokenRepository{DB: db}
+		token, accessToken, err := tokenRepo.Create(alice.ID, "ci")
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(token, AccessTokenPrefix))
+
+		user, err := tokenRepo.Authenticate(token)
+		assert.Nil(t, err)
+		assert.Equal(t, alice.ID, user.ID)
+		_, err = tokenRepo.Authenticate(token + "x")
+		assert.NotNil(t, err)
+
+		tokens, err := tokenRepo.FindByUserID(alice.ID)
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(tokens)) {
+			assert.NotNil(t, tokens[0].LastUsedAt)
+		}
+
+		assert.ErrorIs(t, tokenRepo.DeleteByID(bob.ID, accessToken.ID), gorm.ErrRecordNotFound)
+		assert.Nil(t, tokenRepo.DeleteByID(alice.ID, accessToken.ID))
+		_, err = tokenRepo.Authenticate(token)
+		assert.NotNil(t, err)
+	})
+}
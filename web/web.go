@@ -0,0 +1,34 @@
+// Package web holds the HTML templates and the static files of the server.
+// Both are embedded into the binary, so that it runs from any working
+// directory and does not need access to the internet.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed templates
+var templates embed.FS
+
+//go:embed static
+var static embed.FS
+
+// Templates returns the embedded HTML templates.
+func Templates() fs.FS {
+	return sub(templates, "templates")
+}
+
+// Static returns the embedded static files, which are served under /static.
+func Static() fs.FS {
+	return sub(static, "static")
+}
+
+func sub(fsys embed.FS, dir string) fs.FS {
+	s, err := fs.Sub(fsys, dir)
+	if err != nil {
+		// The directory is embedded, so this cannot happen.
+		panic(err)
+	}
+	return s
+}